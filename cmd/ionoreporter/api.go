@@ -0,0 +1,330 @@
+package main
+
+import (
+  "fmt"
+  "time"
+  "net/http"
+  "encoding/json"
+  "strings"
+  "database/sql"
+
+  log "github.com/sirupsen/logrus"
+)
+
+/* The API is a read-only JSON view of the ionosondes and parameters tables,
+ * enabled with API=true and served on HTTP_LISTEN:
+ *
+ * GET /api/ionosondes
+ * GET /api/ionosondes/{ursiCode}
+ * GET /api/ionosondes/{ursiCode}/latest
+ * GET /api/ionosondes/{ursiCode}/parameters?from=&to=
+ *
+ * from and to are RFC3339, "2006-01-02 15:04:05" or "2006-01-02" (UTC),
+ * default is the last 24 hours. Parameters include flags, the quality flag
+ * of each suspicious value (see validate.go), and confidence, the OCR
+ * confidence (0-100) of the date and each value.
+ */
+
+const (
+  apiPrefix string = "/api/"
+  apiIonosondesPath string = "/api/ionosondes"
+)
+
+type apiIonosonde struct {
+  UrsiCode string `json:"ursiCode"`
+  Name string `json:"name"`
+  Latitude *float64 `json:"latitude"`
+  Longitude *float64 `json:"longitude"`
+  ImageUrls []string `json:"imageUrls"`
+  Scrape bool `json:"scrape"`
+  Enabled bool `json:"enabled"`
+}
+
+type apiParameters struct {
+  Date time.Time `json:"dt"`
+  FoF2 *float64 `json:"foF2"`
+  FoF1 *float64 `json:"foF1"`
+  FoE *float64 `json:"foE"`
+  FxI *float64 `json:"fxI"`
+  FoEs *float64 `json:"foEs"`
+  Fmin *float64 `json:"fmin"`
+  HmF2 *float64 `json:"hmF2"`
+  HmE *float64 `json:"hmE"`
+  HF *float64 `json:"hF"`
+  Flags map[string]string `json:"flags,omitempty"`
+  Confidence map[string]float64 `json:"confidence,omitempty"`
+}
+
+type apiError struct {
+  Error string `json:"error"`
+}
+
+func nullFloat64Ptr(n sql.NullFloat64) (*float64) {
+  if ! n.Valid {
+    return nil
+  }
+  v := n.Float64
+  return &v
+}
+
+func toApiIonosonde(i Ionosonde) (apiIonosonde) {
+  urls := []string{}
+  for _, u := range strings.Split(i.ImageUrl, `,`) {
+    if u = strings.TrimSpace(u); u != "" {
+      urls = append(urls, u)
+    }
+  }
+  return apiIonosonde{
+    UrsiCode: i.UrsiCode,
+    Name: i.Name,
+    Latitude: nullFloat64Ptr(i.Latitude),
+    Longitude: nullFloat64Ptr(i.Longitude),
+    ImageUrls: urls,
+    Scrape: i.Scrape.Valid && i.Scrape.Bool,
+    Enabled: i.Enabled.Valid && i.Enabled.Bool,
+  }
+}
+
+func toApiParameters(p Parameters) (apiParameters) {
+  return apiParameters{
+    Date: p.Date.UTC(),
+    FoF2: nullFloat64Ptr(p.FoF2),
+    FoF1: nullFloat64Ptr(p.FoF1),
+    FoE: nullFloat64Ptr(p.FoE),
+    FxI: nullFloat64Ptr(p.FxI),
+    FoEs: nullFloat64Ptr(p.FoEs),
+    Fmin: nullFloat64Ptr(p.Fmin),
+    HmF2: nullFloat64Ptr(p.HmF2),
+    HmE: nullFloat64Ptr(p.HmE),
+    HF: nullFloat64Ptr(p.HF),
+    Flags: parameterFlagsMap(p),
+    Confidence: parameterConfidenceMap(p),
+  }
+}
+
+/* parameterConfidenceMap() returns the OCR confidence of the date (dt) and
+ * values of p by name, nil if there are none.
+ */
+func parameterConfidenceMap(p Parameters) (map[string]float64) {
+  var confidence map[string]float64
+  add := func(name string, c sql.NullFloat64) {
+    if c.Valid {
+      if confidence == nil {
+        confidence = map[string]float64{}
+      }
+      confidence[name] = c.Float64
+    }
+  }
+  add("dt", p.DtConf)
+  for _, v := range p.values() {
+    add(v.Name, *v.Conf)
+  }
+  return confidence
+}
+
+/* parameterFlagsMap() returns the quality flags of p by value name, nil if
+ * no value is flagged.
+ */
+func parameterFlagsMap(p Parameters) (map[string]string) {
+  var flags map[string]string
+  for _, v := range p.values() {
+    if v.Flag.Valid {
+      if flags == nil {
+        flags = map[string]string{}
+      }
+      flags[v.Name] = v.Flag.String
+    }
+  }
+  return flags
+}
+
+func writeJson(w http.ResponseWriter, status int, v interface{}) {
+  w.Header().Set("Content-Type", "application/json")
+  w.WriteHeader(status)
+  enc := json.NewEncoder(w)
+  if err := enc.Encode(v); err != nil {
+    log.Errorf("Unable to encode API response: %v", err)
+  }
+}
+
+func writeJsonError(w http.ResponseWriter, status int, msg string) {
+  writeJson(w, status, apiError{ Error: msg })
+}
+
+/* parseApiTime parses the from and to query parameters */
+func parseApiTime(s string) (time.Time, error) {
+  for _, layout := range []string{ time.RFC3339, SqliteDateFormat, "2006-01-02" } {
+    t, err := time.Parse(layout, s)
+    if err == nil {
+      return t.UTC(), nil
+    }
+  }
+  return time.Time{}, fmt.Errorf("%s is not RFC3339, %s or 2006-01-02", s, SqliteDateFormat)
+}
+
+/* parseApiEndTime is parseApiTime for an inclusive to, a date only is the
+ * last second of that day.
+ */
+func parseApiEndTime(s string) (time.Time, error) {
+  t, err := parseApiTime(s)
+  if err != nil {
+    return t, err
+  }
+  if _, err := time.Parse("2006-01-02", s); err == nil {
+    t = t.AddDate(0, 0, 1).Add(-time.Second)
+  }
+  return t, nil
+}
+
+/* getParametersFromDb() returns parameters for an ionosonde within from and
+ * to (inclusive), newest last.
+ */
+func getParametersFromDb(ionosondeId string, from, to time.Time) ([]Parameters, error) {
+  var params []Parameters
+  rows, err := db.Query("select parameterId, ionosondeId, dt, " + parameterColumns + " from parameters " +
+                        "where ionosondeId=? and dt >= ? and dt <= ? order by dt",
+                        ionosondeId, from.UTC().Format(SqliteDateFormat), to.UTC().Format(SqliteDateFormat))
+  if err != nil {
+    return params, err
+  }
+  defer rows.Close()
+  for rows.Next() {
+    p := Parameters{}
+    err = rows.Scan(append([]interface{}{ &p.ParameterId, &p.IonosondeId, &p.Date },
+                    p.scanValues()...)...)
+    if err != nil {
+      return params, err
+    }
+    params = append(params, p)
+  }
+  return params, rows.Err()
+}
+
+/* getLatestParametersFromDb() returns the newest parameters row for an
+ * ionosonde, sql.ErrNoRows if there are none.
+ */
+func getLatestParametersFromDb(ionosondeId string) (Parameters, error) {
+  p := Parameters{}
+  err := db.QueryRow("select parameterId, ionosondeId, dt, " + parameterColumns + " from parameters " +
+                     "where ionosondeId=? order by dt desc limit 1", ionosondeId).Scan(
+                     append([]interface{}{ &p.ParameterId, &p.IonosondeId, &p.Date }, p.scanValues()...)...)
+  return p, err
+}
+
+/* apiHandler serves everything under /api/ */
+func apiHandler(w http.ResponseWriter, r *http.Request) {
+  if r.Method != http.MethodGet && r.Method != http.MethodHead {
+    w.Header().Set("Allow", "GET, HEAD")
+    writeJsonError(w, http.StatusMethodNotAllowed, "Method not allowed")
+    return
+  }
+  path := strings.TrimSuffix(r.URL.Path, "/")
+  if path == apiIonosondesPath {
+    ionosondes, err := getIonosondesFromDb("order by ursiCode")
+    if err != nil {
+      writeJsonError(w, http.StatusInternalServerError, "Unable to query ionosondes")
+      return
+    }
+    out := []apiIonosonde{}
+    for _, i := range ionosondes {
+      out = append(out, toApiIonosonde(i))
+    }
+    writeJson(w, http.StatusOK, out)
+    return
+  }
+  if ! strings.HasPrefix(path, apiIonosondesPath + "/") {
+    writeJsonError(w, http.StatusNotFound, "Not found")
+    return
+  }
+  // {ursiCode} or {ursiCode}/latest or {ursiCode}/parameters
+  elements := strings.Split(strings.TrimPrefix(path, apiIonosondesPath + "/"), "/")
+  if len(elements) > 2 || elements[0] == "" {
+    writeJsonError(w, http.StatusNotFound, "Not found")
+    return
+  }
+  ionosondes, err := getIonosondesFromDb("where ursiCode=? collate nocase", elements[0])
+  if err != nil {
+    writeJsonError(w, http.StatusInternalServerError, "Unable to query ionosondes")
+    return
+  }
+  if len(ionosondes) == 0 {
+    writeJsonError(w, http.StatusNotFound, "Ionosonde " + elements[0] + " not found")
+    return
+  }
+  i := ionosondes[0]
+  if len(elements) == 1 {
+    writeJson(w, http.StatusOK, toApiIonosonde(i))
+    return
+  }
+  switch elements[1] {
+    case "latest":
+      p, err := getLatestParametersFromDb(i.IonosondeId)
+      if err == sql.ErrNoRows {
+        writeJsonError(w, http.StatusNotFound, "No parameters for ionosonde " + i.UrsiCode)
+        return
+      } else if err != nil {
+        log.Errorf("API unable to query latest parameters for %s: %v", i.UrsiCode, err)
+        writeJsonError(w, http.StatusInternalServerError, "Unable to query parameters")
+        return
+      }
+      writeJson(w, http.StatusOK, toApiParameters(p))
+    case "parameters":
+      to := time.Now().UTC()
+      from := to.Add(-24 * time.Hour)
+      if v := r.URL.Query().Get("from"); v != "" {
+        if from, err = parseApiTime(v); err != nil {
+          writeJsonError(w, http.StatusBadRequest, "Invalid from: " + err.Error())
+          return
+        }
+      }
+      if v := r.URL.Query().Get("to"); v != "" {
+        if to, err = parseApiEndTime(v); err != nil {
+          writeJsonError(w, http.StatusBadRequest, "Invalid to: " + err.Error())
+          return
+        }
+      }
+      if to.Before(from) {
+        writeJsonError(w, http.StatusBadRequest, "to is before from")
+        return
+      }
+      params, err := getParametersFromDb(i.IonosondeId, from, to)
+      if err != nil {
+        log.Errorf("API unable to query parameters for %s: %v", i.UrsiCode, err)
+        writeJsonError(w, http.StatusInternalServerError, "Unable to query parameters")
+        return
+      }
+      out := []apiParameters{}
+      for _, p := range params {
+        out = append(out, toApiParameters(p))
+      }
+      writeJson(w, http.StatusOK, out)
+    default:
+      writeJsonError(w, http.StatusNotFound, "Not found")
+  }
+}
+
+/* startHttpServer() serves the API and/or metrics on cnf.HttpListen in the
+ * background.
+ */
+func startHttpServer() {
+  mux := http.NewServeMux()
+  if cnf.Api {
+    log.Infof("Serving HTTP API on %s%s", cnf.HttpListen, apiPrefix)
+    mux.HandleFunc(apiPrefix, apiHandler)
+  }
+  if cnf.Metrics {
+    log.Infof("Serving metrics on %s/metrics", cnf.HttpListen)
+    mux.Handle("/metrics", metrics)
+  }
+  srv := &http.Server{
+    Addr: cnf.HttpListen,
+    Handler: mux,
+    ReadTimeout: 10 * time.Second,
+    WriteTimeout: 30 * time.Second,
+  }
+  go func() {
+    if err := srv.ListenAndServe(); err != nil {
+      log.Fatalf("HTTP server failed: %v", err)
+    }
+  }()
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+  "encoding/json"
+  "net/http/httptest"
+  "path/filepath"
+  "testing"
+  "time"
+)
+
+func TestParseApiEndTime(t *testing.T) {
+  cases := []struct {
+    s string
+    want time.Time
+  }{
+    { "2020-11-02", time.Date(2020, time.November, 2, 23, 59, 59, 0, time.UTC) },
+    { "2020-12-31", time.Date(2020, time.December, 31, 23, 59, 59, 0, time.UTC) },
+    { "2020-11-02 00:00:00", time.Date(2020, time.November, 2, 0, 0, 0, 0, time.UTC) },
+    { "2020-11-02T12:00:00+01:00", time.Date(2020, time.November, 2, 11, 0, 0, 0, time.UTC) },
+  }
+  for _, c := range cases {
+    to, err := parseApiEndTime(c.s)
+    if err != nil || ! to.Equal(c.want) {
+      t.Errorf("parseApiEndTime(%q) = %s, %v, want %s", c.s, to, err, c.want)
+    }
+  }
+  if _, err := parseApiEndTime("2020-11"); err == nil {
+    t.Errorf("parseApiEndTime(2020-11) did not fail")
+  }
+}
+
+func TestApiParametersTo(t *testing.T) {
+  saved := *cnf
+  defer func() { *cnf = saved }()
+  cnf.DatabaseFile = filepath.Join(t.TempDir(), "ionoreporter.db")
+  cnf.ArchiveDir = ""
+  openDatabase()
+  defer db.Close()
+
+  i, err := getIonosondeByUrsi("JR055")
+  if err != nil {
+    t.Fatal(err)
+  }
+  for _, dt := range []time.Time{
+    time.Date(2020, time.November, 1, 12, 0, 0, 0, time.UTC),
+    time.Date(2020, time.November, 2, 0, 0, 0, 0, time.UTC),
+    time.Date(2020, time.November, 2, 23, 45, 0, 0, time.UTC),
+    time.Date(2020, time.November, 3, 0, 0, 0, 0, time.UTC),
+  } {
+    p := Parameters{ Date: dt }
+    if _, _, err := insertParameters(i, &p); err != nil {
+      t.Fatal(err)
+    }
+  }
+  cases := []struct {
+    query string
+    want int
+  }{
+    // a date is the whole day
+    { "from=2020-11-02&to=2020-11-02", 2 },
+    { "from=2020-11-01&to=2020-11-02", 3 },
+    { "from=2020-11-01&to=2020-11-02T00:00:00Z", 2 },
+    { "from=2020-11-01&to=2020-11-02%2023:00:00", 2 },
+  }
+  for _, c := range cases {
+    w := httptest.NewRecorder()
+    apiHandler(w, httptest.NewRequest("GET", apiPrefix + "ionosondes/JR055/parameters?" + c.query, nil))
+    var out []apiParameters
+    if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+      t.Fatalf("%s: %v: %s", c.query, err, w.Body.String())
+    }
+    if len(out) != c.want {
+      t.Errorf("%s: %d parameters, want %d", c.query, len(out), c.want)
+    }
+  }
+}
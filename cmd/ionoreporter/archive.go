@@ -0,0 +1,210 @@
+package main
+
+import (
+  "fmt"
+  "io"
+  "os"
+  "time"
+  "strings"
+  "path/filepath"
+
+  log "github.com/sirupsen/logrus"
+)
+
+/* The image archive keeps the raw ionograms that produced each parameters
+ * row, enabled by setting ARCHIVE_DIR. Images are stored under ARCHIVE_DIR
+ * in directories named by ARCHIVE_LAYOUT where {ursi}, {year}, {month} and
+ * {day} are replaced by the URSI code and the ionogram's date (UTC). The
+ * images table maps each file to its parameterId. Images older than
+ * ARCHIVE_RETENTION_DAYS are removed after every scrape, and if the archive
+ * is larger than ARCHIVE_MAXSIZE MB the oldest images are removed until it
+ * fits. 0 disables either limit.
+ */
+
+/* validateArchiveLayout() checks that layout is a relative path not
+ * escaping the archive directory.
+ */
+func validateArchiveLayout(layout string) error {
+  if strings.TrimSpace(layout) == "" {
+    return fmt.Errorf("Archive layout is empty, use for example {ursi}/{year}/{month}/{day}")
+  }
+  if filepath.IsAbs(layout) {
+    return fmt.Errorf("Archive layout %s must be relative to the archive directory", layout)
+  }
+  for _, e := range strings.Split(filepath.ToSlash(layout), "/") {
+    if e == ".." {
+      return fmt.Errorf("Archive layout %s must not contain ..", layout)
+    }
+  }
+  return nil
+}
+
+/* archiveFile() returns the name of the archived image relative to
+ * cnf.ArchiveDir, e.g JR055/2020/11/27/JR055_20201127101500.png
+ */
+func archiveFile(ursiCode string, dt time.Time, ext string) string {
+  dt = dt.UTC()
+  dir := strings.NewReplacer(
+    "{ursi}", ursiCode,
+    "{year}", dt.Format("2006"),
+    "{month}", dt.Format("01"),
+    "{day}", dt.Format("02"),
+  ).Replace(cnf.ArchiveLayout)
+  return filepath.Join(dir, ursiCode + "_" + dt.Format("20060102150405") + ext)
+}
+
+func copyFile(src, dst string) (int64, error) {
+  in, err := os.Open(src)
+  if err != nil {
+    return 0, err
+  }
+  defer in.Close()
+  out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+  if err != nil {
+    return 0, err
+  }
+  n, err := io.Copy(out, in)
+  if cerr := out.Close(); err == nil {
+    err = cerr
+  }
+  if err != nil {
+    os.Remove(dst)
+  }
+  return n, err
+}
+
+/* archiveImage() copies the downloaded ionogram imgFile into the archive and
+ * records it in the images table keyed to parameterId.
+ */
+func archiveImage(i Ionosonde, parameterId int64, dt, downloaded time.Time, url, imgFile string) error {
+  file := archiveFile(i.UrsiCode, dt, filepath.Ext(imgFile))
+  dst := filepath.Join(cnf.ArchiveDir, file)
+  if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+    return err
+  }
+  size, err := copyFile(imgFile, dst)
+  if err != nil {
+    return err
+  }
+  _, err = db.Exec("insert into images (parameterId, ionosondeId, dt, downloaded, url, file, size) " +
+                   "values (?, ?, ?, ?, ?, ?, ?)", parameterId, i.IonosondeId,
+                   dt.UTC().Format(SqliteDateFormat), downloaded.UTC().Format(SqliteDateFormat),
+                   url, file, size)
+  if err != nil {
+    os.Remove(dst)
+    return err
+  }
+  log.Infof("Archived %s ionogram %s as %s", i.UrsiCode, dt.Format(SqliteDateFormat), dst)
+  return nil
+}
+
+/* removeArchivedImage() removes an archived image file, the images row and
+ * any directories left empty.
+ */
+func removeArchivedImage(imageId int64, file string) error {
+  if err := removeArchiveFile(file); err != nil {
+    return err
+  }
+  _, err := db.Exec("delete from images where imageId=?", imageId)
+  return err
+}
+
+/* removeArchiveFile() removes an archived image file (relative to
+ * cnf.ArchiveDir) and any directories left empty. Without ARCHIVE_DIR the
+ * file can not be found and nothing is removed.
+ */
+func removeArchiveFile(file string) error {
+  if cnf.ArchiveDir == "" {
+    return fmt.Errorf("ARCHIVE_DIR is not set, unable to locate %s", file)
+  }
+  path := filepath.Join(cnf.ArchiveDir, file)
+  if err := os.Remove(path); err != nil && ! os.IsNotExist(err) {
+    return err
+  }
+  removeEmptyArchiveDirs(file)
+  return nil
+}
+
+/* removeEmptyArchiveDirs() removes the directories of file (relative to
+ * cnf.ArchiveDir) that are empty, up to but not including cnf.ArchiveDir.
+ */
+func removeEmptyArchiveDirs(file string) {
+  root := filepath.Clean(cnf.ArchiveDir)
+  for dir := filepath.Dir(filepath.Join(root, file)); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+    // os.Remove fails on directories that are not empty
+    if os.Remove(dir) != nil {
+      break
+    }
+  }
+}
+
+type archivedImage struct {
+  ImageId int64
+  File string
+  Size int64
+}
+
+func queryArchivedImages(query string, args ...interface{}) ([]archivedImage, error) {
+  var images []archivedImage
+  rows, err := db.Query(query, args...)
+  if err != nil {
+    return images, err
+  }
+  defer rows.Close()
+  for rows.Next() {
+    a := archivedImage{}
+    if err := rows.Scan(&a.ImageId, &a.File, &a.Size); err != nil {
+      return images, err
+    }
+    images = append(images, a)
+  }
+  return images, rows.Err()
+}
+
+/* pruneArchive() applies the retention policy (ARCHIVE_RETENTION_DAYS and
+ * ARCHIVE_MAXSIZE) to the archive, returns the number of images removed.
+ */
+func pruneArchive() (int, error) {
+  removed := 0
+  if cnf.ArchiveRetentionDays > 0 {
+    cutoff := time.Now().UTC().AddDate(0, 0, -cnf.ArchiveRetentionDays)
+    images, err := queryArchivedImages("select imageId, file, size from images where downloaded < ?",
+                                       cutoff.Format(SqliteDateFormat))
+    if err != nil {
+      return removed, err
+    }
+    for _, a := range images {
+      if err := removeArchivedImage(a.ImageId, a.File); err != nil {
+        return removed, err
+      }
+      removed++
+    }
+  }
+  if cnf.ArchiveMaxSize > 0 {
+    var total int64
+    if err := db.QueryRow("select coalesce(sum(size), 0) from images").Scan(&total); err != nil {
+      return removed, err
+    }
+    limit := cnf.ArchiveMaxSize * 1024 * 1024
+    if total > limit {
+      images, err := queryArchivedImages("select imageId, file, size from images order by downloaded, imageId")
+      if err != nil {
+        return removed, err
+      }
+      for _, a := range images {
+        if total <= limit {
+          break
+        }
+        if err := removeArchivedImage(a.ImageId, a.File); err != nil {
+          return removed, err
+        }
+        total -= a.Size
+        removed++
+      }
+    }
+  }
+  if removed > 0 {
+    log.Infof("Removed %d images from archive %s according to retention policy", removed, cnf.ArchiveDir)
+  }
+  return removed, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "testing"
+  "time"
+)
+
+func TestRemovePurgeArchive(t *testing.T) {
+  saved := *cnf
+  defer func() { *cnf = saved }()
+  dir := t.TempDir()
+  archive := filepath.Join(dir, "archive")
+  cnf.DatabaseFile = filepath.Join(dir, "ionoreporter.db")
+  cnf.ArchiveDir = archive
+  cnf.ArchiveLayout = "{ursi}/{year}/{month}/{day}"
+  openDatabase()
+  defer db.Close()
+
+  i, err := getIonosondeByUrsi("JR055")
+  if err != nil {
+    t.Fatal(err)
+  }
+  img := filepath.Join(dir, "JR055.png")
+  if err := ioutil.WriteFile(img, []byte("png"), 0644); err != nil {
+    t.Fatal(err)
+  }
+  p := Parameters{ Date: time.Date(2021, time.March, 20, 11, 15, 0, 0, time.UTC) }
+  _, parameterId, err := insertParameters(i, &p)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if err := archiveImage(i, parameterId, p.Date, p.Date, "http://example.com/JR055.png", img); err != nil {
+    t.Fatal(err)
+  }
+  file := filepath.Join(archive, archiveFile("JR055", p.Date, ".png"))
+
+  // without ARCHIVE_DIR the image can not be found, nothing is removed
+  cnf.ArchiveDir = ""
+  if err := removeArchiveFile(archiveFile("JR055", p.Date, ".png")); err == nil {
+    t.Errorf("removeArchiveFile without ARCHIVE_DIR did not fail")
+  }
+  if err := ionosondeRemove("JR055", []string{ "-purge" }); err == nil {
+    t.Errorf("ionosonde remove -purge without ARCHIVE_DIR did not fail")
+  }
+  if _, err := getIonosondeByUrsi("JR055"); err != nil {
+    t.Errorf("JR055 was removed: %v", err)
+  }
+  if _, err := os.Stat(file); err != nil {
+    t.Errorf("archived image was removed: %v", err)
+  }
+
+  cnf.ArchiveDir = archive
+  if err := ionosondeRemove("JR055", []string{ "-purge" }); err != nil {
+    t.Fatal(err)
+  }
+  if _, err := os.Stat(file); ! os.IsNotExist(err) {
+    t.Errorf("archived image was not removed: %v", err)
+  }
+  if _, err := os.Stat(filepath.Join(archive, "JR055")); ! os.IsNotExist(err) {
+    t.Errorf("empty archive directories were not removed: %v", err)
+  }
+  if _, err := os.Stat(archive); err != nil {
+    t.Errorf("ARCHIVE_DIR was removed: %v", err)
+  }
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+  "database/sql"
+  "flag"
+  "fmt"
+  "net/http"
+  "os"
+  "strings"
+  "time"
+)
+
+/* The backfill command populates the parameters table of an ionosonde with
+ * history, e.g after adding a new station. Ionosondes with sourceType
+ * didbase are queried from DIDBase one -chunk at a time, others need a
+ * historyUrl: a URL template of the ionogram (or SAO/SAO-XML file, see
+ * scaled.go) at a given time where these are replaced by the UTC time of
+ * every -step between -from and -to:
+ *
+ * {ursi} {year} {month} {day} {doy} {hour} {minute} {second}
+ *
+ * Everything goes through the same interpretation and validation as scraped
+ * ionograms and rows already in the database are skipped. The date read
+ * from an ionogram must be within one step of the time in its URL, as the
+ * age checks of scraping (plausibility.go) do not apply to history. Ionograms
+ * that are not found (HTTP 404 or 410) are counted as missing, other download
+ * errors as failed. Progress is kept in the backfills table after every
+ * step, running the same backfill again resumes where it stopped.
+ */
+
+const (
+  defaultBackfillStep time.Duration = 15 * time.Minute
+  defaultBackfillChunk time.Duration = 24 * time.Hour
+)
+
+/* historyUrl() returns the historyUrl template of ionosonde i expanded for
+ * time t.
+ */
+func historyUrl(i Ionosonde, t time.Time) (string) {
+  t = t.UTC()
+  return strings.NewReplacer(
+    "{ursi}", i.UrsiCode,
+    "{year}", t.Format("2006"),
+    "{month}", t.Format("01"),
+    "{day}", t.Format("02"),
+    "{doy}", t.Format("002"),
+    "{hour}", t.Format("15"),
+    "{minute}", t.Format("04"),
+    "{second}", t.Format("05"),
+  ).Replace(i.HistoryUrl.String)
+}
+
+// backfill is a backfills row
+type backfill struct {
+  BackfillId int64
+  From, To time.Time
+  DoneUntil sql.NullTime
+  Finished sql.NullTime
+  Inserted, Duplicates, Missing, Failed int
+}
+
+/* getBackfill() returns the backfill of ionosonde i from from to to, a new
+ * one (inserted into the backfills table) if there is none. restart resets
+ * the progress of an existing one.
+ */
+func getBackfill(i Ionosonde, from, to time.Time, restart bool) (backfill, error) {
+  b := backfill{ From: from, To: to }
+  fromDt, toDt := from.UTC().Format(SqliteDateFormat), to.UTC().Format(SqliteDateFormat)
+  now := time.Now().UTC().Format(SqliteDateFormat)
+  err := db.QueryRow("select backfillId, doneUntil, finished, inserted, duplicates, missing, failed " +
+                     "from backfills where ionosondeId=? and fromDt=? and toDt=?", i.IonosondeId,
+                     fromDt, toDt).Scan(&b.BackfillId, &b.DoneUntil, &b.Finished, &b.Inserted, &b.Duplicates,
+                     &b.Missing, &b.Failed)
+  if err == sql.ErrNoRows {
+    res, err := db.Exec("insert into backfills (ionosondeId, fromDt, toDt, started) values (?, ?, ?, ?)",
+                        i.IonosondeId, fromDt, toDt, now)
+    if err != nil {
+      return b, err
+    }
+    b.BackfillId, err = res.LastInsertId()
+    return b, err
+  }
+  if err != nil || ! restart {
+    return b, err
+  }
+  _, err = db.Exec("update backfills set doneUntil=null, finished=null, inserted=0, duplicates=0, missing=0, " +
+                   "failed=0, started=?, updated=null where backfillId=?", now, b.BackfillId)
+  return backfill{ BackfillId: b.BackfillId, From: from, To: to }, err
+}
+
+/* saveProgress() records that b is done until doneUntil, finished if it is
+ * done until b.To.
+ */
+func (b *backfill) saveProgress(doneUntil time.Time) (error) {
+  now := time.Now().UTC()
+  b.DoneUntil = sql.NullTime{ Time: doneUntil, Valid: true }
+  var finished interface{}
+  if ! doneUntil.Before(b.To) {
+    b.Finished = sql.NullTime{ Time: now, Valid: true }
+    finished = now.Format(SqliteDateFormat)
+  }
+  _, err := db.Exec("update backfills set doneUntil=?, updated=?, finished=?, inserted=?, duplicates=?, " +
+                    "missing=?, failed=? where backfillId=?", doneUntil.UTC().Format(SqliteDateFormat),
+                    now.Format(SqliteDateFormat), finished, b.Inserted, b.Duplicates, b.Missing, b.Failed,
+                    b.BackfillId)
+  return err
+}
+
+/* count() adds the result of inserting one parameters row to b */
+func (b *backfill) count(status scrapeStatus) {
+  switch status {
+    case scrapeInserted:
+      b.Inserted++
+    case scrapeDuplicate:
+      b.Duplicates++
+    default:
+      b.Failed++
+  }
+}
+
+/* isNotFound() returns true if err is a download answered with 404 or 410 */
+func isNotFound(err error) (bool) {
+  e, ok := err.(httpStatusError)
+  return ok && (e.StatusCode == http.StatusNotFound || e.StatusCode == http.StatusGone)
+}
+
+/* checkBackfillDate() returns why the date of p interpreted from the
+ * ionogram of time t is implausible, empty if it is within step of t.
+ */
+func checkBackfillDate(p Parameters, t time.Time, step time.Duration) (string) {
+  if d := p.Date.Sub(t); d > step || d < -step {
+    return fmt.Sprintf("Date %s read from the ionogram is more than %s from %s", p.Date.Format(SqliteDateFormat),
+                       step, t.Format(SqliteDateFormat))
+  }
+  return ""
+}
+
+/* backfillParameters() fetches the parameters of ionosonde i at t (for the
+ * step or chunk from t to until). The error is a download error, failures
+ * to interpret are returned as failed.
+ */
+func backfillParameters(i Ionosonde, t, until time.Time) (parameters []Parameters, failed error, err error) {
+  url := historyUrl(i, t)
+  if i.sourceType() == sourceDidbase {
+    url = dataUrls(i, t, until)[0]
+  }
+  if i.sourceType() != sourceImage {
+    data, _, err := downloadData(url)
+    if err != nil {
+      return nil, nil, err
+    }
+    parameters, failed = scaledParameters(i, data)
+    return parameters, failed, nil
+  }
+  d, err := downloadFile(url, i.UrsiCode)
+  if err != nil {
+    return nil, nil, err
+  }
+  defer os.Remove(d.File)
+  img, failed := loadImage(d.File)
+  if failed != nil {
+    return nil, failed, nil
+  }
+  p, failed := interpretIonogram(i, img, t)
+  if failed != nil {
+    return nil, failed, nil
+  }
+  return []Parameters{ p }, nil, nil
+}
+
+func cmdBackfill(args []string) int {
+  fs := flag.NewFlagSet("backfill", flag.ContinueOnError)
+  ursi := fs.String("ursi", "", "URSI code of the ionosonde to backfill (required)")
+  fromArg := fs.String("from", "", "backfill from this time (required)")
+  toArg := fs.String("to", "", "backfill until this time (default now, or the -to of an unfinished backfill from -from)")
+  step := fs.Duration("step", defaultBackfillStep, "time between ionograms in historyUrl")
+  chunk := fs.Duration("chunk", defaultBackfillChunk, "time range of each DIDBase query")
+  delay := fs.Duration("delay", time.Second, "wait this long between downloads")
+  restart := fs.Bool("restart", false, "start over instead of resuming a previous backfill")
+  if err := fs.Parse(args); err != nil {
+    return 2
+  }
+  if *ursi == "" || *fromArg == "" {
+    fmt.Fprintf(os.Stderr, "-ursi and -from are required\n")
+    fs.Usage()
+    return 2
+  }
+  from, err := parseApiTime(*fromArg)
+  if err != nil {
+    fmt.Fprintf(os.Stderr, "Invalid -from: %v\n", err)
+    return 2
+  }
+  var to time.Time
+  if *toArg != "" {
+    if to, err = parseApiTime(*toArg); err != nil {
+      fmt.Fprintf(os.Stderr, "Invalid -to: %v\n", err)
+      return 2
+    }
+    if ! from.Before(to) {
+      fmt.Fprintf(os.Stderr, "-to must be after -from\n")
+      return 2
+    }
+  }
+  if *step <= 0 || *chunk <= 0 || *delay < 0 {
+    fmt.Fprintf(os.Stderr, "-step and -chunk must be positive and -delay can not be negative\n")
+    return 2
+  }
+
+  openDatabase()
+  defer db.Close()
+
+  i, err := getIonosondeByUrsi(*ursi)
+  if err != nil {
+    fmt.Fprintf(os.Stderr, "%v\n", err)
+    return 1
+  }
+  interval := *step
+  if i.sourceType() == sourceDidbase {
+    interval = *chunk
+  } else if ! i.HistoryUrl.Valid || strings.TrimSpace(i.HistoryUrl.String) == "" {
+    fmt.Fprintf(os.Stderr, "Ionosonde %s has no historyUrl, set one with ionoreporter ionosonde edit %s -historyurl URL\n",
+                i.UrsiCode, i.UrsiCode)
+    return 1
+  }
+  if to.IsZero() {
+    // resume an unfinished backfill started without -to
+    var unfinished sql.NullTime
+    err := db.QueryRow("select toDt from backfills where ionosondeId=? and fromDt=? and finished is null " +
+                       "order by toDt desc limit 1", i.IonosondeId, from.Format(SqliteDateFormat)).Scan(&unfinished)
+    if err != nil && err != sql.ErrNoRows {
+      fmt.Fprintf(os.Stderr, "Unable to query backfills: %v\n", err)
+      return 1
+    }
+    to = time.Now().UTC().Truncate(time.Minute)
+    if unfinished.Valid && ! *restart {
+      to = unfinished.Time.UTC()
+    }
+    if ! from.Before(to) {
+      fmt.Fprintf(os.Stderr, "-from must be in the past\n")
+      return 2
+    }
+  }
+  b, err := getBackfill(i, from, to, *restart)
+  if err != nil {
+    fmt.Fprintf(os.Stderr, "Unable to read or create backfill: %v\n", err)
+    return 1
+  }
+  if b.Finished.Valid {
+    fmt.Printf("Backfill of %s from %s to %s is already done (%d inserted), use -restart to run it again\n",
+               i.UrsiCode, from.Format(SqliteDateFormat), to.Format(SqliteDateFormat), b.Inserted)
+    return 0
+  }
+  t := from
+  if b.DoneUntil.Valid {
+    t = b.DoneUntil.Time.UTC()
+    fmt.Printf("Resuming backfill of %s from %s\n", i.UrsiCode, t.Format(SqliteDateFormat))
+  }
+
+  for ; t.Before(to); t = t.Add(interval) {
+    until := t.Add(interval)
+    if until.After(to) {
+      until = to
+    }
+    label := fmt.Sprintf("%s %s", i.UrsiCode, t.Format(SqliteDateFormat))
+    parameters, failed, err := backfillParameters(i, t, until)
+    switch {
+      case err != nil && isNotFound(err):
+        b.Missing++
+      case err != nil:
+        fmt.Printf("%s: ERROR %v\n", label, err)
+        b.Failed++
+      case failed != nil:
+        fmt.Printf("%s: ERROR %v\n", label, failed)
+        b.Failed++
+    }
+    inserted := 0
+    for n := range parameters {
+      p := parameters[n]
+      // scaled data may contain records outside the range
+      if p.Date.Before(from) || p.Date.After(to) {
+        continue
+      }
+      if i.sourceType() == sourceImage {
+        if reason := checkBackfillDate(p, t, interval); reason != "" {
+          fmt.Printf("%s: ERROR %s\n", label, reason)
+          b.Failed++
+          continue
+        }
+      }
+      status, _, err := insertParameters(i, &p)
+      if err != nil {
+        fmt.Printf("%s: ERROR %v\n", label, err)
+      }
+      b.count(status)
+      if status == scrapeInserted {
+        inserted++
+      }
+    }
+    if inserted > 0 {
+      fmt.Printf("%s: %d inserted\n", label, inserted)
+    }
+    if err := b.saveProgress(until); err != nil {
+      fmt.Fprintf(os.Stderr, "Unable to save backfill progress: %v\n", err)
+      return 1
+    }
+    if *delay > 0 && until.Before(to) {
+      time.Sleep(*delay)
+    }
+  }
+  fmt.Printf("Backfilled %s from %s to %s: %d inserted, %d duplicates, %d missing, %d failed\n",
+             i.UrsiCode, from.Format(SqliteDateFormat), to.Format(SqliteDateFormat), b.Inserted,
+             b.Duplicates, b.Missing, b.Failed)
+  if b.Failed > 0 {
+    return 1
+  }
+  return 0
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+  "net/http"
+  "net/http/httptest"
+  "path/filepath"
+  "testing"
+  "time"
+)
+
+func TestCheckBackfillDate(t *testing.T) {
+  step := time.Date(2021, time.March, 20, 11, 0, 0, 0, time.UTC)
+  cases := []struct {
+    date time.Duration  // after the step
+    ok bool
+  }{
+    { 0, true },
+    { 4 * time.Minute, true },
+    { -15 * time.Minute, true },
+    { 15 * time.Minute, true },
+    { 16 * time.Minute, false },
+    { -16 * time.Minute, false },
+    // the day read wrong
+    { 24 * time.Hour, false },
+  }
+  for _, c := range cases {
+    reason := checkBackfillDate(Parameters{ Date: step.Add(c.date) }, step, 15 * time.Minute)
+    if (reason == "") != c.ok {
+      t.Errorf("checkBackfillDate %s after the step = %q, want ok %t", c.date, reason, c.ok)
+    }
+  }
+}
+
+/* TestBackfillDownloadError backfills SAO files from a local server that
+ * fails the first step, the backfill carries on with the next one.
+ */
+func TestBackfillDownloadError(t *testing.T) {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    switch r.URL.Path {
+      case "/JR055_1045.SAO":
+        http.Error(w, "unavailable", http.StatusInternalServerError)
+      case "/JR055_1100.SAO":
+        http.ServeFile(w, r, filepath.Join("..", "..", "irsao", "testdata", "JR055.SAO"))
+      default:
+        http.NotFound(w, r)
+    }
+  }))
+  defer server.Close()
+
+  saved := *cnf
+  defer func() { *cnf = saved }()
+  cnf.DatabaseFile = filepath.Join(t.TempDir(), "ionoreporter.db")
+  cnf.ArchiveDir = ""
+  openDatabase()
+  _, err := db.Exec("update ionosondes set sourceType=?, historyUrl=? where ursiCode=?",
+                    sourceSAO, server.URL + "/{ursi}_{hour}{minute}.SAO", "JR055")
+  db.Close()
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  // 10:45 fails, 11:00 is inserted and 11:15 is missing
+  args := []string{ "-ursi", "JR055", "-from", "2021-03-20T10:45:00Z", "-to", "2021-03-20T11:30:00Z", "-delay", "0" }
+  if code := cmdBackfill(args); code != 1 {
+    t.Errorf("backfill with a failed step exited %d, want 1", code)
+  }
+  openDatabase()
+  defer db.Close()
+  i, err := getIonosondeByUrsi("JR055")
+  if err != nil {
+    t.Fatal(err)
+  }
+  b, err := getBackfill(i, time.Date(2021, time.March, 20, 10, 45, 0, 0, time.UTC),
+                        time.Date(2021, time.March, 20, 11, 30, 0, 0, time.UTC), false)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if ! b.Finished.Valid || b.Inserted != 1 || b.Failed != 1 || b.Missing != 1 {
+    t.Errorf("backfill %+v, want finished with 1 inserted, 1 failed and 1 missing", b)
+  }
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+  "bytes"
+  "flag"
+  "fmt"
+  "os"
+  "io/ioutil"
+  "path/filepath"
+  "image"
+  "image/color"
+  "image/draw"
+  "image/png"
+  "strings"
+  "time"
+  "unicode"
+  "database/sql"
+
+  log "github.com/sirupsen/logrus"
+
+  "github.com/sa6mwa/ionoreporter/irtrace"
+)
+
+/* The calibrate command helps getting the crop boxes right. It downloads
+ * (or loads a local) ionogram, applies the filter of the ionosonde and draws
+ * every configured crop rectangle labelled with the parameter name and the
+ * text OCR produced, and the digitized trace (see trace.go) if configured.
+ * With an anchorCrop the located crops (see locate.go) are drawn.
+ * The annotated image is written as PNG and a summary is
+ * printed to stdout and written next to it (same name, .txt extension).
+ */
+
+// namedCrop is a crop box of an ionosonde and the name of what it contains
+type namedCrop struct {
+  Name string
+  Crop string
+}
+
+/* ionosondeCrops() returns all crops of an ionosonde, the date first */
+func ionosondeCrops(i Ionosonde) ([]namedCrop) {
+  crops := []namedCrop{ { "date", i.DateCrop } }
+  for _, c := range []struct{ name string; crop sql.NullString }{
+    { "foF2", i.Fof2Crop }, { "foF1", i.Fof1Crop }, { "foE", i.FoeCrop },
+    { "fxI", i.FxiCrop }, { "foEs", i.FoesCrop }, { "fmin", i.FminCrop },
+    { "hmF2", i.Hmf2Crop }, { "hmE", i.HmeCrop },
+  } {
+    if c.crop.Valid {
+      crops = append(crops, namedCrop{ c.name, c.crop.String })
+    }
+  }
+  return crops
+}
+
+/* loadImage() opens and decodes an image file */
+func loadImage(file string) (image.Image, error) {
+  reader, err := os.Open(file)
+  if err != nil {
+    return nil, err
+  }
+  defer reader.Close()
+  img, _, err := image.Decode(reader)
+  return img, err
+}
+
+/* downloadIonogram() downloads the ionogram of an ionosonde trying each
+ * URL in order, returns the file name and the URL it was downloaded from.
+ * The caller must remove the file.
+ */
+func downloadIonogram(i Ionosonde) (string, string, error) {
+  var err error
+  var d download
+  for _, url := range strings.Split(i.ImageUrl, `,`) {
+    d, err = downloadFile(strings.TrimSpace(url), i.UrsiCode)
+    if err == nil {
+      return d.File, url, nil
+    }
+  }
+  return "", "", err
+}
+
+var (
+  calibrateBoxColor = color.RGBA{ 255, 0, 0, 255 }
+  calibrateLabelColor = color.RGBA{ 255, 255, 255, 255 }
+  calibrateLabelBackground = color.RGBA{ 200, 0, 0, 255 }
+  calibrateTraceColor = color.RGBA{ 255, 255, 0, 255 }
+  calibrateAnchorColor = color.RGBA{ 0, 128, 255, 255 }
+)
+
+func cmdCalibrate(args []string) int {
+  fs := flag.NewFlagSet("calibrate", flag.ContinueOnError)
+  ursi := fs.String("ursi", "", "URSI code of the ionosonde to calibrate (required)")
+  imageFile := fs.String("image", "", "use this local ionogram instead of downloading it")
+  output := fs.String("o", "", "annotated PNG output file (default URSI-calibrate.png), the summary is also written next to it with .txt extension")
+  if err := fs.Parse(args); err != nil {
+    return 2
+  }
+  if *ursi == "" {
+    fmt.Fprintf(os.Stderr, "-ursi is required\n")
+    fs.Usage()
+    return 2
+  }
+  openDatabase()
+  defer db.Close()
+  i, err := getIonosondeByUrsi(*ursi)
+  if err != nil {
+    fmt.Fprintf(os.Stderr, "%v\n", err)
+    return 1
+  }
+  if *output == "" {
+    *output = i.UrsiCode + "-calibrate.png"
+  }
+  source := *imageFile
+  // a local image can be of any age, only check the date of downloaded ones
+  var downloaded time.Time
+  if source == "" {
+    imgFile, url, err := downloadIonogram(i)
+    if err != nil {
+      fmt.Fprintf(os.Stderr, "Unable to download ionogram of %s: %v\n", i.UrsiCode, err)
+      return 1
+    }
+    defer os.Remove(imgFile)
+    source = imgFile
+    downloaded = time.Now()
+    log.Infof("Downloaded %s ionogram from %s", i.UrsiCode, url)
+  }
+  img, err := loadImage(source)
+  if err != nil {
+    fmt.Fprintf(os.Stderr, "Cannot decode ionogram %s: %v\n", source, err)
+    return 1
+  }
+  // the traces are digitized in the original colors
+  orig := img
+  if i.Filter.Valid {
+    if img, err = applyFilter(img, i.Filter.String, i.UrsiCode); err != nil {
+      fmt.Fprintf(os.Stderr, "%v\n", err)
+      return 1
+    }
+  }
+  engine, err := ocrForIonosonde(i)
+  if err != nil {
+    fmt.Fprintf(os.Stderr, "%v\n", err)
+    return 1
+  }
+
+  out := image.NewRGBA(img.Bounds())
+  draw.Draw(out, out.Bounds(), img, img.Bounds().Min, draw.Src)
+  summary := new(bytes.Buffer)
+  fmt.Fprintf(summary, "Calibration of %s (%s), filter %s, dateFormat %s, OCR engine %s\n", i.UrsiCode, i.Name,
+             formatNullString(i.Filter), i.DateFormat, ocrEngineName(i))
+  failed := false
+  if area, ok, _ := parseCrop(i.AnchorCrop.String); ok {
+    located, names, err := locateCrops(i, engine, img, downloaded)
+    if err != nil {
+      fmt.Fprintf(summary, "%-5s %-15s ERROR %v\n", "anchor", i.AnchorCrop.String, err)
+      failed = true
+    } else if len(names) == 0 {
+      fmt.Fprintf(summary, "%-5s %-15s no labels found, using the stored crops\n", "anchor", i.AnchorCrop.String)
+    } else {
+      fmt.Fprintf(summary, "%-5s %-15s located %s\n", "anchor", i.AnchorCrop.String, strings.Join(names, ", "))
+      i = located
+    }
+    drawRect(out, area, calibrateAnchorColor)
+    drawLabel(out, area.Min.X, area.Max.Y + 2, "anchor", calibrateLabelColor, calibrateLabelBackground)
+  }
+  for _, c := range ionosondeCrops(i) {
+    r, ok, err := parseCrop(c.Crop)
+    if err != nil {
+      fmt.Fprintf(summary, "%-5s %-15s ERROR %v\n", c.Name, c.Crop, err)
+      failed = true
+      continue
+    }
+    if ! ok {
+      fmt.Fprintf(summary, "%-5s %-15s not available\n", c.Name, c.Crop)
+      continue
+    }
+    opts, err := ocrOptions(i, c.Name)
+    if err != nil {
+      fmt.Fprintf(os.Stderr, "%v\n", err)
+      return 1
+    }
+    text, conf, err := getTextFromCut(engine, opts, img, c.Crop)
+    if err != nil {
+      fmt.Fprintf(summary, "%-5s %-15s ERROR %v\n", c.Name, c.Crop, err)
+      failed = true
+    }
+    text = strings.Join(strings.Fields(text), " ")
+    result := ""
+    if c.Name == "date" {
+      t, err := recognizeDate(i, text, downloaded)
+      if err != nil {
+        result = fmt.Sprintf("(unable to recognize %q as %s)", text, i.DateFormat)
+      } else {
+        result = "= " + t.Format(time.RFC3339)
+      }
+    } else {
+      v, _, err := getTextFromCutFloat64(engine, opts, img, c.Crop)
+      if err != nil {
+        result = "(not a number)"
+      } else {
+        result = fmt.Sprintf("= %g", v)
+      }
+    }
+    fmt.Fprintf(summary, "%-5s %-15s %q %s (confidence %.0f)\n", c.Name, c.Crop, text, result, conf)
+    drawRect(out, r, calibrateBoxColor)
+    drawLabel(out, r.Max.X + 2, r.Min.Y, c.Name + ": " + text, calibrateLabelColor, calibrateLabelBackground)
+  }
+  if c, ok, err := traceCalibration(i); err != nil {
+    fmt.Fprintf(summary, "%-5s %-15s ERROR %v\n", "trace", formatNullString(i.TraceCrop), err)
+    failed = true
+  } else if ok {
+    res := irtrace.Digitize(orig, c)
+    var values []string
+    for _, name := range []string{ irtrace.Fmin, irtrace.FoE, irtrace.HF, irtrace.FoF2 } {
+      if v, found := res.Values[name]; found {
+        values = append(values, fmt.Sprintf("%s %.2f", name, v))
+      } else {
+        values = append(values, name + " not found")
+      }
+    }
+    fmt.Fprintf(summary, "%-5s %-15s %d echo columns: %s\n", "trace", i.TraceCrop.String, len(res.Trace),
+                strings.Join(values, ", "))
+    drawRect(out, c.Area, calibrateTraceColor)
+    for _, p := range res.Trace {
+      out.Set(p.Pixel.X, p.Pixel.Y, calibrateTraceColor)
+      out.Set(p.Pixel.X, p.Pixel.Y - 1, calibrateTraceColor)
+    }
+    drawLabel(out, c.Area.Min.X, c.Area.Min.Y, "trace", calibrateLabelColor, calibrateLabelBackground)
+  }
+  f, err := os.Create(*output)
+  if err != nil {
+    fmt.Fprintf(os.Stderr, "Cannot create %s: %v\n", *output, err)
+    return 1
+  }
+  defer f.Close()
+  if err := png.Encode(f, out); err != nil {
+    fmt.Fprintf(os.Stderr, "Cannot encode %s: %v\n", *output, err)
+    return 1
+  }
+  fmt.Print(summary.String())
+  summaryFile := strings.TrimSuffix(*output, filepath.Ext(*output)) + ".txt"
+  if err := ioutil.WriteFile(summaryFile, summary.Bytes(), 0644); err != nil {
+    fmt.Fprintf(os.Stderr, "Cannot write %s: %v\n", summaryFile, err)
+    return 1
+  }
+  fmt.Printf("Wrote annotated ionogram to %s and summary to %s\n", *output, summaryFile)
+  if failed {
+    return 1
+  }
+  return 0
+}
+
+/* drawRect() draws a 1 pixel rectangle just outside r */
+func drawRect(img draw.Image, r image.Rectangle, c color.Color) {
+  r = r.Inset(-1)
+  for x := r.Min.X; x < r.Max.X; x++ {
+    img.Set(x, r.Min.Y, c)
+    img.Set(x, r.Max.Y - 1, c)
+  }
+  for y := r.Min.Y; y < r.Max.Y; y++ {
+    img.Set(r.Min.X, y, c)
+    img.Set(r.Max.X - 1, y, c)
+  }
+}
+
+/* A 3x5 pixel font for labels, lower case letters are drawn as upper case
+ * and unknown characters as ?.
+ */
+const (
+  glyphWidth = 3
+  glyphHeight = 5
+  glyphScale = 2
+)
+
+var glyphs = map[rune][glyphHeight]string{
+  '0': { "###", "#.#", "#.#", "#.#", "###" },
+  '1': { ".#.", "##.", ".#.", ".#.", "###" },
+  '2': { "###", "..#", "###", "#..", "###" },
+  '3': { "###", "..#", ".##", "..#", "###" },
+  '4': { "#.#", "#.#", "###", "..#", "..#" },
+  '5': { "###", "#..", "###", "..#", "###" },
+  '6': { "###", "#..", "###", "#.#", "###" },
+  '7': { "###", "..#", ".#.", ".#.", ".#." },
+  '8': { "###", "#.#", "###", "#.#", "###" },
+  '9': { "###", "#.#", "###", "..#", "###" },
+  'A': { ".#.", "#.#", "###", "#.#", "#.#" },
+  'B': { "##.", "#.#", "##.", "#.#", "##." },
+  'C': { ".##", "#..", "#..", "#..", ".##" },
+  'D': { "##.", "#.#", "#.#", "#.#", "##." },
+  'E': { "###", "#..", "##.", "#..", "###" },
+  'F': { "###", "#..", "##.", "#..", "#.." },
+  'G': { ".##", "#..", "#.#", "#.#", ".##" },
+  'H': { "#.#", "#.#", "###", "#.#", "#.#" },
+  'I': { "###", ".#.", ".#.", ".#.", "###" },
+  'J': { "..#", "..#", "..#", "#.#", ".#." },
+  'K': { "#.#", "#.#", "##.", "#.#", "#.#" },
+  'L': { "#..", "#..", "#..", "#..", "###" },
+  'M': { "#.#", "###", "###", "#.#", "#.#" },
+  'N': { "##.", "#.#", "#.#", "#.#", "#.#" },
+  'O': { ".#.", "#.#", "#.#", "#.#", ".#." },
+  'P': { "##.", "#.#", "##.", "#..", "#.." },
+  'Q': { ".#.", "#.#", "#.#", "##.", ".##" },
+  'R': { "##.", "#.#", "##.", "#.#", "#.#" },
+  'S': { ".##", "#..", ".#.", "..#", "##." },
+  'T': { "###", ".#.", ".#.", ".#.", ".#." },
+  'U': { "#.#", "#.#", "#.#", "#.#", "###" },
+  'V': { "#.#", "#.#", "#.#", "#.#", ".#." },
+  'W': { "#.#", "#.#", "###", "###", "#.#" },
+  'X': { "#.#", "#.#", ".#.", "#.#", "#.#" },
+  'Y': { "#.#", "#.#", ".#.", ".#.", ".#." },
+  'Z': { "###", "..#", ".#.", "#..", "###" },
+  ' ': { "...", "...", "...", "...", "..." },
+  '.': { "...", "...", "...", "...", ".#." },
+  ',': { "...", "...", "...", ".#.", "#.." },
+  ':': { "...", ".#.", "...", ".#.", "..." },
+  '-': { "...", "...", "###", "...", "..." },
+  '+': { "...", ".#.", "###", ".#.", "..." },
+  '/': { "..#", "..#", ".#.", "#..", "#.." },
+  '(': { ".#.", "#..", "#..", "#..", ".#." },
+  ')': { ".#.", "..#", "..#", "..#", ".#." },
+  '@': { "###", "#.#", "###", "#..", ".##" },
+  '?': { "###", "..#", ".##", "...", ".#." },
+}
+
+/* drawLabel() draws text with a background box, x,y is the top left corner */
+func drawLabel(img draw.Image, x, y int, text string, fg, bg color.Color) {
+  advance := (glyphWidth + 1) * glyphScale
+  runes := []rune(text)
+  box := image.Rect(x, y, x + len(runes) * advance + glyphScale, y + (glyphHeight + 2) * glyphScale)
+  draw.Draw(img, box, &image.Uniform{ bg }, image.Point{}, draw.Src)
+  for n, r := range runes {
+    g, ok := glyphs[unicode.ToUpper(r)]
+    if ! ok {
+      g = glyphs['?']
+    }
+    ox := x + glyphScale + n * advance
+    oy := y + glyphScale
+    for gy := 0; gy < glyphHeight; gy++ {
+      for gx := 0; gx < glyphWidth; gx++ {
+        if g[gy][gx] != '#' {
+          continue
+        }
+        dot := image.Rect(ox + gx * glyphScale, oy + gy * glyphScale,
+                          ox + (gx + 1) * glyphScale, oy + (gy + 1) * glyphScale)
+        draw.Draw(img, dot, &image.Uniform{ fg }, image.Point{}, draw.Src)
+      }
+    }
+  }
+}
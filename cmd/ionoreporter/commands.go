@@ -0,0 +1,134 @@
+package main
+
+import (
+  "flag"
+  "fmt"
+  "os"
+
+  "github.com/sa6mwa/ionoreporter/ionizedb"
+)
+
+/* Without arguments ionoreporter runs as a daemon (see main()), with
+ * arguments it runs one of the commands below and exits. Commands are
+ * configured with the same environment variables as the daemon (e.g DBFILE).
+ */
+
+const usageText string = `Usage: ionoreporter [command [options]]
+
+Without command ionoreporter runs as a daemon scraping ionograms and pushing
+reports according to configuration in environment variables.
+
+Commands:
+  migrate [-dry-run]  apply pending database schema migrations
+  ionosonde ...       list, show, add, edit, enable, disable or remove
+                      ionosondes (see ionoreporter ionosonde -h)
+  layout ...          list, show, add, edit or remove crop layouts shared
+                      by ionosondes (see ionoreporter layout -h)
+  scrape [-ursi URSI] scrape ionograms once (all with scrape=1 or only URSI)
+  report daily|frequent [-stdout]
+                      make reports once and log them (or print with -stdout)
+  push daily|frequent make reports once and push them to Discord and/or Slack
+  calibrate -ursi URSI [-image file] [-o out.png]
+                      draw crop boxes and OCR results onto an ionogram
+  train -ursi URSI -text text [-crop date] [-image file] [-dir templates]
+                      save glyphs of a crop as templates for the template
+                      OCR engine
+  ocrbench -fixtures dir [-ursi URSI] [-preprocess pipeline ...]
+                      measure OCR accuracy of crop preprocessing pipelines
+                      against labelled crops
+  reprocess -ursi URSI [-from time] [-to time] [-update]
+                      interpret archived ionograms again with the current
+                      settings, print differences or update parameters
+  backfill -ursi URSI -from time [-to time] [-step 15m] [-restart]
+                      populate parameters with history from historyUrl
+                      or DIDBase, resumes an interrupted backfill
+  help                show this help
+`
+
+func usage() {
+  fmt.Fprint(os.Stderr, usageText)
+}
+
+/* runCommand() runs the command in args[0] and returns the exit status */
+func runCommand(args []string) int {
+  switch args[0] {
+    case "migrate":
+      return cmdMigrate(args[1:])
+    case "ionosonde":
+      return cmdIonosonde(args[1:])
+    case "layout":
+      return cmdLayout(args[1:])
+    case "scrape":
+      return cmdScrape(args[1:])
+    case "report":
+      return cmdReport(args[1:])
+    case "push":
+      return cmdPush(args[1:])
+    case "calibrate":
+      return cmdCalibrate(args[1:])
+    case "train":
+      return cmdTrain(args[1:])
+    case "ocrbench":
+      return cmdOcrBench(args[1:])
+    case "reprocess":
+      return cmdReprocess(args[1:])
+    case "backfill":
+      return cmdBackfill(args[1:])
+    case "help", "-h", "-help", "--help":
+      usage()
+      return 0
+  }
+  fmt.Fprintf(os.Stderr, "Unknown command %s\n\n", args[0])
+  usage()
+  return 2
+}
+
+/* cmdMigrate applies pending schema migrations, with -dry-run it only prints
+ * the migrations that would be applied.
+ */
+func cmdMigrate(args []string) int {
+  fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+  dryRun := fs.Bool("dry-run", false, "print pending migrations without applying them")
+  if err := fs.Parse(args); err != nil {
+    return 2
+  }
+  if *dryRun {
+    pending := ionizedb.Migrations
+    if _, err := os.Stat(cnf.DatabaseFile); err == nil {
+      db = openDB(cnf.DatabaseFile)
+      defer db.Close()
+      version, err := ionizedb.Version(db)
+      if err != nil {
+        fmt.Fprintf(os.Stderr, "Unable to read schema version of %s: %v\n", cnf.DatabaseFile, err)
+        return 1
+      }
+      fmt.Printf("Database %s is at schema version %d\n", cnf.DatabaseFile, version)
+      pending, err = ionizedb.Migrate(db, true)
+      if err != nil {
+        fmt.Fprintf(os.Stderr, "%v\n", err)
+        return 1
+      }
+    } else if os.IsNotExist(err) {
+      fmt.Printf("Database %s does not exist and would be created\n", cnf.DatabaseFile)
+    } else {
+      fmt.Fprintf(os.Stderr, "Cannot stat db file %s: %v\n", cnf.DatabaseFile, err)
+      return 1
+    }
+    if len(pending) == 0 {
+      fmt.Printf("Schema is up to date, nothing to do\n")
+    }
+    for _, m := range pending {
+      fmt.Printf("Would apply migration %d: %s\n", m.Version, m.Description)
+    }
+    return 0
+  }
+  openDatabase()
+  defer db.Close()
+  version, err := ionizedb.Version(db)
+  if err != nil {
+    fmt.Fprintf(os.Stderr, "Unable to read schema version of %s: %v\n", cnf.DatabaseFile, err)
+    return 1
+  }
+  fmt.Printf("Database %s is at schema version %d\n", cnf.DatabaseFile, version)
+  return 0
+}
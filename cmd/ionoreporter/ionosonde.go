@@ -0,0 +1,665 @@
+package main
+
+import (
+  "flag"
+  "fmt"
+  "os"
+  "strconv"
+  "strings"
+  "text/tabwriter"
+  "time"
+  "database/sql"
+
+  "github.com/sa6mwa/ionoreporter/irdate"
+  "github.com/sa6mwa/ionoreporter/irfilter"
+  "github.com/sa6mwa/ionoreporter/irtrace"
+)
+
+/* The ionosonde command manages the ionosondes table, i.e. the same columns
+ * getIonosondesFromDb() reads, without having to use sqlite3 directly.
+ */
+
+const ionosondeUsageText string = `Usage: ionoreporter ionosonde <subcommand> [URSI] [options]
+
+Subcommands:
+  list                      list all ionosondes
+  show URSI                 show all settings of an ionosonde
+  add -ursi URSI [options]  add an ionosonde (see options below)
+  edit URSI [options]       change settings of an ionosonde
+  enable URSI               include ionosonde in reports
+  disable URSI              exclude ionosonde from reports
+  scrape-on URSI            scrape ionograms from ionosonde
+  scrape-off URSI           stop scraping ionograms from ionosonde
+  remove URSI [-purge]      remove ionosonde, -purge also removes its parameters,
+                            archived images (requires ARCHIVE_DIR), rejections and
+                            backfills
+
+Crops are x,y,width,height (as shown by the Gimp Rectangle Select tool), NA
+means the parameter is not available in the ionogram. dateFormat is a Go time
+layout, e.g "2006 Jan02 002 150405". Filter, dateformat and crops left empty
+are taken from the -layout of the ionosonde (see ionoreporter layout -h), use
+-filter none to not apply the filter of the layout.
+
+Options for add and edit:
+`
+
+type ionosondeColumnKind int
+
+const (
+  colText ionosondeColumnKind = iota  // not null text
+  colNullText                         // text, empty is null
+  colFloat                            // float
+  colDateFormat                       // Go time layout, empty is null (the layout's)
+  colCrop                             // crop box, empty is null (the layout's), not NA
+  colNullCrop                         // crop box, empty is null
+  colBool                             // boolean
+  colOcrEngine                        // OCR engine name, empty is null
+  colOcrPsm                           // page segmentation mode, empty is null
+  colOcrScale                         // OCR scale factor, empty is null
+  colOcrFieldOptions                  // per-field OCR options, empty is null
+  colOcrMinConfidence                 // OCR confidence 0-100, empty is null
+  colSourceType                       // image, sao or saoxml, empty is null (image)
+  colTraceAxis                        // trace axis calibration, empty is null
+  colTraceColors                      // trace colors, empty is null
+  colLayout                           // layout name stored as layoutId, empty is null
+  colFilter                           // filter pipeline, empty is null
+  colOcrPreprocess                    // crop filter pipeline, empty is null
+)
+
+type ionosondeColumn struct {
+  flag string
+  column string
+  kind ionosondeColumnKind
+  help string
+}
+
+// nullable returns true if an empty value is stored as null
+func (k ionosondeColumnKind) nullable() (bool) {
+  switch k {
+    case colText, colFloat, colBool:
+      return false
+  }
+  return true
+}
+
+/* ionosondeColumns maps command line options to columns in the ionosondes
+ * table, add new columns here to make them editable.
+ */
+var ionosondeColumns = []ionosondeColumn{
+  { "name", "name", colText, "name of the ionosonde, e.g Juliusruh" },
+  { "lat", "latitude", colFloat, "latitude in decimal degrees" },
+  { "lon", "longitude", colFloat, "longitude in decimal degrees (east)" },
+  { "url", "imageUrl", colText, "comma separated list of ionogram URLs, tried in order" },
+  { "sourcetype", "sourceType", colSourceType, "where parameters come from: image (OCR of url, the default), sao or saoxml (dataurl) or didbase" },
+  { "dataurl", "dataUrl", colNullText, "comma separated list of SAO or SAO-XML URLs (or DIDBase services), tried in order" },
+  { "historyurl", "historyUrl", colNullText, "URL template of historical ionograms or data files for backfill, e.g with {year}, {doy}, {hour}" },
+  { "layout", "layoutId", colLayout, "name of a layout (see ionoreporter layout) providing filter, dateformat and crops not set here" },
+  { "filter", "filter", colFilter, "image filter pipeline, e.g invert|grayscale|brightness:-40|contrast:80 or invertAndBlackAndWhite, none for no filter" },
+  { "dateformat", "dateFormat", colDateFormat, "Go time layout of the date in the ionogram" },
+  { "datecrop", "dateCrop", colCrop, "crop of the date" },
+  { "fof2crop", "fof2Crop", colNullCrop, "crop of foF2" },
+  { "fof1crop", "fof1Crop", colNullCrop, "crop of foF1" },
+  { "foecrop", "foeCrop", colNullCrop, "crop of foE" },
+  { "fxicrop", "fxiCrop", colNullCrop, "crop of fxI" },
+  { "foescrop", "foesCrop", colNullCrop, "crop of foEs" },
+  { "fmincrop", "fminCrop", colNullCrop, "crop of fmin" },
+  { "hmf2crop", "hmf2Crop", colNullCrop, "crop of hmF2" },
+  { "hmecrop", "hmeCrop", colNullCrop, "crop of hmE" },
+  { "anchorcrop", "anchorCrop", colNullCrop, "header region with the parameter labels, enables locating the crops from the labels" },
+  { "scrape", "scrape", colBool, "scrape ionograms from this ionosonde (true/false)" },
+  { "enabled", "enabled", colBool, "include ionosonde in reports (true/false)" },
+  { "ocrengine", "ocrEngine", colOcrEngine, "OCR engine (tesseract or template), empty to use OCR_ENGINE" },
+  { "ocrlang", "ocrLanguage", colNullText, "tesseract language, e.g eng" },
+  { "ocrpsm", "ocrPsm", colOcrPsm, "tesseract page segmentation mode, e.g 7 (single line)" },
+  { "ocrscale", "ocrScale", colOcrScale, "scale crops by this factor before OCR, e.g 3" },
+  { "ocrnumericwhitelist", "ocrNumericWhitelist", colNullText, "characters allowed in numeric fields, auto is 0123456789." },
+  { "ocrdatewhitelist", "ocrDateWhitelist", colNullText, "characters allowed in the date, auto derives them from dateformat" },
+  { "ocrfieldoptions", "ocrFieldOptions", colOcrFieldOptions, "per-field OCR options, e.g \"date:psm=7,scale=2;foF2:whitelist=0123456789.\"" },
+  { "ocrminconfidence", "ocrMinConfidence", colOcrMinConfidence, "discard values read with lower OCR confidence (0-100)" },
+  { "ocrpreprocess", "ocrPreprocess", colOcrPreprocess, "filter pipeline applied to every crop before OCR, e.g upscale:4:cubic|otsu|pad:10" },
+  { "tracecrop", "traceCrop", colNullCrop, "plot area of the ionogram, enables digitizing the traces for missing values" },
+  { "tracefreqaxis", "traceFreqAxis", colTraceAxis, "frequency axis as x=MHz,x=MHz[,log], e.g 100=1,580=10,log" },
+  { "traceheightaxis", "traceHeightAxis", colTraceAxis, "height axis as y=km,y=km, e.g 400=100,40=700" },
+  { "tracecolors", "traceColors", colTraceColors, "trace colors, e.g o=#ff0000,x=#00ff00,tolerance=80" },
+}
+
+/* validateDateFormat() checks that layout is a Go time layout containing at
+ * least year, month, day (or day of year), hour and minute.
+ */
+func validateDateFormat(layout string) (error) {
+  if strings.TrimSpace(layout) == "" {
+    return fmt.Errorf("dateFormat is empty")
+  }
+  ref := time.Date(2021, time.March, 14, 15, 9, 26, 0, time.UTC)
+  t, err := time.Parse(layout, ref.Format(layout))
+  if err != nil {
+    return fmt.Errorf("dateFormat %s is not a valid Go time layout: %v", layout, err)
+  }
+  if t.Year() != ref.Year() || t.YearDay() != ref.YearDay() || t.Hour() != ref.Hour() || t.Minute() != ref.Minute() {
+    return fmt.Errorf("dateFormat %s must contain year, month and day (or day of year), hour and minute, e.g 2006 Jan02 002 150405", layout)
+  }
+  // the date recognizer does not support time zones and fractional seconds
+  if _, err := irdate.New(layout, 0); err != nil {
+    return fmt.Errorf("dateFormat %s: %v", layout, err)
+  }
+  return nil
+}
+
+/* validateCrop() checks a crop box, allowNA allows empty and NA */
+func validateCrop(crop string, allowNA bool) (error) {
+  _, ok, err := parseCrop(crop)
+  if err != nil {
+    return fmt.Errorf("crop %s: %v", crop, err)
+  }
+  if ! ok && ! allowNA {
+    return fmt.Errorf("crop can not be empty or NA")
+  }
+  return nil
+}
+
+/* ionosondeColumnValue() validates a command line value and converts it to
+ * a value suitable as query argument for the column.
+ */
+func ionosondeColumnValue(c ionosondeColumn, value string) (interface{}, error) {
+  v := strings.TrimSpace(value)
+  switch c.kind {
+    case colText:
+      if v == "" {
+        return nil, fmt.Errorf("-%s must not be empty", c.flag)
+      }
+      return v, nil
+    case colNullText:
+      if v == "" {
+        return nil, nil
+      }
+      return v, nil
+    case colFloat:
+      f, err := strconv.ParseFloat(v, 64)
+      if err != nil {
+        return nil, fmt.Errorf("-%s %s is not a number", c.flag, value)
+      }
+      return f, nil
+    case colDateFormat:
+      if v == "" {
+        return nil, nil
+      }
+      // keep whitespace, it is part of the layout
+      if err := validateDateFormat(value); err != nil {
+        return nil, fmt.Errorf("-%s: %v", c.flag, err)
+      }
+      return value, nil
+    case colCrop, colNullCrop:
+      if v == "" {
+        return nil, nil
+      }
+      if err := validateCrop(v, c.kind == colNullCrop); err != nil {
+        return nil, fmt.Errorf("-%s: %v", c.flag, err)
+      }
+      return v, nil
+    case colBool:
+      b, err := strconv.ParseBool(v)
+      if err != nil {
+        return nil, fmt.Errorf("-%s %s is not true or false", c.flag, value)
+      }
+      return b, nil
+    case colOcrPsm:
+      if v == "" {
+        return nil, nil
+      }
+      psm, err := strconv.Atoi(v)
+      if err != nil {
+        return nil, fmt.Errorf("-%s %s is not an integer", c.flag, value)
+      }
+      if err := validateOcrPsm(psm); err != nil {
+        return nil, fmt.Errorf("-%s: %v", c.flag, err)
+      }
+      return psm, nil
+    case colOcrScale:
+      if v == "" {
+        return nil, nil
+      }
+      scale, err := strconv.ParseFloat(v, 64)
+      if err != nil {
+        return nil, fmt.Errorf("-%s %s is not a number", c.flag, value)
+      }
+      if err := validateOcrScale(scale); err != nil {
+        return nil, fmt.Errorf("-%s: %v", c.flag, err)
+      }
+      return scale, nil
+    case colOcrFieldOptions:
+      if v == "" {
+        return nil, nil
+      }
+      if _, err := parseOcrFieldOptions(v); err != nil {
+        return nil, fmt.Errorf("-%s: %v", c.flag, err)
+      }
+      return v, nil
+    case colOcrMinConfidence:
+      if v == "" {
+        return nil, nil
+      }
+      conf, err := strconv.ParseFloat(v, 64)
+      if err != nil {
+        return nil, fmt.Errorf("-%s %s is not a number", c.flag, value)
+      }
+      if conf < 0 || conf > 100 {
+        return nil, fmt.Errorf("-%s %g is not between 0 and 100", c.flag, conf)
+      }
+      return conf, nil
+    case colTraceAxis:
+      if v == "" {
+        return nil, nil
+      }
+      if _, err := irtrace.ParseAxis(v); err != nil {
+        return nil, fmt.Errorf("-%s: %v", c.flag, err)
+      }
+      return v, nil
+    case colTraceColors:
+      if v == "" {
+        return nil, nil
+      }
+      if _, err := irtrace.ParseColors(v); err != nil {
+        return nil, fmt.Errorf("-%s: %v", c.flag, err)
+      }
+      return v, nil
+    case colSourceType:
+      if v == "" {
+        return nil, nil
+      }
+      if err := validateSourceType(v); err != nil {
+        return nil, fmt.Errorf("-%s: %v", c.flag, err)
+      }
+      return strings.ToLower(v), nil
+    case colOcrEngine:
+      if v == "" {
+        return nil, nil
+      }
+      if err := validateOcrEngine(v); err != nil {
+        return nil, fmt.Errorf("-%s: %v", c.flag, err)
+      }
+      return v, nil
+    case colOcrPreprocess:
+      if v == "" {
+        return nil, nil
+      }
+      if _, err := irfilter.Parse(v); err != nil {
+        return nil, fmt.Errorf("-%s: %v", c.flag, err)
+      }
+      return v, nil
+    case colFilter:
+      if v == "" {
+        return nil, nil
+      }
+      // not null, so the filter of a layout is not inherited
+      if strings.EqualFold(v, filterNone) {
+        return filterNone, nil
+      }
+      if _, err := ionogramFilter(v); err != nil {
+        return nil, fmt.Errorf("-%s: %v", c.flag, err)
+      }
+      return v, nil
+    case colLayout:
+      if v == "" {
+        return nil, nil
+      }
+      l, err := getLayoutByName(v)
+      if err != nil {
+        return nil, fmt.Errorf("-%s: %v", c.flag, err)
+      }
+      return l.LayoutId, nil
+  }
+  return nil, fmt.Errorf("Unknown column kind for -%s", c.flag)
+}
+
+func ionosondeUsage(fs *flag.FlagSet) func() {
+  return func() {
+    fmt.Fprint(os.Stderr, ionosondeUsageText)
+    fs.PrintDefaults()
+  }
+}
+
+/* ionosondeFlags() returns a FlagSet with one string option per column */
+func ionosondeFlags(name string) (*flag.FlagSet, map[string]*string) {
+  fs := flag.NewFlagSet("ionosonde " + name, flag.ContinueOnError)
+  values := map[string]*string{}
+  for _, c := range ionosondeColumns {
+    values[c.flag] = fs.String(c.flag, "", c.help)
+  }
+  fs.Usage = ionosondeUsage(fs)
+  return fs, values
+}
+
+/* splitUrsiArg() allows the URSI code before the options, e.g
+ * "edit JR055 -fof2crop 1,2,3,4", the flag package stops at the first
+ * non-option argument.
+ */
+func splitUrsiArg(args []string) (string, []string) {
+  if len(args) > 0 && ! strings.HasPrefix(args[0], "-") {
+    return strings.ToUpper(args[0]), args[1:]
+  }
+  return "", args
+}
+
+func getIonosondeByUrsi(ursiCode string) (Ionosonde, error) {
+  ionosondes, err := getIonosondesFromDb("where ursiCode=? collate nocase", ursiCode)
+  if err != nil {
+    return Ionosonde{}, err
+  }
+  if len(ionosondes) == 0 {
+    return Ionosonde{}, fmt.Errorf("Ionosonde %s not found", ursiCode)
+  }
+  return ionosondes[0], nil
+}
+
+/* cmdIonosonde runs the ionosonde subcommands */
+func cmdIonosonde(args []string) int {
+  if len(args) == 0 {
+    fs, _ := ionosondeFlags("")
+    fs.Usage()
+    return 2
+  }
+  switch args[0] {
+    case "help", "-h", "-help", "--help":
+      fs, _ := ionosondeFlags("")
+      fs.Usage()
+      return 0
+  }
+  openDatabase()
+  defer db.Close()
+  sub := args[0]
+  ursiCode, rest := splitUrsiArg(args[1:])
+  var err error
+  switch sub {
+    case "list":
+      err = ionosondeList()
+    case "show":
+      err = requireUrsi(ursiCode, func() error { return ionosondeShow(ursiCode) })
+    case "add":
+      err = ionosondeAdd(ursiCode, rest)
+    case "edit":
+      err = requireUrsi(ursiCode, func() error { return ionosondeEdit(ursiCode, rest) })
+    case "enable", "disable", "scrape-on", "scrape-off":
+      column := "enabled"
+      if strings.HasPrefix(sub, "scrape") {
+        column = "scrape"
+      }
+      value := sub == "enable" || sub == "scrape-on"
+      err = requireUrsi(ursiCode, func() error { return ionosondeSetBool(ursiCode, column, value) })
+    case "remove":
+      err = requireUrsi(ursiCode, func() error { return ionosondeRemove(ursiCode, rest) })
+    default:
+      fs, _ := ionosondeFlags("")
+      fmt.Fprintf(os.Stderr, "Unknown subcommand %s\n\n", sub)
+      fs.Usage()
+      return 2
+  }
+  if err == flag.ErrHelp {
+    return 0
+  } else if err != nil {
+    fmt.Fprintf(os.Stderr, "%v\n", err)
+    return 1
+  }
+  return 0
+}
+
+func requireUrsi(ursiCode string, f func() error) (error) {
+  if ursiCode == "" {
+    return fmt.Errorf("URSI code is required")
+  }
+  return f()
+}
+
+func ionosondeList() (error) {
+  ionosondes, err := getIonosondesFromDb("order by ursiCode")
+  if err != nil {
+    return err
+  }
+  w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+  fmt.Fprintln(w, "URSI\tNAME\tLAT\tLON\tSCRAPE\tENABLED\tURL")
+  for _, i := range ionosondes {
+    fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\t%t\t%s\n", i.UrsiCode, i.Name,
+                formatNullFloat64(i.Latitude), formatNullFloat64(i.Longitude),
+                i.Scrape.Valid && i.Scrape.Bool, i.Enabled.Valid && i.Enabled.Bool,
+                i.ImageUrl)
+  }
+  return w.Flush()
+}
+
+func formatNullFloat64(n sql.NullFloat64) (string) {
+  if ! n.Valid {
+    return "NA"
+  }
+  return strconv.FormatFloat(n.Float64, 'f', -1, 64)
+}
+
+func formatNullString(n sql.NullString) (string) {
+  if ! n.Valid {
+    return "NA"
+  }
+  return n.String
+}
+
+func ionosondeShow(ursiCode string) (error) {
+  i, err := getIonosondeByUrsi(ursiCode)
+  if err != nil {
+    return err
+  }
+  inherited, err := layoutInherited(i)
+  if err != nil {
+    return err
+  }
+  w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+  fmt.Fprintf(w, "ursiCode\t%s\n", i.UrsiCode)
+  fmt.Fprintf(w, "name\t%s\n", i.Name)
+  fmt.Fprintf(w, "latitude\t%s\n", formatNullFloat64(i.Latitude))
+  fmt.Fprintf(w, "longitude\t%s\n", formatNullFloat64(i.Longitude))
+  fmt.Fprintf(w, "imageUrl\t%s\n", i.ImageUrl)
+  fmt.Fprintf(w, "sourceType\t%s\n", i.sourceType())
+  fmt.Fprintf(w, "dataUrl\t%s\n", formatNullString(i.DataUrl))
+  fmt.Fprintf(w, "historyUrl\t%s\n", formatNullString(i.HistoryUrl))
+  fmt.Fprintf(w, "layout\t%s\n", formatNullString(i.Layout))
+  fmt.Fprintf(w, "filter\t%s%s\n", formatNullString(i.Filter), inherited["filter"])
+  fmt.Fprintf(w, "dateFormat\t%s%s\n", i.DateFormat, inherited["dateFormat"])
+  fmt.Fprintf(w, "dateCrop\t%s%s\n", i.DateCrop, inherited["dateCrop"])
+  fmt.Fprintf(w, "fof2Crop\t%s%s\n", formatNullString(i.Fof2Crop), inherited["fof2Crop"])
+  fmt.Fprintf(w, "fof1Crop\t%s%s\n", formatNullString(i.Fof1Crop), inherited["fof1Crop"])
+  fmt.Fprintf(w, "foeCrop\t%s%s\n", formatNullString(i.FoeCrop), inherited["foeCrop"])
+  fmt.Fprintf(w, "fxiCrop\t%s%s\n", formatNullString(i.FxiCrop), inherited["fxiCrop"])
+  fmt.Fprintf(w, "foesCrop\t%s%s\n", formatNullString(i.FoesCrop), inherited["foesCrop"])
+  fmt.Fprintf(w, "fminCrop\t%s%s\n", formatNullString(i.FminCrop), inherited["fminCrop"])
+  fmt.Fprintf(w, "hmf2Crop\t%s%s\n", formatNullString(i.Hmf2Crop), inherited["hmf2Crop"])
+  fmt.Fprintf(w, "hmeCrop\t%s%s\n", formatNullString(i.HmeCrop), inherited["hmeCrop"])
+  fmt.Fprintf(w, "anchorCrop\t%s%s\n", formatNullString(i.AnchorCrop), inherited["anchorCrop"])
+  fmt.Fprintf(w, "scrape\t%t\n", i.Scrape.Valid && i.Scrape.Bool)
+  fmt.Fprintf(w, "enabled\t%t\n", i.Enabled.Valid && i.Enabled.Bool)
+  fmt.Fprintf(w, "ocrEngine\t%s\n", formatNullString(i.OcrEngine))
+  fmt.Fprintf(w, "ocrLanguage\t%s\n", formatNullString(i.OcrLanguage))
+  psm := "NA"
+  if i.OcrPsm.Valid {
+    psm = strconv.FormatInt(i.OcrPsm.Int64, 10)
+  }
+  fmt.Fprintf(w, "ocrPsm\t%s\n", psm)
+  fmt.Fprintf(w, "ocrScale\t%s\n", formatNullFloat64(i.OcrScale))
+  fmt.Fprintf(w, "ocrNumericWhitelist\t%s\n", formatNullString(i.OcrNumericWhitelist))
+  fmt.Fprintf(w, "ocrDateWhitelist\t%s\n", formatNullString(i.OcrDateWhitelist))
+  fmt.Fprintf(w, "ocrFieldOptions\t%s\n", formatNullString(i.OcrFieldOptions))
+  fmt.Fprintf(w, "ocrMinConfidence\t%s\n", formatNullFloat64(i.OcrMinConfidence))
+  fmt.Fprintf(w, "ocrPreprocess\t%s\n", formatNullString(i.OcrPreprocess))
+  fmt.Fprintf(w, "traceCrop\t%s\n", formatNullString(i.TraceCrop))
+  fmt.Fprintf(w, "traceFreqAxis\t%s\n", formatNullString(i.TraceFreqAxis))
+  fmt.Fprintf(w, "traceHeightAxis\t%s\n", formatNullString(i.TraceHeightAxis))
+  fmt.Fprintf(w, "traceColors\t%s\n", formatNullString(i.TraceColors))
+  return w.Flush()
+}
+
+func ionosondeAdd(ursiCode string, args []string) (error) {
+  fs, values := ionosondeFlags("add")
+  ursi := fs.String("ursi", ursiCode, "URSI code of the ionosonde, e.g JR055")
+  if err := fs.Parse(args); err != nil {
+    return err
+  }
+  code := strings.ToUpper(strings.TrimSpace(*ursi))
+  if code == "" {
+    return fmt.Errorf("-ursi is required")
+  }
+  if _, err := getIonosondeByUrsi(code); err == nil {
+    return fmt.Errorf("Ionosonde %s already exists, use edit to change it", code)
+  }
+  // defaults for optional columns
+  if *values["scrape"] == "" {
+    *values["scrape"] = "true"
+  }
+  if *values["enabled"] == "" {
+    *values["enabled"] = "false"
+  }
+  image := *values["sourcetype"] == "" || strings.EqualFold(*values["sourcetype"], sourceImage)
+  if image && *values["layout"] == "" && (strings.TrimSpace(*values["dateformat"]) == "" || *values["datecrop"] == "") {
+    return fmt.Errorf("-dateformat and -datecrop are required unless they are provided by a -layout")
+  }
+  columns := []string{ "ursiCode" }
+  placeholders := []string{ "?" }
+  queryArgs := []interface{}{ code }
+  for _, c := range ionosondeColumns {
+    v := *values[c.flag]
+    if v == "" && c.kind.nullable() {
+      continue
+    }
+    if v == "" {
+      return fmt.Errorf("-%s is required", c.flag)
+    }
+    qv, err := ionosondeColumnValue(c, v)
+    if err != nil {
+      return err
+    }
+    columns = append(columns, c.column)
+    placeholders = append(placeholders, "?")
+    queryArgs = append(queryArgs, qv)
+  }
+  _, err := db.Exec("insert into ionosondes (" + strings.Join(columns, ", ") + ") values (" +
+                    strings.Join(placeholders, ", ") + ")", queryArgs...)
+  if err != nil {
+    return err
+  }
+  fmt.Printf("Added ionosonde %s\n", code)
+  return nil
+}
+
+func ionosondeEdit(ursiCode string, args []string) (error) {
+  fs, values := ionosondeFlags("edit")
+  if err := fs.Parse(args); err != nil {
+    return err
+  }
+  i, err := getIonosondeByUrsi(ursiCode)
+  if err != nil {
+    return err
+  }
+  set := []string{}
+  queryArgs := []interface{}{}
+  var verr error
+  fs.Visit(func(f *flag.Flag) {
+    for _, c := range ionosondeColumns {
+      if c.flag != f.Name || verr != nil {
+        continue
+      }
+      qv, err := ionosondeColumnValue(c, *values[c.flag])
+      if err != nil {
+        verr = err
+        return
+      }
+      set = append(set, c.column + "=?")
+      queryArgs = append(queryArgs, qv)
+    }
+  })
+  if verr != nil {
+    return verr
+  }
+  if len(set) == 0 {
+    return fmt.Errorf("Nothing to change, see ionoreporter ionosonde -h")
+  }
+  queryArgs = append(queryArgs, i.IonosondeId)
+  _, err = db.Exec("update ionosondes set " + strings.Join(set, ", ") + " where ionosondeId=?", queryArgs...)
+  if err != nil {
+    return err
+  }
+  fmt.Printf("Updated ionosonde %s\n", i.UrsiCode)
+  return nil
+}
+
+func ionosondeSetBool(ursiCode, column string, value bool) (error) {
+  i, err := getIonosondeByUrsi(ursiCode)
+  if err != nil {
+    return err
+  }
+  _, err = db.Exec("update ionosondes set " + column + "=? where ionosondeId=?", value, i.IonosondeId)
+  if err != nil {
+    return err
+  }
+  fmt.Printf("Ionosonde %s %s=%t\n", i.UrsiCode, column, value)
+  return nil
+}
+
+// ionosondeTables are the tables with rows keyed by ionosondeId
+var ionosondeTables = []string{ "parameters", "images", "rejections", "backfills" }
+
+func ionosondeRemove(ursiCode string, args []string) (error) {
+  fs := flag.NewFlagSet("ionosonde remove", flag.ContinueOnError)
+  purge := fs.Bool("purge", false, "also remove all parameters, archived images, rejections and backfills of the ionosonde")
+  if err := fs.Parse(args); err != nil {
+    return err
+  }
+  i, err := getIonosondeByUrsi(ursiCode)
+  if err != nil {
+    return err
+  }
+  var counts []string
+  total := 0
+  for _, table := range ionosondeTables {
+    var count int
+    err = db.QueryRow("select count(*) from " + table + " where ionosondeId=?", i.IonosondeId).Scan(&count)
+    if err != nil {
+      return err
+    }
+    if count > 0 {
+      counts = append(counts, fmt.Sprintf("%d %s", count, table))
+      total += count
+    }
+  }
+  if total > 0 && ! *purge {
+    return fmt.Errorf("Ionosonde %s has %s rows, use -purge to remove them too (or disable it instead)",
+                      i.UrsiCode, strings.Join(counts, ", "))
+  }
+  images, err := queryArchivedImages("select imageId, file, size from images where ionosondeId=?", i.IonosondeId)
+  if err != nil {
+    return err
+  }
+  // the files are relative to ARCHIVE_DIR, without it they would be left
+  // behind with no row pointing at them
+  if len(images) > 0 && cnf.ArchiveDir == "" {
+    return fmt.Errorf("Ionosonde %s has %d archived images but ARCHIVE_DIR is not set, set it to purge them", i.UrsiCode, len(images))
+  }
+  tx, err := db.Begin()
+  if err != nil {
+    return err
+  }
+  for _, table := range append(ionosondeTables, "ionosondes") {
+    if _, err := tx.Exec("delete from " + table + " where ionosondeId=?", i.IonosondeId); err != nil {
+      tx.Rollback()
+      return err
+    }
+  }
+  if err := tx.Commit(); err != nil {
+    return err
+  }
+  // the rows are gone, a file that can not be removed is only reported
+  for _, a := range images {
+    if err := removeArchiveFile(a.File); err != nil {
+      fmt.Fprintf(os.Stderr, "Unable to remove archived image %s: %v\n", a.File, err)
+    }
+  }
+  if len(counts) == 0 {
+    fmt.Printf("Removed ionosonde %s\n", i.UrsiCode)
+  } else {
+    fmt.Printf("Removed ionosonde %s and %s rows\n", i.UrsiCode, strings.Join(counts, ", "))
+  }
+  return nil
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+  "database/sql"
+  "flag"
+  "fmt"
+  "os"
+  "strings"
+  "text/tabwriter"
+)
+
+/* Layouts hold the date format, crops and filter of an ionogram layout
+ * shared by several ionosondes (e.g all ionograms served by lgdc.uml.edu),
+ * so moving a crop box is one layout edit instead of one edit per station.
+ * An ionosonde with a layout uses the layout's value for every one of these
+ * columns that is null in the ionosondes table, set the column on the
+ * ionosonde to override it (NA for a parameter not in its ionograms, none
+ * for no filter). getIonosondesFromDb() resolves the values, everything else
+ * sees the effective ones.
+ */
+
+// filterNone is the filter of an ionosonde that does not use its layout's
+const filterNone string = "none"
+
+const layoutUsageText string = `Usage: ionoreporter layout <subcommand> [NAME] [options]
+
+Subcommands:
+  list                 list all layouts and the ionosondes using them
+  show NAME            show all settings of a layout
+  add NAME [options]   add a layout (see options below)
+  edit NAME [options]  change settings of a layout
+  remove NAME          remove a layout that no ionosonde uses
+
+Assign a layout with ionoreporter ionosonde edit URSI -layout NAME, columns
+set on the ionosonde override the layout, set them to empty to use the
+layout's value (-filter none to not filter the ionograms of the ionosonde).
+
+Options for add and edit:
+`
+
+// layoutColumnNames are the ionosondes columns a layout provides
+var layoutColumnNames = []string{
+  "filter", "dateFormat", "dateCrop", "fof2Crop", "fof1Crop", "foeCrop", "fxiCrop",
+  "foesCrop", "fminCrop", "hmf2Crop", "hmeCrop", "anchorCrop",
+}
+
+// layout is a layouts row, Columns by column name
+type layout struct {
+  LayoutId int64
+  Name string
+  Columns map[string]sql.NullString
+}
+
+/* layoutColumns() returns the ionosondeColumns (flags) of the columns in
+ * layoutColumnNames.
+ */
+func layoutColumns() ([]ionosondeColumn) {
+  var columns []ionosondeColumn
+  for _, c := range ionosondeColumns {
+    for _, name := range layoutColumnNames {
+      if c.column == name {
+        columns = append(columns, c)
+      }
+    }
+  }
+  return columns
+}
+
+/* getLayouts() returns the layouts matching sqlsuffix, see
+ * getIonosondesFromDb().
+ */
+func getLayouts(sqlsuffix string, args ...interface{}) ([]layout, error) {
+  var layouts []layout
+  rows, err := db.Query("select layoutId, name, " + strings.Join(layoutColumnNames, ", ") +
+                        " from layouts " + sqlsuffix, args...)
+  if err != nil {
+    return layouts, err
+  }
+  defer rows.Close()
+  for rows.Next() {
+    l := layout{ Columns: map[string]sql.NullString{} }
+    values := make([]sql.NullString, len(layoutColumnNames))
+    dest := []interface{}{ &l.LayoutId, &l.Name }
+    for n := range values {
+      dest = append(dest, &values[n])
+    }
+    if err := rows.Scan(dest...); err != nil {
+      return layouts, err
+    }
+    for n, name := range layoutColumnNames {
+      l.Columns[name] = values[n]
+    }
+    layouts = append(layouts, l)
+  }
+  return layouts, rows.Err()
+}
+
+func getLayoutByName(name string) (layout, error) {
+  layouts, err := getLayouts("where name=? collate nocase", strings.TrimSpace(name))
+  if err != nil {
+    return layout{}, err
+  }
+  if len(layouts) == 0 {
+    return layout{}, fmt.Errorf("Layout %s not found", name)
+  }
+  return layouts[0], nil
+}
+
+/* layoutUsers() returns the URSI codes of the ionosondes using layout l */
+func layoutUsers(l layout) ([]string, error) {
+  var ursiCodes []string
+  rows, err := db.Query("select ursiCode from ionosondes where layoutId=? order by ursiCode", l.LayoutId)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+  for rows.Next() {
+    var ursiCode string
+    if err := rows.Scan(&ursiCode); err != nil {
+      return nil, err
+    }
+    ursiCodes = append(ursiCodes, ursiCode)
+  }
+  return ursiCodes, rows.Err()
+}
+
+/* layoutInherited() returns " (layout NAME)" by column name for the columns
+ * of ionosonde i that come from its layout, for ionosonde show.
+ */
+func layoutInherited(i Ionosonde) (map[string]string, error) {
+  inherited := map[string]string{}
+  if ! i.LayoutId.Valid {
+    return inherited, nil
+  }
+  values := make([]sql.NullString, len(layoutColumnNames))
+  dest := []interface{}{}
+  for n := range values {
+    dest = append(dest, &values[n])
+  }
+  err := db.QueryRow("select " + strings.Join(layoutColumnNames, ", ") + " from ionosondes where ionosondeId=?",
+                     i.IonosondeId).Scan(dest...)
+  if err != nil {
+    return inherited, err
+  }
+  for n, name := range layoutColumnNames {
+    if ! values[n].Valid {
+      inherited[name] = fmt.Sprintf(" (layout %s)", i.Layout.String)
+    }
+  }
+  return inherited, nil
+}
+
+func layoutUsage(fs *flag.FlagSet) func() {
+  return func() {
+    fmt.Fprint(os.Stderr, layoutUsageText)
+    fs.PrintDefaults()
+  }
+}
+
+/* layoutFlags() returns a FlagSet with one string option per layout column */
+func layoutFlags(name string) (*flag.FlagSet, map[string]*string) {
+  fs := flag.NewFlagSet("layout " + name, flag.ContinueOnError)
+  values := map[string]*string{}
+  for _, c := range layoutColumns() {
+    values[c.flag] = fs.String(c.flag, "", c.help)
+  }
+  fs.Usage = layoutUsage(fs)
+  return fs, values
+}
+
+/* cmdLayout runs the layout subcommands */
+func cmdLayout(args []string) int {
+  if len(args) == 0 {
+    fs, _ := layoutFlags("")
+    fs.Usage()
+    return 2
+  }
+  switch args[0] {
+    case "help", "-h", "-help", "--help":
+      fs, _ := layoutFlags("")
+      fs.Usage()
+      return 0
+  }
+  openDatabase()
+  defer db.Close()
+  sub := args[0]
+  name, rest := "", args[1:]
+  if len(rest) > 0 && ! strings.HasPrefix(rest[0], "-") {
+    name, rest = rest[0], rest[1:]
+  }
+  requireName := func(f func() error) error {
+    if name == "" {
+      return fmt.Errorf("Layout name is required")
+    }
+    return f()
+  }
+  var err error
+  switch sub {
+    case "list":
+      err = layoutList()
+    case "show":
+      err = requireName(func() error { return layoutShow(name) })
+    case "add":
+      err = requireName(func() error { return layoutAdd(name, rest) })
+    case "edit":
+      err = requireName(func() error { return layoutEdit(name, rest) })
+    case "remove":
+      err = requireName(func() error { return layoutRemove(name) })
+    default:
+      fs, _ := layoutFlags("")
+      fmt.Fprintf(os.Stderr, "Unknown subcommand %s\n\n", sub)
+      fs.Usage()
+      return 2
+  }
+  if err == flag.ErrHelp {
+    return 0
+  } else if err != nil {
+    fmt.Fprintf(os.Stderr, "%v\n", err)
+    return 1
+  }
+  return 0
+}
+
+func layoutList() (error) {
+  layouts, err := getLayouts("order by name")
+  if err != nil {
+    return err
+  }
+  w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+  fmt.Fprintln(w, "NAME\tDATEFORMAT\tDATECROP\tIONOSONDES")
+  for _, l := range layouts {
+    users, err := layoutUsers(l)
+    if err != nil {
+      return err
+    }
+    fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", l.Name, formatNullString(l.Columns["dateFormat"]),
+                formatNullString(l.Columns["dateCrop"]), strings.Join(users, ","))
+  }
+  return w.Flush()
+}
+
+func layoutShow(name string) (error) {
+  l, err := getLayoutByName(name)
+  if err != nil {
+    return err
+  }
+  users, err := layoutUsers(l)
+  if err != nil {
+    return err
+  }
+  w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+  fmt.Fprintf(w, "name\t%s\n", l.Name)
+  for _, column := range layoutColumnNames {
+    fmt.Fprintf(w, "%s\t%s\n", column, formatNullString(l.Columns[column]))
+  }
+  fmt.Fprintf(w, "ionosondes\t%s\n", strings.Join(users, ","))
+  return w.Flush()
+}
+
+func layoutAdd(name string, args []string) (error) {
+  fs, values := layoutFlags("add")
+  if err := fs.Parse(args); err != nil {
+    return err
+  }
+  name = strings.TrimSpace(name)
+  if _, err := getLayoutByName(name); err == nil {
+    return fmt.Errorf("Layout %s already exists, use edit to change it", name)
+  }
+  columns := []string{ "name" }
+  placeholders := []string{ "?" }
+  queryArgs := []interface{}{ name }
+  for _, c := range layoutColumns() {
+    qv, err := ionosondeColumnValue(c, *values[c.flag])
+    if err != nil {
+      return err
+    }
+    columns = append(columns, c.column)
+    placeholders = append(placeholders, "?")
+    queryArgs = append(queryArgs, qv)
+  }
+  _, err := db.Exec("insert into layouts (" + strings.Join(columns, ", ") + ") values (" +
+                    strings.Join(placeholders, ", ") + ")", queryArgs...)
+  if err != nil {
+    return err
+  }
+  fmt.Printf("Added layout %s\n", name)
+  return nil
+}
+
+func layoutEdit(name string, args []string) (error) {
+  fs, values := layoutFlags("edit")
+  if err := fs.Parse(args); err != nil {
+    return err
+  }
+  l, err := getLayoutByName(name)
+  if err != nil {
+    return err
+  }
+  set := []string{}
+  queryArgs := []interface{}{}
+  var verr error
+  fs.Visit(func(f *flag.Flag) {
+    for _, c := range layoutColumns() {
+      if c.flag != f.Name || verr != nil {
+        continue
+      }
+      qv, err := ionosondeColumnValue(c, *values[c.flag])
+      if err != nil {
+        verr = err
+        return
+      }
+      set = append(set, c.column + "=?")
+      queryArgs = append(queryArgs, qv)
+    }
+  })
+  if verr != nil {
+    return verr
+  }
+  if len(set) == 0 {
+    return fmt.Errorf("Nothing to change, see ionoreporter layout -h")
+  }
+  queryArgs = append(queryArgs, l.LayoutId)
+  _, err = db.Exec("update layouts set " + strings.Join(set, ", ") + " where layoutId=?", queryArgs...)
+  if err != nil {
+    return err
+  }
+  users, err := layoutUsers(l)
+  if err != nil {
+    return err
+  }
+  fmt.Printf("Updated layout %s (used by %d ionosondes)\n", l.Name, len(users))
+  return nil
+}
+
+func layoutRemove(name string) (error) {
+  l, err := getLayoutByName(name)
+  if err != nil {
+    return err
+  }
+  users, err := layoutUsers(l)
+  if err != nil {
+    return err
+  }
+  if len(users) > 0 {
+    return fmt.Errorf("Layout %s is used by %s, change their -layout first", l.Name, strings.Join(users, ", "))
+  }
+  if _, err := db.Exec("delete from layouts where layoutId=?", l.LayoutId); err != nil {
+    return err
+  }
+  fmt.Printf("Removed layout %s\n", l.Name)
+  return nil
+}
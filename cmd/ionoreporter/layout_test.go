@@ -0,0 +1,47 @@
+package main
+
+import (
+  "path/filepath"
+  "testing"
+)
+
+func TestLayoutFilterOverride(t *testing.T) {
+  saved := *cnf
+  defer func() { *cnf = saved }()
+  cnf.DatabaseFile = filepath.Join(t.TempDir(), "ionoreporter.db")
+  cnf.ArchiveDir = ""
+  openDatabase()
+  defer db.Close()
+
+  if err := layoutAdd("test", []string{ "-filter", "invert", "-dateformat", "2006 Jan02 002 150405" }); err != nil {
+    t.Fatal(err)
+  }
+  cases := []struct {
+    args []string
+    want string  // effective filter, empty is null
+    pipeline bool
+  }{
+    { []string{ "-layout", "test", "-filter", "" }, "invert", true },
+    // none is not null, the layout's filter is not used
+    { []string{ "-filter", "None" }, filterNone, false },
+    { []string{ "-filter", "grayscale" }, "grayscale", true },
+    { []string{ "-filter", "" }, "invert", true },
+    { []string{ "-layout", "", "-filter", "" }, "", false },
+  }
+  for _, c := range cases {
+    if err := ionosondeEdit("JR055", c.args); err != nil {
+      t.Fatalf("%v: %v", c.args, err)
+    }
+    i, err := getIonosondeByUrsi("JR055")
+    if err != nil {
+      t.Fatal(err)
+    }
+    if i.Filter.String != c.want || i.Filter.Valid != (c.want != "") {
+      t.Errorf("%v: filter %v, want %q", c.args, i.Filter, c.want)
+    }
+    p, err := ionogramFilter(i.Filter.String)
+    if err != nil || p.Empty() == c.pipeline {
+      t.Errorf("%v: filter %q is %v, %v", c.args, i.Filter.String, p, err)
+    }
+  }
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+  "database/sql"
+  "fmt"
+  "image"
+  "strings"
+  "time"
+
+  log "github.com/sirupsen/logrus"
+
+  "github.com/sa6mwa/ionoreporter/irlocate"
+)
+
+/* Ionosondes with an anchorCrop (the header region with the parameter
+ * labels and the date) get their crops located in every ionogram instead of
+ * relying on absolute pixel coordinates only. The anchorCrop is read word by
+ * word (OCR field anchor, see ocroptions.go), the value box of each
+ * parameter is taken right of its label (see irlocate) and the date box is
+ * the words that irdate recognizes as the dateFormat. The stored crops are
+ * used for everything not found, they also give the height of value boxes.
+ * Requires an engine implementing WordLocator (tesseract).
+ */
+
+// cropString formats r as a crop box, x,y,width,height
+func cropString(r image.Rectangle) (string) {
+  return fmt.Sprintf("%d,%d,%d,%d", r.Min.X, r.Min.Y, r.Dx(), r.Dy())
+}
+
+/* anchorWords() reads the words in the anchorCrop of ionosonde i, with the
+ * boxes in image coordinates.
+ */
+func anchorWords(i Ionosonde, engine OCR, img image.Image) ([]irlocate.Word, error) {
+  locator, ok := engine.(WordLocator)
+  if ! ok {
+    return nil, fmt.Errorf("OCR engine %s can not locate words, anchorCrop requires tesseract", ocrEngineName(i))
+  }
+  area, _, err := parseCrop(i.AnchorCrop.String)
+  if err != nil {
+    return nil, fmt.Errorf("Invalid anchorCrop of %s: %v", i.UrsiCode, err)
+  }
+  crop, ok, err := cropImage(img, i.AnchorCrop.String)
+  if err != nil || ! ok {
+    return nil, err
+  }
+  opts, err := ocrOptions(i, ocrFieldAnchor)
+  if err != nil {
+    return nil, err
+  }
+  prepared := prepareCrop(crop, opts)
+  words, err := locator.Words(prepared, opts)
+  if err != nil {
+    return nil, err
+  }
+  // the scale and the filter may have resized the region
+  sx := float64(prepared.Bounds().Dx()) / float64(area.Dx())
+  sy := float64(prepared.Bounds().Dy()) / float64(area.Dy())
+  for n := range words {
+    b := words[n].Box
+    words[n].Box = image.Rect(int(float64(b.Min.X) / sx), int(float64(b.Min.Y) / sy),
+                              int(float64(b.Max.X) / sx + 0.5), int(float64(b.Max.Y) / sy + 0.5)).Add(area.Min)
+  }
+  return words, nil
+}
+
+/* locateCrops() returns ionosonde i with the crops located in img (see
+ * above) and the names of the located ones. i is returned as is if it has
+ * no anchorCrop or nothing was located.
+ */
+func locateCrops(i Ionosonde, engine OCR, img image.Image, downloaded time.Time) (Ionosonde, []string, error) {
+  var located []string
+  if _, ok, _ := parseCrop(i.AnchorCrop.String); ! ok {
+    return i, located, nil
+  }
+  words, err := anchorWords(i, engine, img)
+  if err != nil {
+    return i, located, err
+  }
+
+  r, err := dateRecognizer(i.DateFormat)
+  if err != nil {
+    return i, located, fmt.Errorf("Invalid dateFormat of %s: %v", i.UrsiCode, err)
+  }
+  dateBox, ok := irlocate.FindDate(words, len(strings.Fields(i.DateFormat)), func(text string) (float64, bool) {
+    res, err := r.Recognize(text, downloaded)
+    return res.Cost, err == nil
+  })
+  bounds := img.Bounds()
+  if dateBox = dateBox.Intersect(bounds); ok && ! dateBox.Empty() {
+    i.DateCrop = cropString(dateBox)
+    located = append(located, ocrFieldDate)
+  }
+
+  for _, c := range []struct{ name string; crop *sql.NullString }{
+    { "foF2", &i.Fof2Crop }, { "foF1", &i.Fof1Crop }, { "foE", &i.FoeCrop },
+    { "fxI", &i.FxiCrop }, { "foEs", &i.FoesCrop }, { "fmin", &i.FminCrop },
+    { "hmF2", &i.Hmf2Crop }, { "hmE", &i.HmeCrop },
+  } {
+    // NA crops stay NA, the parameter is not read at all
+    stored, ok, _ := parseCrop(c.crop.String)
+    if ! c.crop.Valid || ! ok {
+      continue
+    }
+    label, found := irlocate.FindLabel(words, c.name)
+    if ! found {
+      continue
+    }
+    box := irlocate.ValueBox(words, label, stored.Size()).Intersect(bounds)
+    if box.Empty() {
+      continue
+    }
+    *c.crop = sql.NullString{ String: cropString(box), Valid: true }
+    located = append(located, c.name)
+  }
+  return i, located, nil
+}
+
+/* locateCropsOrFallback() is locateCrops() for interpretIonogram(), errors
+ * are logged and the stored crops used.
+ */
+func locateCropsOrFallback(i Ionosonde, engine OCR, img image.Image, downloaded time.Time) (Ionosonde) {
+  if _, ok, _ := parseCrop(i.AnchorCrop.String); ! ok {
+    return i
+  }
+  located, names, err := locateCrops(i, engine, img, downloaded)
+  if err != nil {
+    log.Warningf("Unable to locate crops in %s ionogram, using the stored crops: %v", i.UrsiCode, err)
+    return i
+  }
+  if len(names) == 0 {
+    log.Warningf("No labels found in the anchorCrop of %s ionogram, using the stored crops", i.UrsiCode)
+    return i
+  }
+  log.Infof("Located %s in %s ionogram", strings.Join(names, ", "), i.UrsiCode)
+  return located
+}
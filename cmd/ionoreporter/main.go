@@ -29,14 +29,15 @@ import (
   "errors"
   "net/http"
   "crypto/tls"
+  "crypto/sha256"
+  "encoding/hex"
   "os"
   "fmt"
   "sync"
   "image"
   _ "image/jpeg"
-  "image/png"
+  _ "image/png"
   _ "image/gif"
-  "bytes"
   "strings"
   "strconv"
   "regexp"
@@ -46,13 +47,15 @@ import (
   "github.com/kelseyhightower/envconfig"
   _ "github.com/mattn/go-sqlite3"
   "github.com/oliamb/cutter"
-  "github.com/otiai10/gosseract"
   cron "github.com/robfig/cron/v3"
-  "github.com/disintegration/gift"
   "github.com/sixdouglas/suncalc"
 
   "github.com/sa6mwa/ionoreporter/ionizedb"
+  "github.com/sa6mwa/ionoreporter/irdate"
+  "github.com/sa6mwa/ionoreporter/irdidbase"
+  "github.com/sa6mwa/ionoreporter/irfilter"
   "github.com/sa6mwa/ionoreporter/irmsg"
+  "github.com/sa6mwa/ionoreporter/irpredict"
 )
 
 /* version gets replaced build-time by go build -ldflags, see Makefile for more info */
@@ -68,6 +71,8 @@ const (
   Hour string = "15"
   FormatPng string = "png"
   FormatGif string = "gif"
+  dailySlackHeader string = "24H report"
+  frequentSlackHeader string = "Current conditions"
 )
 
 type Config struct {
@@ -84,6 +89,26 @@ type Config struct {
   FrequentReportCronSpec string `envconfig:"FREQUENT_CRONSPEC"`
   ScrapeCronSpec string `envconfig:"SCRAPE_CRONSPEC"`
   ScrapeTimeout time.Duration `envconfig:"SCRAPE_TIMEOUT"`
+  ScrapeWorkers int `envconfig:"SCRAPE_WORKERS"`
+  OcrEngine string `envconfig:"OCR_ENGINE"`
+  OcrTemplates string `envconfig:"OCR_TEMPLATES"`
+  FrequentStaleAfter time.Duration `envconfig:"FREQUENT_STALEAFTER"`
+  Api bool `envconfig:"API"`
+  Metrics bool `envconfig:"METRICS"`
+  HttpListen string `envconfig:"HTTP_LISTEN"`
+  Forecast bool `envconfig:"FORECAST"`
+  ForecastMethod string `envconfig:"FORECAST_METHOD"`
+  ForecastDays int `envconfig:"FORECAST_DAYS"`
+  ArchiveDir string `envconfig:"ARCHIVE_DIR"`
+  ArchiveLayout string `envconfig:"ARCHIVE_LAYOUT"`
+  ArchiveRetentionDays int `envconfig:"ARCHIVE_RETENTION_DAYS"`
+  ArchiveMaxSize int64 `envconfig:"ARCHIVE_MAXSIZE"`
+  DateMaxSkew time.Duration `envconfig:"DATE_MAXSKEW"`
+  DateMaxAge time.Duration `envconfig:"DATE_MAXAGE"`
+  DateMaxFuture time.Duration `envconfig:"DATE_MAXFUTURE"`
+  DateCadence time.Duration `envconfig:"DATE_CADENCE"`
+  DidbaseUrl string `envconfig:"DIDBASE_URL"`
+  DidbaseWindow time.Duration `envconfig:"DIDBASE_WINDOW"`
 }
 
 var cnf = &Config{
@@ -96,6 +121,26 @@ var cnf = &Config{
   FrequentReportCronSpec: "0 */2 * * *",  // push foF2, etc every 2nd hour
   ScrapeCronSpec: "*/15 * * * *",         // scrape all ionograms every 15 minutes
   ScrapeTimeout: 15 * time.Second,        // http.Client timeout
+  ScrapeWorkers: 4,                       // download and interpret 4 ionograms in parallel
+  OcrEngine: defaultOcrEngine,            // tesseract unless built with -tags notesseract
+  OcrTemplates: "templates",              // directory with templates for the template OCR engine
+  FrequentStaleAfter: 1 * time.Hour,      // flag parameters older than this as stale in frequent reports
+  Api: false,       // do not serve the read-only HTTP API per default
+  Metrics: false,   // do not serve prometheus metrics on /metrics per default
+  HttpListen: ":8080",                    // listen address for the HTTP API and metrics
+  Forecast: true,                         // append a next 24h forecast to the daily reports
+  ForecastMethod: irpredict.MethodSameHourTrend, // see irpredict.Methods
+  ForecastDays: 7,                        // days of history used by the forecast
+  ArchiveDir: "",                         // do not archive raw ionograms per default
+  ArchiveLayout: "{ursi}/{year}/{month}/{day}", // archive directory layout, see archive.go
+  ArchiveRetentionDays: 30,               // remove archived ionograms older than 30 days
+  ArchiveMaxSize: 0,                      // no size limit (in MB) of the archive per default
+  DateMaxSkew: 48 * time.Hour,            // reject ionogram dates more than 48h from the download time
+  DateMaxAge: 6 * time.Hour,              // reject ionograms more than 6 hours old, see plausibility.go
+  DateMaxFuture: 15 * time.Minute,        // reject ionograms dated more than 15 minutes in the future
+  DateCadence: 1 * time.Hour,             // reject images served unchanged for more than an hour
+  DidbaseUrl: irdidbase.DefaultUrl,       // DIDBGetValues service for ionosondes with sourceType didbase
+  DidbaseWindow: 6 * time.Hour,           // query the last 6 hours from DIDBase on every scrape
 }
 
 var db *sql.DB
@@ -109,6 +154,31 @@ func openDB(dbfile string) (*sql.DB) {
   return d
 }
 
+/* openDatabase() opens cnf.DatabaseFile into db, creates it if it does not
+ * exist and applies any pending schema migrations (see ionizedb.Migrate).
+ */
+func openDatabase() {
+  if _, err := os.Stat(cnf.DatabaseFile); os.IsNotExist(err) {
+    // db file does not exist, create it...
+    log.Infof("Creating and initializing database %s", cnf.DatabaseFile)
+    f, err := os.OpenFile(cnf.DatabaseFile, os.O_CREATE, 0644)
+    if err != nil {
+      log.Fatalf("Cannot create db file %s: %v", cnf.DatabaseFile, err)
+    }
+    f.Close()
+  } else if err != nil {
+    log.Fatalf("Cannot stat db file %s: %v", cnf.DatabaseFile, err)
+  }
+  db = openDB(cnf.DatabaseFile)
+  applied, err := ionizedb.Migrate(db, false)
+  for _, m := range applied {
+    log.Infof("Applied schema migration %d to %s: %s", m.Version, cnf.DatabaseFile, m.Description)
+  }
+  if err != nil {
+    log.Fatalf("Unable to migrate database %s: %v", cnf.DatabaseFile, err)
+  }
+}
+
 type Ionosonde struct {
   IonosondeId string
   UrsiCode string
@@ -116,6 +186,8 @@ type Ionosonde struct {
   Latitude sql.NullFloat64
   Longitude sql.NullFloat64
   ImageUrl string
+  LayoutId sql.NullInt64
+  Layout sql.NullString      // name of the layout, see layout.go
   Filter sql.NullString
   DateFormat string
   DateCrop string
@@ -127,8 +199,27 @@ type Ionosonde struct {
   FminCrop sql.NullString
   Hmf2Crop sql.NullString
   HmeCrop sql.NullString
-  Push sql.NullBool
+  AnchorCrop sql.NullString  // header region to locate crops in, see locate.go
+  Scrape sql.NullBool
   Enabled sql.NullBool
+  OcrEngine sql.NullString
+  OcrLanguage sql.NullString
+  OcrPsm sql.NullInt64
+  OcrScale sql.NullFloat64
+  OcrNumericWhitelist sql.NullString
+  OcrDateWhitelist sql.NullString
+  OcrFieldOptions sql.NullString
+  OcrMinConfidence sql.NullFloat64
+  OcrPreprocess sql.NullString  // filter pipeline for every crop, see ocroptions.go
+  LastImageHash sql.NullString
+  LastImageChanged sql.NullTime
+  SourceType sql.NullString  // null is image, see scaled.go
+  DataUrl sql.NullString
+  HistoryUrl sql.NullString  // URL template of historical ionograms, see backfill.go
+  TraceCrop sql.NullString   // plot area and axes for trace digitization, see trace.go
+  TraceFreqAxis sql.NullString
+  TraceHeightAxis sql.NullString
+  TraceColors sql.NullString
 }
 
 type Parameters struct {
@@ -143,6 +234,10 @@ type Parameters struct {
   Fmin sql.NullFloat64
   HmF2 sql.NullFloat64
   HmE sql.NullFloat64
+  HF sql.NullFloat64      // h'F, lowest virtual height of the F trace
+  Flags ParameterFlags
+  Confidence ParameterConfidence
+  DtConf sql.NullFloat64  // OCR confidence of the date
 }
 
 type DailyReportParams struct {
@@ -157,232 +252,236 @@ type DailyReportParams struct {
 }
 
 
-// getText from image
-func getText(img *bytes.Buffer) (string) {
-  client := gosseract.NewClient()
-  defer client.Close()
-  client.SetImageFromBytes(img.Bytes())
-  text, err := client.Text()
-  if err != nil {
-    return ""
-  }
-  return strings.TrimSpace(text)
-}
-// getText from part of image
-func getTextFromCut(img image.Image, xywh string) (string, error) {
+/* parseCrop() parses a crop box in the format x,y,width,height (as shown in
+ * the Gimp Rectangle Select property box). ok is false if the crop is empty,
+ * NA, or starts with # or - (i.e. parameter not available in this ionogram).
+ */
+func parseCrop(xywh string) (r image.Rectangle, ok bool, err error) {
   n := []int{}
   xywh = strings.TrimSpace(xywh)
   xywhU := strings.ToUpper(xywh)
   if len(xywh) == 0 || strings.HasPrefix(xywhU, "NA") ||
       strings.HasPrefix(xywhU, "#") || strings.HasPrefix(xywhU, "-") {
-    return "", nil
+    return r, false, nil
   }
   s := strings.Split(xywh, ",")
   if len(s) != 4 {
-    return "", errors.New("Wrong bounding-box format for xywh")
+    return r, false, errors.New("Wrong bounding-box format for xywh")
   }
   for i := range s {
     txt := strings.TrimSpace(s[i])
     num, err := strconv.Atoi(txt)
     if err != nil {
-      return "", fmt.Errorf("xywh format error: %s is not an integer", txt)
+      return r, false, fmt.Errorf("xywh format error: %s is not an integer", txt)
+    }
+    if num < 0 {
+      return r, false, fmt.Errorf("xywh format error: %d is negative", num)
     }
     n = append(n, num)
   }
-  crop, err := cutter.Crop(img, cutter.Config{
+  if n[2] == 0 || n[3] == 0 {
+    return r, false, errors.New("xywh format error: width and height must be above 0")
+  }
+  return image.Rect(n[0], n[1], n[0] + n[2], n[1] + n[3]), true, nil
+}
+/* cropImage() returns the part of img in the crop box xywh, ok is false if
+ * the crop is not available (see parseCrop()).
+ */
+func cropImage(img image.Image, xywh string) (crop image.Image, ok bool, err error) {
+  r, ok, err := parseCrop(xywh)
+  if err != nil || ! ok {
+    return nil, ok, err
+  }
+  crop, err = cutter.Crop(img, cutter.Config{
     Mode: cutter.TopLeft,
-    Anchor: image.Point{n[0], n[1]},
-    Width: n[2],
-    Height: n[3],
+    Anchor: r.Min,
+    Width: r.Dx(),
+    Height: r.Dy(),
   })
-  if err != nil {
-    return "", err
-  }
-  buf := new(bytes.Buffer)
-  defer buf.Reset()
-  err = png.Encode(buf, crop)
-  if err != nil {
-    return "", err
+  return crop, err == nil, err
+}
+
+// getText from part of image
+/* getTextFromCut() returns the text in the xywh crop of img and the
+ * confidence (0-100) of the engine in it.
+ */
+func getTextFromCut(engine OCR, opts OcrOptions, img image.Image, xywh string) (string, float64, error) {
+  crop, ok, err := cropImage(img, xywh)
+  if err != nil || ! ok {
+    return "", 0, err
   }
-  return getText(buf), nil
+  return engine.Text(prepareCrop(crop, opts), opts)
 }
 
-func getTextFromCutFloat64(img image.Image, xywh string) (float64, error) {
-  textPreSwab, err := getTextFromCut(img, xywh)
+func getTextFromCutFloat64(engine OCR, opts OcrOptions, img image.Image, xywh string) (float64, float64, error) {
+  textPreSwab, confidence, err := getTextFromCut(engine, opts, img, xywh)
   if err != nil {
-    return float64(0.0), err
+    return float64(0.0), 0, err
   }
   reg := regexp.MustCompile(`[^0-9\.]+`)
   txt := reg.ReplaceAllString(textPreSwab, "")
   if len(txt) == 0 {
-    return float64(0.0), errors.New("Not a number")
+    return float64(0.0), confidence, errors.New("Not a number")
   }
   num, err := strconv.ParseFloat(txt, 32)
   if err != nil {
-    return float64(0.0), err
+    return float64(0.0), confidence, err
   }
-  return float64(num), nil
+  return float64(num), confidence, nil
 }
 
-var outputs = map[string]string{}
-func downloadFile(url string, tag string) (string, error) {
+// download is a downloaded ionogram
+type download struct {
+  File string
+  LastModified time.Time  // zero if the server did not send Last-Modified
+  Hash string             // sha256 of the file (hex)
+}
+
+/* scrapeClient() returns the HTTP client used to download from ionosondes */
+func scrapeClient() (*http.Client) {
   tr := &http.Transport{
     TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
   }
-  client := &http.Client{
+  return &http.Client{
     Transport: tr,
     Timeout: cnf.ScrapeTimeout,
   }
-  resp, err := client.Get(url)
+}
+
+// httpStatusError is returned by downloads answered with another status than 200
+type httpStatusError struct {
+  StatusCode int
+  Status string
+}
+
+func (e httpStatusError) Error() string {
+  return "HTTP status " + e.Status
+}
+
+/* lastModified() returns the Last-Modified time of resp, zero if there is
+ * none.
+ */
+func lastModified(resp *http.Response) (time.Time) {
+  if lm := resp.Header.Get("Last-Modified"); lm != "" {
+    if t, err := http.ParseTime(lm); err == nil {
+      return t.UTC()
+    }
+  }
+  return time.Time{}
+}
+
+/* downloadFile() downloads url into a temporary file named after tag and
+ * returns the file name (with the image format as extension), the
+ * Last-Modified time and hash of the file. The caller owns the file and must
+ * remove it.
+ */
+func downloadFile(url string, tag string) (download, error) {
+  d := download{}
+  resp, err := scrapeClient().Get(url)
   if err != nil {
-    return "", err
+    return d, err
   }
   defer resp.Body.Close()
-  out, err := ioutil.TempFile("", "ionoreporter-")
+  if resp.StatusCode != http.StatusOK {
+    return d, httpStatusError{ resp.StatusCode, resp.Status }
+  }
+  d.LastModified = lastModified(resp)
+  out, err := ioutil.TempFile("", "ionoreporter-" + tag + "-")
   if err != nil {
-    return "", err
+    return d, err
   }
-  _, err = io.Copy(out, resp.Body)
+  h := sha256.New()
+  _, err = io.Copy(io.MultiWriter(out, h), resp.Body)
   out.Close()
   if err != nil {
     os.Remove(out.Name())
-    return "", err
+    return d, err
   }
+  d.Hash = hex.EncodeToString(h.Sum(nil))
   reader, err := os.Open(out.Name())
   if err != nil {
     os.Remove(out.Name())
-    return "", err
+    return d, err
   }
   _, format, err := image.DecodeConfig(reader)
   reader.Close()
   if err != nil {
     os.Remove(out.Name())
-    return "", err
+    return d, err
   }
   newOutFile := out.Name() + "." + format
   if err := os.Rename(out.Name(), newOutFile); err != nil {
     os.Remove(out.Name())
-    return "", err
+    return d, err
   }
   fil, err := os.Stat(newOutFile)
   if err != nil {
     os.Remove(newOutFile)
-    return "", err
+    return d, err
   }
   if fil.Size() <= 1000 {
     os.Remove(newOutFile)
-    return "", errors.New("File is too small to be true")
+    return d, errors.New("File is too small to be true")
   }
-  outputs[tag] = newOutFile
-  return newOutFile, nil
+  d.File = newOutFile
+  return d, nil
 }
-func getOutput(name string) (string, error) {
-  for tag, imgfile := range outputs {
-    if tag == name {
-      if _, err := os.Stat(imgfile); err != nil {
-        return "", err
-      } else {
-        return imgfile, nil
-      }
-    }
+
+
+/* ionogramFilter() parses the filter of an ionosonde (or layout). Steps
+ * that change the size (scale) are not allowed as the crops are pixel
+ * coordinates in the original ionogram, they belong in the filter of a
+ * field (see ocrFieldOptions).
+ */
+func ionogramFilter(filter string) (irfilter.Pipeline, error) {
+  p, err := irfilter.Parse(filter)
+  if err != nil {
+    return p, err
   }
-  return "", errors.New("Name or file not found")
-}
-func cleanup() {
-  for _, v := range outputs {
-    os.Remove(v)
+  if p.Resizes() {
+    return irfilter.Pipeline{}, fmt.Errorf("Filter %s changes the size of the ionogram, scale crops with a per-field filter or ocrScale instead", filter)
   }
-  outputs = map[string]string{}
+  return p, nil
 }
 
-
 /* applyFilter will apply an image filter specified in the filter column in the
- * ionosonde table of the database.
+ * ionosonde table of the database, a pipeline or legacy filter name (see
+ * irfilter and ionogramFilter()).
  */
-func applyFilter(src image.Image, filter, ursiCode string) (image.Image) {
-  var g *gift.GIFT
-  const (
-    strInvert string = `invert`
-    strGrayscale string = `grayscale`
-    strBlackAndWhite string = `blackandwhite`
-    strInvertAndGrayscale string = `invertandgrayscale`
-    strInvertAndBlackAndWhite string = `invertandblackandwhite`
-    applyTxt string = `Applying filter %s to %s ionogram`
-  )
-  f := strings.ToLower(strings.TrimSpace(filter))
-  switch f {
-    case "":
-      fallthrough
-    case "none":
-      fallthrough
-    case "na":
-      fallthrough
-    case "n/a":
-      fallthrough
-    case "nil":
-      return src
-    case strInvert:
-      log.Infof(applyTxt, f, ursiCode)
-      g = gift.New(
-        gift.Invert(),
-      )
-      dst := image.NewRGBA(g.Bounds(src.Bounds()))
-      g.Draw(dst, src)
-      return dst
-    case strGrayscale:
-      log.Infof(applyTxt, f, ursiCode)
-      g = gift.New(
-        gift.Grayscale(),
-      )
-      dst := image.NewRGBA(g.Bounds(src.Bounds()))
-      g.Draw(dst, src)
-      return dst
-    case strBlackAndWhite:
-      log.Infof(applyTxt, f, ursiCode)
-      g = gift.New(
-        gift.Grayscale(),
-        gift.Brightness(-40),
-        gift.Contrast(80),
-      )
-      dst := image.NewRGBA(g.Bounds(src.Bounds()))
-      g.Draw(dst, src)
-      return dst
-    case strInvertAndGrayscale:
-      log.Infof(applyTxt, f, ursiCode)
-      g = gift.New(
-        gift.Invert(),
-        gift.Grayscale(),
-      )
-      dst := image.NewRGBA(g.Bounds(src.Bounds()))
-      g.Draw(dst, src)
-      return dst
-    case strInvertAndBlackAndWhite:
-      log.Infof(applyTxt, f, ursiCode)
-      g = gift.New(
-        gift.Invert(),
-        gift.Grayscale(),
-        gift.Brightness(-40),
-        gift.Contrast(80),
-      )
-      dst := image.NewRGBA(g.Bounds(src.Bounds()))
-      g.Draw(dst, src)
-      return dst
-    default:
-      log.Errorf("Unknown filter %s, skipping filter for %s ionogram", f, ursiCode)
-  }
-  return src
+func applyFilter(src image.Image, filter, ursiCode string) (image.Image, error) {
+  p, err := ionogramFilter(filter)
+  if err != nil {
+    return src, fmt.Errorf("Invalid filter of %s: %v", ursiCode, err)
+  }
+  if p.Empty() {
+    return src, nil
+  }
+  log.Infof("Applying filter %s to %s ionogram", p, ursiCode)
+  return p.Apply(src), nil
 }
 
 
-/* getIonosondesFromDb() is used by ionize() and the make*Report() functions.
+/* getIonosondesFromDb() is used by ionize(), the make*Report() functions and
+ * the API. Optional args are passed as query arguments for placeholders in
+ * sqlsuffix. Filter, dateFormat and crops that are null are taken from the
+ * layout of the ionosonde, if any (see layout.go).
  */
-func getIonosondesFromDb(sqlsuffix string) ([]Ionosonde, error) {
+func getIonosondesFromDb(sqlsuffix string, args ...interface{}) ([]Ionosonde, error) {
   var ionosondes []Ionosonde
-  rows, err := db.Query("select ionosondeId, ursiCode, name, latitude, longitude, " +
-                        "imageUrl, filter, dateFormat, " +
-                        "dateCrop, fof2Crop, fof1Crop, foeCrop, fxiCrop, " +
-                        "foesCrop, fminCrop, hmf2Crop, hmeCrop " +
-                        "from ionosondes " + sqlsuffix)
+  rows, err := db.Query("select i.ionosondeId, i.ursiCode, i.name, i.latitude, i.longitude, " +
+                        "i.imageUrl, i.layoutId, l.name, coalesce(i.filter, l.filter), " +
+                        "coalesce(i.dateFormat, l.dateFormat, ''), coalesce(i.dateCrop, l.dateCrop, ''), " +
+                        "coalesce(i.fof2Crop, l.fof2Crop), coalesce(i.fof1Crop, l.fof1Crop), " +
+                        "coalesce(i.foeCrop, l.foeCrop), coalesce(i.fxiCrop, l.fxiCrop), " +
+                        "coalesce(i.foesCrop, l.foesCrop), coalesce(i.fminCrop, l.fminCrop), " +
+                        "coalesce(i.hmf2Crop, l.hmf2Crop), coalesce(i.hmeCrop, l.hmeCrop), " +
+                        "coalesce(i.anchorCrop, l.anchorCrop), " +
+                        "i.scrape, i.enabled, i.ocrEngine, " +
+                        "i.ocrLanguage, i.ocrPsm, i.ocrScale, i.ocrNumericWhitelist, i.ocrDateWhitelist, " +
+                        "i.ocrFieldOptions, i.ocrMinConfidence, i.ocrPreprocess, i.lastImageHash, i.lastImageChanged, " +
+                        "i.sourceType, i.dataUrl, i.historyUrl, i.traceCrop, i.traceFreqAxis, i.traceHeightAxis, " +
+                        "i.traceColors " +
+                        "from ionosondes i left join layouts l on l.layoutId=i.layoutId " + sqlsuffix, args...)
   if err != nil {
     log.Errorf("Database query failed, cannot populate ionogram parameters: %v", err)
     return ionosondes, err
@@ -393,9 +492,15 @@ func getIonosondesFromDb(sqlsuffix string) ([]Ionosonde, error) {
   for rows.Next() {
     ti := Ionosonde{}
     err = rows.Scan(&ti.IonosondeId, &ti.UrsiCode, &ti.Name, &ti.Latitude, &ti.Longitude,
-                    &ti.ImageUrl, &ti.Filter, &ti.DateFormat,
+                    &ti.ImageUrl, &ti.LayoutId, &ti.Layout, &ti.Filter, &ti.DateFormat,
                     &ti.DateCrop, &ti.Fof2Crop, &ti.Fof1Crop, &ti.FoeCrop, &ti.FxiCrop,
-                    &ti.FoesCrop, &ti.FminCrop, &ti.Hmf2Crop, &ti.HmeCrop)
+                    &ti.FoesCrop, &ti.FminCrop, &ti.Hmf2Crop, &ti.HmeCrop, &ti.AnchorCrop,
+                    &ti.Scrape, &ti.Enabled, &ti.OcrEngine,
+                    &ti.OcrLanguage, &ti.OcrPsm, &ti.OcrScale, &ti.OcrNumericWhitelist,
+                    &ti.OcrDateWhitelist, &ti.OcrFieldOptions, &ti.OcrMinConfidence, &ti.OcrPreprocess,
+                    &ti.LastImageHash, &ti.LastImageChanged, &ti.SourceType, &ti.DataUrl,
+                    &ti.HistoryUrl, &ti.TraceCrop, &ti.TraceFreqAxis, &ti.TraceHeightAxis,
+                    &ti.TraceColors)
     if err != nil {
       log.Errorf("rows.Scan error: %v", err)
       return ionosondes, err
@@ -411,441 +516,471 @@ func getIonosondesFromDb(sqlsuffix string) ([]Ionosonde, error) {
 }
 
 
-/* fixDate(string) is used by ionize() to replace common misinterpretations of the date string by tesseract
- */
-func fixDate(dt string) (string) {
-  replaceslice := [][2]string{
-    { "oOct", "Oct" },
-    { "Hov", "Nov" },
-    { " 610 ", " 010 " },
-    { " 611 ", " 011 " },
-    { " 612 ", " 012 " },
-    { " 613 ", " 013 " },
-    { " 614 ", " 014 " },
-    { " 615 ", " 015 " },
-    { " 616 ", " 016 " },
-    { " 617 ", " 017 " },
-    { " 618 ", " 018 " },
-    { " 619 ", " 019 " },
-    { " 620 ", " 020 " },
-    { " 621 ", " 021 " },
-    { " 622 ", " 022 " },
-    { " 623 ", " 023 " },
-    { " 624 ", " 024 " },
-    { " 625 ", " 025 " },
-    { " 626 ", " 026 " },
-    { " 627 ", " 027 " },
-    { " 628 ", " 028 " },
-    { " 629 ", " 029 " },
-    { " 630 ", " 030 " },
-    { " 631 ", " 031 " },
-    { " 632 ", " 032 " },
-    { " 633 ", " 033 " },
-    { " 634 ", " 034 " },
-    { " 635 ", " 035 " },
-    { " 636 ", " 036 " },
-    { " 637 ", " 037 " },
-    { " 638 ", " 038 " },
-    { " 639 ", " 039 " },
-    { " 640 ", " 040 " },
-    { " 641 ", " 041 " },
-    { " 642 ", " 042 " },
-    { " 643 ", " 043 " },
-    { " 644 ", " 044 " },
-    { " 645 ", " 045 " },
-    { " 646 ", " 046 " },
-    { " 647 ", " 047 " },
-    { " 648 ", " 048 " },
-    { " 649 ", " 049 " },
-    { " 650 ", " 050 " },
-    { " 0620 ", " 020 " },
-    { " 0622 ", " 022 " },
-    { " 6011 ", " 011 " },
-    { " 6012 ", " 012 " },
-    { " 6013 ", " 013 " },
-    { " 6014 ", " 014 " },
-    { " 6015 ", " 015 " },
-    { " 6016 ", " 016 " },
-    { " 6017 ", " 017 " },
-    { " 6018 ", " 018 " },
-    { " 6019 ", " 019 " },
-    { " 6020 ", " 020 " },
-    { " 6021 ", " 021 " },
-    { " 6022 ", " 022 " },
-    { " 6023 ", " 023 " },
-    { " 6024 ", " 024 " },
-    { " 6025 ", " 025 " },
-    { " 6026 ", " 026 " },
-    { " 6027 ", " 027 " },
-    { " 6028 ", " 028 " },
-    { " 6029 ", " 029 " },
-    { " 6030 ", " 030 " },
-    { " 6031 ", " 031 " },
-    { " 6032 ", " 032 " },
-    { " 6033 ", " 033 " },
-    { " 6034 ", " 034 " },
-    { " 6035 ", " 035 " },
-    { " 6036 ", " 036 " },
-    { " 6037 ", " 037 " },
-    { " 6038 ", " 038 " },
-    { " 6039 ", " 039 " },
-    { " 6040 ", " 040 " },
-    { " 6041 ", " 041 " },
-    { " 6042 ", " 042 " },
-    { " 6043 ", " 043 " },
-    { " 6044 ", " 044 " },
-    { " 6045 ", " 045 " },
-    { " 6046 ", " 046 " },
-    { " 6047 ", " 047 " },
-    { " 6048 ", " 048 " },
-    { " 6049 ", " 049 " },
-    { " 6050 ", " 050 " },
-    { "Febl17 ", "Feb17 "},
-    { "Febl?7 ", "Feb17 "},
-    { "Febl1? ", "Feb17 "},
-    { "Febl? ", "Feb17 "},
-    { "Febl?7 ", "Feb17 "},
-    { "Febl16 ", "Feb16 "},
-    { "Feb1l5 ", "Feb15 "},
-    { "Febl15 ", "Feb15 "},
-    { "Febl14 ", "Feb14 "},
-    { "Febl13 ", "Feb13 "},
-    { "Febl1?2 ", "Feb12 "},
-    { "Feb1? ", "Feb12 "},
-    { "Febl1? ", "Feb12 "},
-    { "Febl? ", "Feb12 "},
-    { "Febl12 ", "Feb12 "},
-    { "Febl? ", "Feb12 "},
-    { "Feb1?2 ", "Feb12 "},
-    { "Feb1l2 ", "Feb12 "},
-    { "Feb1l3 ", "Feb13 "},
-    { "Feb11?2 ", "Feb12 "},
-    { "Feb0O7 ", "Feb07 "},
-    { "Feb007 ", "Feb07 "},
-    { "Feb@7 ", "Feb07 "},
-    { "Feb@5 ", "Feb05 "},
-    { "FebO05 ", "Feb05 "},
-    { "FebO06 ", "Feb06 "},
-    { "FebO? ", "Feb07 "},
-    { "DecO01 ", "Dec01 "},
-    { "DecO@1 ", "Dec01 "},
-    { "DecO1l ", "Dec01 "},
-    { "DecOl ", "Dec01 "},
-    { "DecO?2 ", "Dec02 " },
-    { "DecO@2 ", "Dec02 " },
-    { "DecO? ", "Dec07 " },
-    { "Dec1? ", "Dec12 " },
-    { "Decl? ", "Dec18 " },
-    { "Jan?21 ", "Jan21 " },
-    { "JanlO ", "Jan10 " },
-    { "JanlO0 ", "Jan10 " },
-    { "Jan1O0 ", "Jan10 " },
-    { "Jani0 ", "Jan10 " },
-    { "Jan110 ", "Jan10 " },
-    { "Jani0 ", "Jan10 " },
-    { "Jan1O ", "Jan10 " },
-    { "Jani10 ", "Jan10 "},
-    { "Jan1l ", "Jan11 " },
-    { "Janii1 ", "Jan11 " },
-    { "Janil ", "Jan11 " },
-    { "Jani? 017 ", "Jan17 017 " },
-    { "Jani? ", "Jan12 " },
-    { "Janl? ", "Jan12 " },
-    { "Jani15 ", "Jan15 " },
-    { "Jani16 ", "Jan16 " },
-    { "Jani17 ", "Jan17 " },
-    { "Jani18 ", "Jan18 " },
-    { "Jani19 ", "Jan19 " },
-    { "Janl10 ", "Jan10 " },
-    { "Janl11 ", "Jan11 " },
-    { "Janl12 ", "Jan12 " },
-    { "Janl13 ", "Jan13 " },
-    { "Janl14 ", "Jan14 " },
-    { "Janl15 ", "Jan15 " },
-    { "Janl16 ", "Jan16 " },
-    { "Janl17 ", "Jan17 " },
-    { "Janl18 ", "Jan18 " },
-    { "Janl19 ", "Jan19 " },
-    { "Jani3 ", "Jan13 " },
-    { "Jani4 ", "Jan14 " },
-    { "Jani5 ", "Jan15 " },
-    { "Jani6 ", "Jan16 " },
-    { "Jani7 ", "Jan17 " },
-    { "Jani8 ", "Jan18 " },
-    { "Jani9 ", "Jan19 " },
-    { "Janil3 ", "Jan13 " },
-    { "Janil4 ", "Jan14 " },
-    { "Janil5 ", "Jan15 " },
-    { "Janil6 ", "Jan16 " },
-    { "Janil7 ", "Jan17 " },
-    { "Janil8 ", "Jan18 " },
-    { "Janil9 ", "Jan19 " },
-    { "Jani13 ", "Jan13 " },
-    { "Jan1l5 ", "Jan15 " },
-    { "Jan0O", "Jan0" },
-    { "JanO0", "Jan0" },
-    { "JanO", "Jan0" },
-    { "Decl10 ", "Dec10 " },
-    { "Decl11 ", "Dec11 " },
-    { "Decl12 ", "Dec12 " },
-    { "Decl13 ", "Dec13 " },
-    { "Decl14 ", "Dec14 " },
-    { "Decl15 ", "Dec15 " },
-    { "Decl16 ", "Dec16 " },
-    { "Decl17 ", "Dec17 " },
-    { "Decl18 ", "Dec18 " },
-    { "Decl19 ", "Dec19 " },
-    { "DeclO ", "Dec10 " },
-    { "Decll ", "Dec11 " },
-    { "110 ", "10 " },
-    { "1O@ ", "10 " },
-    { "10O ", "10 " },
-    { "1O ", "10 " },
-    { " O0", " 00" },
-    { "Jan00", "Jan0" },
-    { "Feb00", "Feb0" },
-    { "Mar00", "Mar0" },
-    { "Apr00", "Apr0" },
-    { "May00", "May0" },
-    { "Jun00", "Jun0" },
-    { "Jul00", "Jul0" },
-    { "Aug00", "Aug0" },
-    { "Sep00", "Sep0" },
-    { "Oct00", "Oct0" },
-    { "Nov00", "Nov0" },
-    { "Dec00", "Dec0" },
-    { "Dec@", "Dec0" },
-    { "Novl19 ", "Nov19 " },
-    { "Nov1?7 ", "Nov17 " },
-    { "Nov1? ", "Nov17 " },
-    { "Nov1l5", "Nov15" },
-    { "Nov1?2", "Nov12" },
-    { "Novl16", "Nov16" },
-    { "Nov113 ", "Nov13 " },
-    { "Nov114 ", "Nov14 " },
-    { "Nov115 ", "Nov15 " },
-    { "Nov116 ", "Nov16 " },
-    { "Nov117 ", "Nov17 " },
-    { "Nov118 ", "Nov18 " },
-    { "Nov119 ", "Nov19 " },
-    { "NovO01l ", "Nov01 " },
-    { "NovO0l1 ", "Nov01 " },
-    { "NovO1l ", "Nov01 " },
-    { "NovO01 ", "Nov01 " },
-    { "NovO1 ", "Nov01 " },
-    { "Nov@l ", "Nov01 " },
-    { "NovOl ", "Nov01 " },
-    { "NovO0", "Nov0" },
-    { "Nov@", "Nov0" },
-    { "NovO", "Nov0" },
-    { "Novl", "Nov1" },
-    { "Decl", "Dec1" },
-    { "Janl", "Jan1" },
-    { "Febl", "Feb1" },
-    { "Marl", "Mar1" },
-    { "Aprl", "Apr1" },
-    { "Junl", "Jun1" },
-    { "Jull", "Jul1" },
-    { "Augl", "Aug1" },
-    { "Octl", "Oct1" },
-    { "O1 ", "01 " },
-    { "O2 ", "02 " },
-    { "O3 ", "03 " },
-    { "O4 ", "04 " },
-    { "O5 ", "05 " },
-    { "O6 ", "06 " },
-    { "O7 ", "07 " },
-    { "O8 ", "08 " },
-    { "O9 ", "09 " },
-  }
-  for _, v := range replaceslice {
-    dt = strings.Replace(dt, v[0], v[1], 1)
-  }
-  return dt
-}
-
-/* ionize() runs through ionosondes in db, downloads ionograms and populates
- * the parameters table in the database.
+/* ionize() is run by cron, it waits a random number of seconds (not to
+ * download ionograms at exactly the same time every time) and then scrapes
+ * all ionosondes with scrape=1.
  */
 func ionize() (error) {
-  // TODO: prepare insert into parameters - statement before for loop starts
-
   rand.Seed(time.Now().UnixNano())
   r := rand.Intn(30)
   log.Infof("Scraping ionograms in %s", time.Duration(r) * time.Second)
   time.Sleep(time.Duration(r) * time.Second)
+  _, err := scrape("where scrape=1")
+  return err
+}
+
+type scrapeStatus int
+
+const (
+  scrapeFailed scrapeStatus = iota
+  scrapeDuplicate
+  scrapeInserted
+  scrapeRejected
+)
+
+// scrapeResult counts the outcome of scraping a set of ionosondes
+type scrapeResult struct {
+  Inserted int
+  Duplicates int
+  Rejected int
+  Failed int
+}
+
+/* scrape() runs through ionosondes in db selected by sqlsuffix (see
+ * getIonosondesFromDb()), downloads ionograms and populates the parameters
+ * table in the database. Ionograms are downloaded and interpreted in
+ * parallel by SCRAPE_WORKERS workers, mu serializes scrape rounds.
+ */
+func scrape(sqlsuffix string, args ...interface{}) (scrapeResult, error) {
+  result := scrapeResult{}
 
   mu.Lock()
   defer mu.Unlock()
 
-  ionosondes, err := getIonosondesFromDb("where scrape=1")
+  ionosondes, err := getIonosondesFromDb(sqlsuffix, args...)
   if err != nil {
-    return err
+    return result, err
   }
 
-  for _, i := range ionosondes {
-    // run an anonymous function inside this loop to be able to use defer
-    func() {
-      p := Parameters{}
-      skipmsg := fmt.Sprintf("Skipping scrape of ionosonde %s (%s)", i.UrsiCode, i.Name)
-      p.IonosondeId = i.IonosondeId
-
-      log.Infof("Scraping %s (%s)", i.UrsiCode, i.Name)
-
-      // download ionogram
-      urls := strings.Split(i.ImageUrl, `,`)
-      var imgFile string
-      var url string
-      var err error
-      for z := range urls {
-        imgFile, err = downloadFile(urls[z], i.UrsiCode)
-        if err == nil {
-          url = urls[z]
-          break
-        }
-      }
-      if err != nil {
-        log.Errorf("Error downloading %v: %v", urls, err)
-        log.Warning(skipmsg)
-        return
+  // download and interpret ionograms with cnf.ScrapeWorkers workers, all
+  // database writes are done here one at a time by storeIonogram()
+  workers := cnf.ScrapeWorkers
+  if workers > len(ionosondes) {
+    workers = len(ionosondes)
+  }
+  queue := make(chan Ionosonde)
+  fetched := make(chan scrapeJob)
+  var wg sync.WaitGroup
+  for w := 0; w < workers; w++ {
+    wg.Add(1)
+    go func() {
+      defer wg.Done()
+      for i := range queue {
+        fetched <- fetchIonogram(i)
       }
-      defer cleanup()
+    }()
+  }
+  go func() {
+    for _, i := range ionosondes {
+      queue <- i
+    }
+    close(queue)
+  }()
+  go func() {
+    wg.Wait()
+    close(fetched)
+  }()
+
+  for job := range fetched {
+    switch storeIonogram(job) {
+      case scrapeInserted:
+        result.Inserted++
+      case scrapeDuplicate:
+        result.Duplicates++
+      case scrapeRejected:
+        result.Rejected++
+      default:
+        result.Failed++
+    }
+  }
+  if cnf.ArchiveDir != "" {
+    if _, err := pruneArchive(); err != nil {
+      log.Errorf("Unable to prune image archive %s: %v", cnf.ArchiveDir, err)
+    }
+  }
+  return result, nil
+}
 
-      // open and decode downloaded image
-      reader, err := os.Open(imgFile)
-      if err != nil {
-        log.Errorf("Cannot open ionogram %s: %v", imgFile, err)
-        log.Warning(skipmsg)
-        return
-      }
-      defer reader.Close()
-      img, _, err := image.Decode(reader)
-      if err != nil {
-        log.Errorf("Cannot decode ionogram %s: %v", imgFile, err)
-        log.Warning(skipmsg)
-        return
-      }
+// dateRecognizers are built once per dateFormat (and DATE_MAXSKEW)
+type dateRecognizerKey struct {
+  layout string
+  maxSkew time.Duration
+}
 
-      // apply filter (if any specified) to img object
-      if i.Filter.Valid {
-        // applyFilter() will return the same img object if filter is empty,
-        // none, nil, etc...
-        img = applyFilter(img, i.Filter.String, i.UrsiCode)
-/** for debug purposes:
-        f, err := os.Create(i.UrsiCode + ".png")
-        if err != nil {
-          log.Errorf("Cannot create file: %v", err)
-        } else {
-          defer f.Close()
-          err = png.Encode(f, img)
-          if err != nil {
-            log.Errorf("Cannot encode png: %v", err)
-          }
-        }
-*/
-      }
+var (
+  dateRecognizersMu sync.Mutex
+  dateRecognizers = map[dateRecognizerKey]*irdate.Recognizer{}
+)
 
-      // getTextFromCut
-      // first get date
-      ocrdt, err := getTextFromCut(img, i.DateCrop)
-      if err != nil {
-        log.Errorf("Cannot read date from ionogram %s: %v", imgFile, err)
-        log.Warning(skipmsg)
-        return
-      }
-      // fix common misinterpretations of the date string
-      dt := fixDate(ocrdt)
-      if dt != ocrdt {
-        log.Infof("fixDate() changed '%s' to '%s'", ocrdt, dt)
-      }
-      // parse fixed date into time.Time
-      p.Date, err = time.Parse(i.DateFormat, dt)
-      if err != nil {
-        log.Errorf("Cannot parse '%s' (according to format %s) from %s: %v", dt, i.DateFormat, imgFile, err)
-        log.Warning(skipmsg)
-        return
-      }
-      // populate parameters struct, as they are all float64 we can loop through them.
-      // the indexes of these slice pairs need to match exactly...
-      // QRG = frequency, to omit invalid values (only accept valus betweeen
-      // 0.5 and 19.0 MHz)
-      irQRG := []*sql.NullString{ &i.Fof2Crop, &i.Fof1Crop, &i.FoeCrop, &i.FxiCrop,
-                                &i.FoesCrop, &i.FminCrop }
-      prQRG := []*sql.NullFloat64{ &p.FoF2, &p.FoF1, &p.FoE, &p.FxI, &p.FoEs, &p.Fmin  }
-      // QAH = elevation, to omit invalid ionosphere height (only accept values
-      // beetween 60.0 and 999.0 km)
-      irQAH := []*sql.NullString{ &i.Hmf2Crop, &i.HmeCrop }
-      prQAH := []*sql.NullFloat64{ &p.HmF2, &p.HmE }
-
-      for x := range irQRG {
-        if irQRG[x].Valid {
-          v, err := getTextFromCutFloat64(img, irQRG[x].String)
-          if err == nil {
-            if v >= 0.5 && v <= 19.0 {
-              prQRG[x].Float64 = v
-              prQRG[x].Valid = true
-            } else {
-              log.Warningf("Invalid frequency on %s ionogram, skipping: %f", i.UrsiCode, v)
-            }
-          }
-          // bool is false by default, so Valid will be false if not set
-        }
-      }
-      for x := range irQAH {
-        if irQAH[x].Valid {
-          v, err := getTextFromCutFloat64(img, irQAH[x].String)
-          if err == nil {
-            if v >= 60.0 && v <= 999.0 {
-              prQAH[x].Float64 = v
-              prQAH[x].Valid = true
-            } else {
-              log.Warningf("Invalid height on %s ionogram, skipping: %f", i.UrsiCode, v)
-            }
-          }
-        }
-      }
+/* dateRecognizer() returns the date recognizer of layout, shared by all
+ * ionosondes (and workers) using it.
+ */
+func dateRecognizer(layout string) (*irdate.Recognizer, error) {
+  dateRecognizersMu.Lock()
+  defer dateRecognizersMu.Unlock()
+  key := dateRecognizerKey{ layout, cnf.DateMaxSkew }
+  if r, ok := dateRecognizers[key]; ok {
+    return r, nil
+  }
+  r, err := irdate.New(layout, cnf.DateMaxSkew)
+  if err != nil {
+    return nil, err
+  }
+  dateRecognizers[key] = r
+  return r, nil
+}
 
-      // populate the parameters table in the database, but first...
-      // check if we already have this metric...
-      var countStr string
-      err = db.QueryRow(fmt.Sprintf("select count(*) from parameters " +
-                        "where ionosondeId=%s and dt='%s'",
-                        i.IonosondeId, p.Date.Format(SqliteDateFormat))).Scan(&countStr)
-      if err != nil {
-        log.Errorf("QueryRow failed: %v", err)
-        log.Warning(skipmsg)
-        return
-      }
-      count, err := strconv.Atoi(countStr)
-      if err != nil {
-        log.Errorf("strconv.Atoi() failed: %v", err)
-        log.Warning(skipmsg)
-        return
-      }
-      if count > 0 {
-        log.Warningf("Skipping parameters from %s with time %s, already in database", i.UrsiCode, p.Date.Format(i.DateFormat))
-        return
-      }
-      // insert into parameters table...
-      _, err = db.Exec("insert into parameters (ionosondeId, " +
-          "dt, fof2, fof1, foe, fxi, foes, fmin, hme, hmf2) " +
-          "values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
-          i.IonosondeId, p.Date.Format(SqliteDateFormat), p.FoF2, p.FoF1,
-          p.FoE, p.FxI, p.FoEs, p.Fmin, p.HmE, p.HmF2)
+/* recognizeDate() returns the date in ocrdt, the OCR output of the date crop
+ * of an ionosonde, written according to its dateFormat.
+ */
+func recognizeDate(i Ionosonde, ocrdt string, downloaded time.Time) (time.Time, error) {
+  r, err := dateRecognizer(i.DateFormat)
+  if err != nil {
+    return time.Time{}, fmt.Errorf("Invalid dateFormat of %s: %v", i.UrsiCode, err)
+  }
+  res, err := r.Recognize(ocrdt, downloaded)
+  if err != nil {
+    return time.Time{}, fmt.Errorf("Cannot parse date in %s ionogram: %v", i.UrsiCode, err)
+  }
+  if res.Cost > 0 {
+    log.Infof("Recognized '%s' in %s ionogram as '%s' (correction cost %.1f)", ocrdt, i.UrsiCode, res.Text, res.Cost)
+  }
+  return res.Time, nil
+}
+
+/* interpretIonogram() applies the filter of the ionosonde to img and reads
+ * the date and parameters from the crop boxes (located from the labels if
+ * configured, see locate.go) using the OCR engine of the ionosonde, missing
+ * values are digitized from the traces if configured (see trace.go). The
+ * date is recognized by irdate, correcting common OCR mistakes and
+ * rejecting dates further than DATE_MAXSKEW from downloaded (when the
+ * ionogram was downloaded, zero to skip the check). Values are not
+ * validated, see validateParameters(). An error is returned if the date can
+ * not be read or recognized.
+ */
+func interpretIonogram(i Ionosonde, img image.Image, downloaded time.Time) (Parameters, error) {
+  p := Parameters{}
+  p.IonosondeId = i.IonosondeId
+  engine, err := ocrForIonosonde(i)
+  if err != nil {
+    return p, err
+  }
+
+  // the traces are digitized in the original colors
+  orig := img
+  // apply filter (if any specified) to img object
+  if i.Filter.Valid {
+    // applyFilter() will return the same img object if filter is empty,
+    // none, nil, etc...
+    img, err = applyFilter(img, i.Filter.String, i.UrsiCode)
+    if err != nil {
+      return p, err
+    }
+/** for debug purposes:
+    f, err := os.Create(i.UrsiCode + ".png")
+    if err != nil {
+      log.Errorf("Cannot create file: %v", err)
+    } else {
+      defer f.Close()
+      err = png.Encode(f, img)
       if err != nil {
-        log.Errorf("Unable to insert ionogram data into parameters table: %v", err)
-        log.Warning(skipmsg)
-        return
+        log.Errorf("Cannot encode png: %v", err)
       }
-      log.Infof("Scraped %s (%s) ionogram %s from %s", i.UrsiCode, i.Name, p.Date.Format(i.DateFormat), url)
-    }()
+    }
+*/
+  }
+
+  // move the crops to where the labels are, if the ionosonde has an anchorCrop
+  i = locateCropsOrFallback(i, engine, img, downloaded)
+
+  // getTextFromCut
+  // first get date
+  opts, err := ocrOptions(i, ocrFieldDate)
+  if err != nil {
+    return p, err
+  }
+  ocrdt, dtConf, err := getTextFromCut(engine, opts, img, i.DateCrop)
+  if err != nil {
+    return p, fmt.Errorf("Cannot read date from %s ionogram: %v", i.UrsiCode, err)
+  }
+  // correct common misinterpretations of the date string and parse it
+  p.Date, err = recognizeDate(i, ocrdt, downloaded)
+  if err != nil {
+    return p, err
   }
-  return nil
+  p.DtConf = sql.NullFloat64{ Float64: dtConf, Valid: true }
+  // populate parameters struct, as they are all float64 we can loop
+  // through them, validateParameters() checks the values
+  crops := map[string]sql.NullString{
+    "foF2": i.Fof2Crop, "foF1": i.Fof1Crop, "foE": i.FoeCrop, "fxI": i.FxiCrop,
+    "foEs": i.FoesCrop, "fmin": i.FminCrop, "hmF2": i.Hmf2Crop, "hmE": i.HmeCrop,
+  }
+  for _, v := range p.values() {
+    crop := crops[v.Name]
+    if ! crop.Valid {
+      continue
+    }
+    opts, err := ocrOptions(i, v.Name)
+    if err != nil {
+      return p, err
+    }
+    f, conf, err := getTextFromCutFloat64(engine, opts, img, crop.String)
+    if err != nil {
+      // bool is false by default, so Valid will be false if not set
+      continue
+    }
+    *v.Conf = sql.NullFloat64{ Float64: conf, Valid: true }
+    if i.OcrMinConfidence.Valid && conf < i.OcrMinConfidence.Float64 {
+      log.Warningf("Discarding %s %g on %s ionogram, OCR confidence %.0f is below %.0f", v.Name, f,
+                   i.UrsiCode, conf, i.OcrMinConfidence.Float64)
+      continue
+    }
+    *v.Value = sql.NullFloat64{ Float64: f, Valid: true }
+  }
+  if err := digitizeMissing(i, orig, &p); err != nil {
+    return p, err
+  }
+  return p, nil
 }
 
+/* scrapeJob is the state of scraping one ionosonde, passed from a worker
+ * (fetchIonogram()) to the writer (storeIonogram()). ImgFile belongs to the
+ * job and is removed by the writer.
+ */
+type scrapeJob struct {
+  Ionosonde Ionosonde
+  Parameters Parameters
+  Url string
+  ImgFile string
+  LastModified time.Time
+  Hash string
+  Start time.Time
+  Failed bool
+  Rejected string       // reason, see plausibility.go
+  RejectDetail string
+  Earlier []Parameters  // older records of scaled data, oldest first
+}
 
+func (j scrapeJob) skipmsg() (string) {
+  return fmt.Sprintf("Skipping scrape of ionosonde %s (%s)", j.Ionosonde.UrsiCode, j.Ionosonde.Name)
+}
 
+/* fetchIonogram() downloads and interprets the ionogram of one ionosonde
+ * (or its scaled data, see scaled.go), it does not touch the database and
+ * is safe to run concurrently.
+ */
+func fetchIonogram(i Ionosonde) (scrapeJob) {
+  job := scrapeJob{ Ionosonde: i, Start: time.Now() }
+  // measured here, not in storeIonogram(), so waiting for the writer is not
+  // part of the scrape duration
+  defer func() {
+    metricScrapeDuration.Observe(time.Since(job.Start).Seconds(), i.UrsiCode)
+  }()
+
+  log.Infof("Scraping %s (%s)", i.UrsiCode, i.Name)
+
+  if i.sourceType() != sourceImage {
+    return fetchScaledData(job)
+  }
 
+  // download ionogram
+  urls := strings.Split(i.ImageUrl, `,`)
+  var err error
+  for z := range urls {
+    var d download
+    d, err = downloadFile(urls[z], i.UrsiCode)
+    if err == nil {
+      job.Url = urls[z]
+      job.ImgFile, job.LastModified, job.Hash = d.File, d.LastModified, d.Hash
+      break
+    }
+  }
+  if err != nil {
+    log.Errorf("Error downloading %v: %v", urls, err)
+    log.Warning(job.skipmsg())
+    metricDownloadFailures.Inc(i.UrsiCode)
+    job.Failed = true
+    return job
+  }
+
+  // open and decode downloaded image
+  img, err := loadImage(job.ImgFile)
+  if err != nil {
+    log.Errorf("Cannot decode ionogram %s: %v", job.ImgFile, err)
+    log.Warning(job.skipmsg())
+    metricDownloadFailures.Inc(i.UrsiCode)
+    job.Failed = true
+    return job
+  }
+
+  // no need to interpret an image the station has been serving for too long
+  if job.Rejected, job.RejectDetail = checkStaleImage(job); job.Rejected != "" {
+    return job
+  }
+
+  job.Parameters, err = interpretIonogram(i, img, job.Start)
+  if err != nil {
+    log.Errorf("%v from %s", err, job.ImgFile)
+    log.Warning(job.skipmsg())
+    metricOcrFailures.Inc(i.UrsiCode)
+    job.Failed = true
+    return job
+  }
+  job.Rejected, job.RejectDetail = checkPlausibleDate(job)
+  return job
+}
+
+/* storeIonogram() inserts the parameters of a fetched job into the database
+ * (unless already there), archives the image and removes the downloaded
+ * file. Only one storeIonogram() may run at a time.
+ */
+func storeIonogram(job scrapeJob) (scrapeStatus) {
+  i := job.Ionosonde
+  p := job.Parameters
+  skipmsg := job.skipmsg()
+  defer func() {
+    if job.ImgFile != "" {
+      os.Remove(job.ImgFile)
+    }
+  }()
+  // also when interpreting failed, so a broken image served over and over
+  // is found stale and not interpreted again
+  updateLastImageHash(job)
+  if job.Failed {
+    return scrapeFailed
+  }
+  if job.Rejected != "" {
+    log.Warningf("Rejected %s ionogram from %s (%s): %s", i.UrsiCode, job.Url, job.Rejected, job.RejectDetail)
+    metricRejections.Inc(i.UrsiCode, job.Rejected)
+    if err := recordRejection(job); err != nil {
+      log.Errorf("Unable to record rejection of %s ionogram: %v", i.UrsiCode, err)
+    }
+    return scrapeRejected
+  }
+
+  // older records of scaled data first, a duplicate is the normal case
+  for n := range job.Earlier {
+    e := job.Earlier[n]
+    status, _, err := insertParameters(i, &e)
+    if err != nil {
+      log.Errorf("Unable to insert %s parameters %s: %v", i.UrsiCode, e.Date.Format(SqliteDateFormat), err)
+    } else if status == scrapeInserted {
+      log.Infof("Inserted earlier %s (%s) parameters %s from %s", i.UrsiCode, i.Name,
+                e.Date.Format(SqliteDateFormat), job.Url)
+      metricInserts.Inc(i.UrsiCode)
+    }
+  }
+
+  status, parameterId, err := insertParameters(i, &p)
+  if err != nil {
+    log.Errorf("%v", err)
+    log.Warning(skipmsg)
+    return scrapeFailed
+  }
+  if status == scrapeDuplicate {
+    log.Warningf("Skipping parameters from %s with time %s, already in database", i.UrsiCode, p.Date.Format(i.DateFormat))
+    metricDuplicates.Inc(i.UrsiCode)
+    return scrapeDuplicate
+  }
+  log.Infof("Scraped %s (%s) ionogram %s from %s", i.UrsiCode, i.Name, p.Date.Format(i.DateFormat), job.Url)
+  if cnf.ArchiveDir != "" && job.ImgFile != "" {
+    // a failing archive does not make the scrape fail
+    if err := archiveImage(i, parameterId, p.Date, job.Start, job.Url, job.ImgFile); err != nil {
+      log.Errorf("Unable to archive %s ionogram %s: %v", i.UrsiCode, job.ImgFile, err)
+    }
+  }
+  metricInserts.Inc(i.UrsiCode)
+  setParameterGauges(i.UrsiCode, p)
+  return scrapeInserted
+}
+
+
+
+
+
+/* insertParameters() validates p (setting its flags) and inserts it into the
+ * parameters table unless the ionosonde already has a row at the same time
+ * (scrapeDuplicate). Returns scrapeInserted and the parameterId of the new
+ * row otherwise.
+ */
+func insertParameters(i Ionosonde, p *Parameters) (scrapeStatus, int64, error) {
+  var count int
+  err := db.QueryRow("select count(*) from parameters where ionosondeId=? and dt=?",
+                     i.IonosondeId, p.Date.Format(SqliteDateFormat)).Scan(&count)
+  if err != nil {
+    return scrapeFailed, 0, fmt.Errorf("QueryRow failed: %v", err)
+  }
+  if count > 0 {
+    return scrapeDuplicate, 0, nil
+  }
+  // flag suspicious values...
+  prev, err := getPreviousParametersFromDb(i.IonosondeId, p.Date, "")
+  if err != nil {
+    return scrapeFailed, 0, fmt.Errorf("Unable to query previous parameters of %s: %v", i.UrsiCode, err)
+  }
+  validateParameters(p, prev)
+  if flagged := flaggedValues(p); len(flagged) > 0 {
+    log.Warningf("Flagged values on %s ionogram %s: %s", i.UrsiCode, p.Date.Format(i.DateFormat),
+                 strings.Join(flagged, ", "))
+  }
+  values := append([]interface{}{ i.IonosondeId, p.Date.Format(SqliteDateFormat) }, p.columnValues()...)
+  res, err := db.Exec("insert into parameters (ionosondeId, dt, " + parameterColumns + ") " +
+      "values (?" + strings.Repeat(", ?", len(values) - 1) + ")", values...)
+  if err != nil {
+    return scrapeFailed, 0, fmt.Errorf("Unable to insert ionogram data into parameters table: %v", err)
+  }
+  parameterId, err := res.LastInsertId()
+  if err != nil {
+    return scrapeFailed, 0, err
+  }
+  return scrapeInserted, parameterId, nil
+}
+
+/* nvisRange() returns the NVIS range as a string, the lower limit is foE or fmin
+ * (whichever is available and below the upper limit) and the upper limit is
+ * qsoqrg (foF2*0.85).
+ */
+func nvisRange(qsoqrg float64, foe, fmin sql.NullFloat64) (string) {
+  if foe.Valid && foe.Float64 < qsoqrg {
+    return fmt.Sprintf("%.2f-%.2f", foe.Float64, qsoqrg)
+  } else if fmin.Valid && fmin.Float64 < qsoqrg {
+    return fmt.Sprintf("%.2f-%.2f", fmin.Float64, qsoqrg)
+  }
+  return fmt.Sprintf("?-%.2f", qsoqrg)
+}
+
+/* usableHamBands() lists ham bands (in meters) that fit between the lowest
+ * reflected frequency and the upper NVIS frequency (qsoqrg).
+ */
+func usableHamBands(low, qsoqrg float64) ([]string) {
+  hb := []string{}
+  if low <= 2.0 && qsoqrg >= 1.8 {
+    hb = append(hb, "160")
+  }
+  if low <= 3.8 && qsoqrg >= 3.5 {
+    hb = append(hb, "80")
+  }
+  if low <= 5.3665 && qsoqrg >= 5.3515 {
+    hb = append(hb, "60")
+  }
+  if low <= 7.2 && qsoqrg >= 7.0 {
+    hb = append(hb, "40")
+  }
+  if low <= 10.15 && qsoqrg >= 10.1 {
+    hb = append(hb, "30")
+  }
+  return hb
+}
 
 /* makeDailyReports() is used by pushDailyReports() to make a text table of foF2
  * and other parameters with hourly averages over the last 24 hours.
@@ -903,9 +1038,11 @@ func makeDailyReports() ([]string, error) {
         r += "WARNING: No coordinates available!\n"
       }
       r += "NVIS range is fmin or foE to foF2*0.85\n"
+      // flagged values (see validate.go) are left out
       rows, err := db.Query(
-        "select strftime('%H', dt), avg(fof2), avg(fof2)*0.85, avg(foe), avg(fmin), " +
-        "avg(hmf2), avg(hme) from parameters where ionosondeId=? and " +
+        "select strftime('%H', dt), avg(" + goodColumn("fof2") + "), avg(" + goodColumn("fof2") + ")*0.85, " +
+        "avg(" + goodColumn("foe") + "), avg(" + goodColumn("fmin") + "), " +
+        "avg(" + goodColumn("hmf2") + "), avg(" + goodColumn("hme") + ") from parameters where ionosondeId=? and " +
         "dt >= datetime('now','-1 days') and dt < datetime('now') " +
         "group by strftime('%H', dt) order by dt", i.IonosondeId)
       if err != nil {
@@ -958,15 +1095,7 @@ func makeDailyReports() ([]string, error) {
         }
         if frp.FoF2.Valid {
           rs.fof2 = fmt.Sprintf("%-5.2f", frp.FoF2.Float64)
-          if frp.FoE.Valid && frp.FoE.Float64 < frp.QSOQRG.Float64 {
-            rs.nvisRange = fmt.Sprintf("%-11s", fmt.Sprintf("%.2f-%.2f", frp.FoE.Float64, frp.QSOQRG.Float64))
-            rs.low = frp.FoE.Float64
-          } else if frp.Fmin.Valid && frp.Fmin.Float64 < frp.QSOQRG.Float64 {
-            rs.nvisRange = fmt.Sprintf("%-11s", fmt.Sprintf("%.2f-%.2f", frp.Fmin.Float64 , frp.QSOQRG.Float64))
-            rs.low = frp.Fmin.Float64
-          } else {
-            rs.nvisRange = fmt.Sprintf("%-11s", fmt.Sprintf("?-%.2f", frp.QSOQRG.Float64))
-          }
+          rs.nvisRange = fmt.Sprintf("%-11s", nvisRange(frp.QSOQRG.Float64, frp.FoE, frp.Fmin))
         }
         if frp.FoE.Valid {
           rs.foe = fmt.Sprintf("%-5.2f", frp.FoE.Float64)
@@ -986,24 +1115,8 @@ func makeDailyReports() ([]string, error) {
           rs.low = rs.qsoqrg
         }
         // list usable ham bands
-        hb := []string{}
         if rs.qsoqrg > 0 { // if rs.qsoqrg is above 0, so is rs.low
-          if rs.low <= 2.0 && rs.qsoqrg >= 1.8 {
-            hb = append(hb, "160")
-          }
-          if rs.low <= 3.8 && rs.qsoqrg >= 3.5 {
-            hb = append(hb, "80")
-          }
-          if rs.low <= 5.3665 && rs.qsoqrg >= 5.3515 {
-            hb = append(hb, "60")
-          }
-          if rs.low <= 7.2 && rs.qsoqrg >= 7.0 {
-            hb = append(hb, "40")
-          }
-          if rs.low <= 10.15 && rs.qsoqrg >= 10.1 {
-            hb = append(hb, "30")
-          }
-          if len(hb) > 0 {
+          if hb := usableHamBands(rs.low, rs.qsoqrg); len(hb) > 0 {
             rs.hamBands = strings.Join(hb, ",")
           }
         }
@@ -1012,115 +1125,274 @@ func makeDailyReports() ([]string, error) {
         r += fmt.Sprintf(reportRow, frp.Hour, rs.tag, rs.fmin,
                   rs.fof2, rs.nvisRange, rs.hmf2, rs.hamBands)
       }
+      // OCR confidence of foF2 over the same period, if the engine reports it
+      var confAvg, confMin sql.NullFloat64
+      err = db.QueryRow("select avg(fof2Conf), min(fof2Conf) from parameters where ionosondeId=? and " +
+                        "dt >= datetime('now','-1 days') and dt < datetime('now')",
+                        i.IonosondeId).Scan(&confAvg, &confMin)
+      if err != nil {
+        log.Errorf("Database query failed, cannot add OCR confidence to report for %s ionosonde: %v", i.UrsiCode, err)
+      } else if confAvg.Valid {
+        r += fmt.Sprintf("foF2 OCR confidence avg %.0f%% min %.0f%%\n", confAvg.Float64, confMin.Float64)
+      }
       // here we have a complete report (in the r var) for this ionosonde
       // append report to output
       out = append(out, r)
+      // the forecast is a separate message to stay within message size limits
+      if cnf.Forecast {
+        f, err := makeForecastReport(i)
+        if err != nil {
+          log.Errorf("Unable to make forecast for %s ionosonde: %v", i.UrsiCode, err)
+          return
+        }
+        out = append(out, f)
+      }
     }()
   }
   return out, nil
 }
 
-/* pushDailyReports() pushes the report created by makeDailyReports() to a
- * configured Discord integration URL (cnf.DiscordDailyWebhookUrl).
+/* makeForecastReport() is used by makeDailyReports() to make a text table with
+ * predicted foF2, NVIS range and usable ham bands for each hour of the next 24
+ * hours. The prediction is made from the last cnf.ForecastDays days of history
+ * in the parameters table using the cnf.ForecastMethod predictor. The caller
+ * is expected to hold the mu mutex.
  */
-func pushDailyReports() (error) {
-  if ! cnf.Daily {
-    log.Warningf("Option DAILY is false, will not push daily reports!")
-    return nil
+func makeForecastReport(i Ionosonde) (string, error) {
+  const (
+    notAvailable string = `NA`
+    reportHeader string = "HH foF2  NVIS range  HamBands\n"
+    reportRow string = "%s %s %s %s\n"
+  )
+  predictor, err := irpredict.New(cnf.ForecastMethod, cnf.ForecastDays)
+  if err != nil {
+    return "", err
   }
-
-  reports, err := makeDailyReports()
-
+  rows, err := db.Query("select dt, " + goodColumn("fof2") + ", " + goodColumn("foe") + ", " +
+                        goodColumn("fmin") + " from parameters " +
+                        "where ionosondeId=? and dt >= datetime('now', ?) " +
+                        "order by dt", i.IonosondeId, fmt.Sprintf("-%d days", cnf.ForecastDays))
   if err != nil {
-    log.Errorf("Unable to makeDailyReports(): %v", err)
-    return err
+    return "", err
+  }
+  defer rows.Close()
+  var fof2s, foes, fmins []irpredict.Sample
+  for rows.Next() {
+    p := Parameters{}
+    err = rows.Scan(&p.Date, &p.FoF2, &p.FoE, &p.Fmin)
+    if err != nil {
+      return "", err
+    }
+    if p.FoF2.Valid {
+      fof2s = append(fof2s, irpredict.Sample{ Time: p.Date, Value: p.FoF2.Float64 })
+    }
+    if p.FoE.Valid {
+      foes = append(foes, irpredict.Sample{ Time: p.Date, Value: p.FoE.Float64 })
+    }
+    if p.Fmin.Valid {
+      fmins = append(fmins, irpredict.Sample{ Time: p.Date, Value: p.Fmin.Float64 })
+    }
+  }
+  if err = rows.Err(); err != nil {
+    return "", err
+  }
+  now := time.Now().UTC()
+  r := fmt.Sprintf("NEXT 24H %s (%s) DTG %s\n", i.UrsiCode, i.Name, now.Format(DTGFormat))
+  r += fmt.Sprintf("Forecast %s\n", predictor)
+  r += reportHeader
+  for h := 1; h <= 24; h++ {
+    at := now.Truncate(time.Hour).Add(time.Duration(h) * time.Hour)
+    fof2 := fmt.Sprintf("%-5s", notAvailable)
+    nvis := fmt.Sprintf("%-11s", notAvailable)
+    hamBands := notAvailable
+    var foe, fmin sql.NullFloat64
+    foe.Float64, foe.Valid = predictor.Predict(foes, at)
+    fmin.Float64, fmin.Valid = predictor.Predict(fmins, at)
+    if v, ok := predictor.Predict(fof2s, at); ok && v > 0 {
+      qsoqrg := v * 0.85
+      fof2 = fmt.Sprintf("%-5.2f", v)
+      nvis = fmt.Sprintf("%-11s", nvisRange(qsoqrg, foe, fmin))
+      low := qsoqrg
+      if fmin.Valid {
+        low = fmin.Float64
+      } else if foe.Valid {
+        low = foe.Float64
+      }
+      if hb := usableHamBands(low, qsoqrg); len(hb) > 0 {
+        hamBands = strings.Join(hb, ",")
+      }
+    }
+    r += fmt.Sprintf(reportRow, at.Format(Hour), fof2, nvis, hamBands)
   }
+  return r, nil
+}
+
+/* pushReports() posts reports to Discord and/or Slack depending on
+ * configuration, kind is used in log messages (daily, frequent, etc). All
+ * reports are posted even if some fail, the last error is returned.
+ */
+func pushReports(reports []string, kind, discordUrl, slackUrl, slackHeader string) (error) {
+  var lastErr error
   pluralSuffix := ""
   if len(reports) > 0 { pluralSuffix = "s" }
   if cnf.Discord && ! cnf.Slack {
-    log.Infof("Posting daily report%s to Discord", pluralSuffix)
+    log.Infof("Posting %s report%s to Discord", kind, pluralSuffix)
   } else if ! cnf.Discord && cnf.Slack {
-    log.Infof("Posting daily report%s to Slack", pluralSuffix)
+    log.Infof("Posting %s report%s to Slack", kind, pluralSuffix)
   } else if cnf.Discord && cnf.Slack {
-    log.Infof("Posting daily report%s to Slack and Discord", pluralSuffix)
+    log.Infof("Posting %s report%s to Slack and Discord", kind, pluralSuffix)
   }
   for i := range reports {
     report := "```\n" + reports[i] + "\n```\n"
     if cnf.Discord {
-      err := irmsg.SendDiscordMsg(cnf.DiscordDailyWebhookUrl, report)
+      err := irmsg.SendDiscordMsg(discordUrl, report)
       if err != nil {
         log.Errorf("Unable to post message to Discord: %v", err)
+        lastErr = err
       }
     }
     if cnf.Slack {
-      err := irmsg.SendSlackMsg(cnf.SlackDailyWebhookUrl, "24H report", report)
+      err := irmsg.SendSlackMsg(slackUrl, slackHeader, report)
       if err != nil {
         log.Errorf("Unable to post message to Slack: %v", err)
+        lastErr = err
       }
     }
-    time.Sleep(5 * time.Second)
+    if i < len(reports)-1 {
+      time.Sleep(5 * time.Second)
+    }
   }
-  return nil
+  return lastErr
 }
 
+/* pushDailyReports() pushes the report created by makeDailyReports() to a
+ * configured Discord integration URL (cnf.DiscordDailyWebhookUrl).
+ */
+func pushDailyReports() (error) {
+  if ! cnf.Daily {
+    log.Warningf("Option DAILY is false, will not push daily reports!")
+    return nil
+  }
 
+  reports, err := makeDailyReports()
 
-
-/* I have kept the linear regression prediction code commented out for later
- * use. This will be repurposed in a future feature release where the daily
- * report will also contain a prediction for the next 24 hours.
- *
-type Point struct {
-  X float64
-  Y float64
-}
-func linearRegressionLSEnextVal(series []Point, nextX float64) float64 {
-  // inspired by https://stackoverflow.com/a/16423799
-  q := len(series)
-  if q == 0 {
-    return 0
-  }
-  p := float64(q)
-  sum_x, sum_y, sum_xx, sum_xy := 0.0, 0.0, 0.0, 0.0
-  for _, p := range series {
-    sum_x += p.X
-    sum_y += p.Y
-    sum_xx += p.X * p.X
-    sum_xy += p.X * p.Y
-  }
-  m := (p*sum_xy - sum_x*sum_y) / (p*sum_xx - sum_x*sum_x)
-  b := (sum_y / p) - (m * sum_x / p)
-  return nextX * m + b
+  if err != nil {
+    log.Errorf("Unable to makeDailyReports(): %v", err)
+    return err
+  }
+  return pushReports(reports, "daily", cnf.DiscordDailyWebhookUrl, cnf.SlackDailyWebhookUrl, dailySlackHeader)
 }
 
-func makePredictions(ips []IonogramParameters) ([]IonogramParameters) {
-  var foF2s []Point
-  var foEs []Point
-  var fxIs []Point
-  var predictions []IonogramParameters
-  for _, ip := range ips {
-    if ip.FoF2 >= 1 {
-      foF2s = append(foF2s, Point{ X: float64(len(foF2s)+1), Y: float64(ip.FoF2),})
+
+/* makeFrequentReport() is used by pushFrequentReports() to make a text table
+ * of the latest scraped parameters from every enabled ionosonde. Rows older
+ * than cnf.FrequentStaleAfter are flagged as stale.
+ */
+func makeFrequentReport() (string, error) {
+  const (
+    notAvailable string = `NA`
+    reportHeader string = "URSI  Age  fmin  foE   foF2  NVIS range  hmF2 HamBands\n"
+    reportRow string = "%-5s %s %s %s %s %s %s %s\n"
+  )
+  log.Info("Producing frequent report")
+  ionosondes, err := getIonosondesFromDb("where enabled=1")
+  if err != nil {
+    return "", err
+  }
+  mu.Lock()
+  defer mu.Unlock()
+  now := time.Now().UTC()
+  r := fmt.Sprintf("NOW DTG %s\n", now.Format(DTGFormat))
+  r += "NVIS range is fmin or foE to foF2*0.85\n"
+  r += reportHeader
+  stale := false
+  for _, i := range ionosondes {
+    p := Parameters{}
+    err := db.QueryRow("select dt, " + goodColumn("fof2") + ", " + goodColumn("foe") + ", " +
+                       goodColumn("fmin") + ", " + goodColumn("hmf2") + " from parameters " +
+                       "where ionosondeId=? order by dt desc limit 1",
+                       i.IonosondeId).Scan(&p.Date, &p.FoF2, &p.FoE, &p.Fmin, &p.HmF2)
+    if err == sql.ErrNoRows {
+      r += fmt.Sprintf(reportRow, i.UrsiCode, fmt.Sprintf("%-4s", notAvailable),
+                       fmt.Sprintf("%-5s", notAvailable), fmt.Sprintf("%-5s", notAvailable),
+                       fmt.Sprintf("%-5s", notAvailable), fmt.Sprintf("%-11s", notAvailable),
+                       fmt.Sprintf("%-4s", notAvailable), notAvailable)
+      continue
+    } else if err != nil {
+      log.Errorf("Database query failed, cannot produce frequent report for %s ionosonde: %v", i.UrsiCode, err)
+      continue
+    }
+    age := now.Sub(p.Date)
+    ageStr := fmt.Sprintf("%-4s", formatAge(age))
+    if age > cnf.FrequentStaleAfter {
+      ageStr = fmt.Sprintf("%-4s", formatAge(age) + "!")
+      stale = true
     }
-    if ip.FoE >= 1 {
-      foEs = append(foEs, Point{ X: float64(len(foEs)+1), Y: float64(ip.FoE),})
+    fmin := fmt.Sprintf("%-5s", notAvailable)
+    foe := fmt.Sprintf("%-5s", notAvailable)
+    fof2 := fmt.Sprintf("%-5s", notAvailable)
+    nvis := fmt.Sprintf("%-11s", notAvailable)
+    hmf2 := fmt.Sprintf("%-4s", notAvailable)
+    hamBands := notAvailable
+    if p.Fmin.Valid {
+      fmin = fmt.Sprintf("%-5.2f", p.Fmin.Float64)
     }
-    if ip.FxI >= 1 {
-      fxIs = append(fxIs, Point{ X: float64(len(fxIs)+1), Y: float64(ip.FxI),})
+    if p.FoE.Valid {
+      foe = fmt.Sprintf("%-5.2f", p.FoE.Float64)
     }
+    if p.HmF2.Valid {
+      hmf2 = fmt.Sprintf("%-4.0f", p.HmF2.Float64)
+    }
+    if p.FoF2.Valid {
+      qsoqrg := p.FoF2.Float64 * 0.85
+      fof2 = fmt.Sprintf("%-5.2f", p.FoF2.Float64)
+      nvis = fmt.Sprintf("%-11s", nvisRange(qsoqrg, p.FoE, p.Fmin))
+      low := qsoqrg
+      if p.Fmin.Valid {
+        low = p.Fmin.Float64
+      } else if p.FoE.Valid {
+        low = p.FoE.Float64
+      }
+      if hb := usableHamBands(low, qsoqrg); len(hb) > 0 {
+        hamBands = strings.Join(hb, ",")
+      }
+    }
+    r += fmt.Sprintf(reportRow, i.UrsiCode, ageStr, fmin, foe, fof2, nvis, hmf2, hamBands)
   }
-  log.Infof("foF2 predictions: %v", foF2s)
-  log.Infof("fxI predictions: %v", fxIs)
-  for i := 1; i < cnf.Predictions+1 ; i++ {
-    var pip IonogramParameters
-    pip.FoF2 = float64( linearRegressionLSEnextVal(foF2s, float64(len(foF2s)+i)) )
-    pip.FoE = float64( linearRegressionLSEnextVal(foEs, float64(len(foEs)+i)) )
-    pip.FxI = float64( linearRegressionLSEnextVal(fxIs, float64(len(fxIs)+i)) )
-    predictions = append(predictions, pip)
+  if stale {
+    r += fmt.Sprintf("! = stale, older than %s\n", cnf.FrequentStaleAfter)
   }
-  return predictions
+  return r, nil
+}
+
+/* pushFrequentReports() pushes the report created by makeFrequentReport() to
+ * the configured frequent Discord and/or Slack webhook URLs.
+ */
+func pushFrequentReports() (error) {
+  if ! cnf.Frequent {
+    log.Warningf("Option FREQUENT is false, will not push frequent reports!")
+    return nil
+  }
+  report, err := makeFrequentReport()
+  if err != nil {
+    log.Errorf("Unable to makeFrequentReport(): %v", err)
+    return err
+  }
+  return pushReports([]string{report}, "frequent", cnf.DiscordFrequentWebhookUrl, cnf.SlackFrequentWebhookUrl, frequentSlackHeader)
+}
+
+/* formatAge() formats a duration as a short age string, e.g 45m or 3h. */
+func formatAge(d time.Duration) (string) {
+  if d < 0 {
+    d = 0
+  }
+  if d < time.Hour {
+    return fmt.Sprintf("%dm", int(d.Minutes()))
+  } else if d < 100 * time.Hour {
+    return fmt.Sprintf("%dh", int(d.Hours()))
+  }
+  return fmt.Sprintf("%dd", int(d.Hours() / 24))
 }
-*/
 
 
 
@@ -1156,6 +1428,34 @@ func main() {
     log.Fatalf("envconfig.Process failed: %v", err)
   }
 
+  if err := validateOcrEngine(cnf.OcrEngine); err != nil {
+    log.Fatalf("Invalid OCR_ENGINE: %v", err)
+  }
+
+  if cnf.ScrapeWorkers < 1 {
+    log.Fatalf("SCRAPE_WORKERS must be at least 1")
+  }
+
+  if cnf.DateMaxSkew < 0 || cnf.DateMaxAge < 0 || cnf.DateMaxFuture < 0 || cnf.DateCadence < 0 {
+    log.Fatalf("DATE_MAXSKEW, DATE_MAXAGE, DATE_MAXFUTURE and DATE_CADENCE can not be negative")
+  }
+  if cnf.DidbaseWindow <= 0 {
+    log.Fatalf("DIDBASE_WINDOW must be positive")
+  }
+
+  if cnf.ArchiveDir != "" {
+    if err := validateArchiveLayout(cnf.ArchiveLayout); err != nil {
+      log.Fatalf("Invalid ARCHIVE_LAYOUT: %v", err)
+    }
+    if cnf.ArchiveRetentionDays < 0 || cnf.ArchiveMaxSize < 0 {
+      log.Fatalf("ARCHIVE_RETENTION_DAYS and ARCHIVE_MAXSIZE can not be negative")
+    }
+  }
+
+  if len(os.Args) > 1 {
+    os.Exit(runCommand(os.Args[1:]))
+  }
+
   if cnf.Discord {
     if cnf.Daily && cnf.DiscordDailyWebhookUrl == "" {
       log.Fatalf("Discord webhook URL for daily reports is not configured, configure with environment variable DAILY_DISCORDURL")
@@ -1173,32 +1473,18 @@ func main() {
     }
   }
 
+  if cnf.Forecast {
+    if _, err := irpredict.New(cnf.ForecastMethod, cnf.ForecastDays); err != nil {
+      log.Fatalf("Invalid forecast configuration (FORECAST_METHOD and FORECAST_DAYS): %v", err)
+    }
+  }
+
   if ( ! cnf.Daily ) && ( ! cnf.Frequent ) {
     log.Warning("Both daily and frequent reports are turned off, will only scrape ionograms and populate database. Enable daily or frequent reports to Slack or Discord with environment variable DAILY=true and/or FREQUENT=true")
   }
 
-  if _, err := os.Stat(cnf.DatabaseFile); err == nil {
-    // db file exists, just open it...
-    db = openDB(cnf.DatabaseFile)
-    defer db.Close()
-  } else if os.IsNotExist(err) {
-    // db file does not exist, initialize it...
-    log.Infof("Creating and initializing database %s", cnf.DatabaseFile)
-    f, err := os.OpenFile(cnf.DatabaseFile, os.O_CREATE, 0644)
-    if err != nil {
-      log.Fatalf("Cannot create db file %s: %v", cnf.DatabaseFile, err)
-    }
-    f.Close()
-    db = openDB(cnf.DatabaseFile)
-    defer db.Close()
-    err = ionizedb.InitDB(db)
-    if err != nil {
-      log.Fatalf("Unable to initialize database: %v", err)
-    }
-    log.Infof("Database %s initialized successfully", cnf.DatabaseFile)
-  } else {
-    log.Fatalf("Cannot stat db file %s: %v", cnf.DatabaseFile, err)
-  }
+  openDatabase()
+  defer db.Close()
 
   log.Infof("Starting ionoreporter %s with db %s", version, cnf.DatabaseFile)
 
@@ -1217,7 +1503,6 @@ func main() {
         log.Fatalf("Unable to schedule full report function: %v", err)
       }
     }
-/**** future feature...
     if cnf.Frequent {
       log.Infof("Scheduling Slack and/or Discord frequent reports with cronspec %s", cnf.FrequentReportCronSpec)
       _, err = c.AddFunc(cnf.FrequentReportCronSpec, func(){ pushFrequentReports() })
@@ -1225,29 +1510,16 @@ func main() {
         log.Fatalf("Unable to schedule current report function: %v", err)
       }
     }
-*/
   }
 
   c.Start()
 
-/*** left for testing purposes...
-  ionize()
-  texts, err := makeDailyReports()
-  if err != nil {
-    log.Errorf("makeDailyReports(): %v", err)
+  if cnf.Metrics {
+    initParameterGauges()
   }
-  for i := range texts {
-    fmt.Printf("\n\n\n")
-    fmt.Println(texts[i])
+  if cnf.Api || cnf.Metrics {
+    startHttpServer()
   }
-*/
-/*
-  err = pushDailyReports()
-  if err != nil {
-    log.Errorf("%v", err)
-  }
-  return
-*/
 
   log.Infof("ionoreporter started successfully")
   select{}
@@ -0,0 +1,75 @@
+package main
+
+import (
+  "database/sql"
+
+  log "github.com/sirupsen/logrus"
+
+  "github.com/sa6mwa/ionoreporter/irmetrics"
+)
+
+/* Metrics are always collected but only served on /metrics (on HTTP_LISTEN)
+ * if METRICS=true. All metrics are labelled with the ursiCode of the
+ * ionosonde, rejections also with the reason (see plausibility.go).
+ */
+var (
+  metrics = irmetrics.NewRegistry()
+
+  metricDownloadFailures = metrics.NewCounterVec("ionoreporter_download_failures_total",
+    "Number of scrapes where the ionogram or data could not be downloaded or decoded.", "ursi")
+  metricOcrFailures = metrics.NewCounterVec("ionoreporter_ocr_failures_total",
+    "Number of scrapes where the date could not be read or parsed from the ionogram.", "ursi")
+  metricParseFailures = metrics.NewCounterVec("ionoreporter_parse_failures_total",
+    "Number of scrapes where scaled data (SAO, SAO-XML or DIDBase) could not be parsed.", "ursi")
+  metricDuplicates = metrics.NewCounterVec("ionoreporter_duplicates_total",
+    "Number of scrapes skipped as the parameters were already in the database.", "ursi")
+  metricRejections = metrics.NewCounterVec("ionoreporter_rejections_total",
+    "Number of ionograms rejected by the plausibility checks.", "ursi", "reason")
+  metricInserts = metrics.NewCounterVec("ionoreporter_inserts_total",
+    "Number of parameters rows inserted into the database.", "ursi")
+  metricScrapeDuration = metrics.NewHistogramVec("ionoreporter_scrape_duration_seconds",
+    "Time to download and interpret one ionogram or its scaled data, storing it is not included.", irmetrics.DefaultBuckets, "ursi")
+
+  metricFoF2 = metrics.NewGaugeVec("ionoreporter_fof2_mhz", "Latest foF2 in MHz.", "ursi")
+  metricFoE = metrics.NewGaugeVec("ionoreporter_foe_mhz", "Latest foE in MHz.", "ursi")
+  metricFmin = metrics.NewGaugeVec("ionoreporter_fmin_mhz", "Latest fmin in MHz.", "ursi")
+  metricHmF2 = metrics.NewGaugeVec("ionoreporter_hmf2_km", "Latest hmF2 in km.", "ursi")
+  metricNvisUpper = metrics.NewGaugeVec("ionoreporter_nvis_upper_mhz",
+    "Latest upper NVIS frequency (foF2*0.85) in MHz.", "ursi")
+)
+
+/* setParameterGauges() updates the latest value gauges of an ionosonde,
+ * values that are not available or flagged (see validate.go) are removed.
+ */
+func setParameterGauges(ursiCode string, p Parameters) {
+  set := func(g *irmetrics.GaugeVec, v sql.NullFloat64, factor float64) {
+    if v.Valid {
+      g.Set(v.Float64 * factor, ursiCode)
+    } else {
+      g.Delete(ursiCode)
+    }
+  }
+  set(metricFoF2, goodValue(p.FoF2, p.Flags.FoF2), 1)
+  set(metricFoE, goodValue(p.FoE, p.Flags.FoE), 1)
+  set(metricFmin, goodValue(p.Fmin, p.Flags.Fmin), 1)
+  set(metricHmF2, goodValue(p.HmF2, p.Flags.HmF2), 1)
+  set(metricNvisUpper, goodValue(p.FoF2, p.Flags.FoF2), 0.85)
+}
+
+/* initParameterGauges() populates the gauges from the database at startup */
+func initParameterGauges() {
+  ionosondes, err := getIonosondesFromDb("where scrape=1")
+  if err != nil {
+    return
+  }
+  for _, i := range ionosondes {
+    p, err := getLatestParametersFromDb(i.IonosondeId)
+    if err == sql.ErrNoRows {
+      continue
+    } else if err != nil {
+      log.Errorf("Unable to initialize metrics for %s: %v", i.UrsiCode, err)
+      continue
+    }
+    setParameterGauges(i.UrsiCode, p)
+  }
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+  "fmt"
+  "image"
+  "sort"
+  "strings"
+  "sync"
+
+  "github.com/sa6mwa/ionoreporter/irlocate"
+  "github.com/sa6mwa/ionoreporter/irocr"
+)
+
+/* OCR engines read the text in a cropped part of an ionogram. The engine is
+ * selected per ionosonde (ocrEngine column), or by OCR_ENGINE if not set.
+ * tesseract uses libtesseract through cgo and is left out when building with
+ * -tags notesseract, template is the pure-Go template matcher in irocr using
+ * the templates in OCR_TEMPLATES (see the train command). Text() returns the
+ * text and the confidence of the engine in it, 0-100.
+ */
+type OCR interface {
+  Text(img image.Image, opts OcrOptions) (string, float64, error)
+}
+
+/* WordLocator is implemented by engines that can read a larger region word
+ * by word with the box of every word (in the coordinates of img, from
+ * 0,0), used to locate crops from labels (see locate.go).
+ */
+type WordLocator interface {
+  Words(img image.Image, opts OcrOptions) ([]irlocate.Word, error)
+}
+
+const ocrEngineTemplate string = "template"
+
+var (
+  ocrEngineFactories = map[string]func() (OCR, error){}
+  ocrEnginesMu sync.Mutex
+  ocrEngines = map[string]OCR{}
+)
+
+/* registerOcrEngine() makes an engine available by name, the factory is
+ * called once on first use.
+ */
+func registerOcrEngine(name string, factory func() (OCR, error)) {
+  ocrEngineFactories[name] = factory
+}
+
+func init() {
+  registerOcrEngine(ocrEngineTemplate, func() (OCR, error) {
+    r, err := irocr.Load(cnf.OcrTemplates)
+    if err != nil {
+      return nil, fmt.Errorf("Unable to load OCR templates (OCR_TEMPLATES): %v", err)
+    }
+    return templateOcr{ r }, nil
+  })
+}
+
+/* ocrEngineNames() returns the names of all engines compiled in */
+func ocrEngineNames() ([]string) {
+  names := []string{}
+  for name := range ocrEngineFactories {
+    names = append(names, name)
+  }
+  sort.Strings(names)
+  return names
+}
+
+func validateOcrEngine(name string) (error) {
+  if _, ok := ocrEngineFactories[name]; ! ok {
+    return fmt.Errorf("Unknown OCR engine %s, available engines are %s", name,
+                      strings.Join(ocrEngineNames(), ", "))
+  }
+  return nil
+}
+
+/* getOcrEngine() returns the engine by name, creating it on first use */
+func getOcrEngine(name string) (OCR, error) {
+  ocrEnginesMu.Lock()
+  defer ocrEnginesMu.Unlock()
+  if engine, ok := ocrEngines[name]; ok {
+    return engine, nil
+  }
+  if err := validateOcrEngine(name); err != nil {
+    return nil, err
+  }
+  engine, err := ocrEngineFactories[name]()
+  if err != nil {
+    return nil, err
+  }
+  ocrEngines[name] = engine
+  return engine, nil
+}
+
+/* ocrEngineName() returns the name of the engine used for an ionosonde */
+func ocrEngineName(i Ionosonde) (string) {
+  if i.OcrEngine.Valid && i.OcrEngine.String != "" {
+    return i.OcrEngine.String
+  }
+  return cnf.OcrEngine
+}
+
+func ocrForIonosonde(i Ionosonde) (OCR, error) {
+  return getOcrEngine(ocrEngineName(i))
+}
+
+// templateOcr is the OCR interface of an irocr.Recognizer
+type templateOcr struct {
+  r *irocr.Recognizer
+}
+
+func (t templateOcr) Text(img image.Image, opts OcrOptions) (string, float64, error) {
+  r := t.r
+  if opts.Whitelist != "" {
+    r = r.Only(opts.Whitelist)
+  }
+  res, err := r.Recognize(img)
+  if err != nil {
+    return "", 0, err
+  }
+  // the confidence of a result is the lowest match score, 0-1
+  return res.Text, res.Confidence() * 100, nil
+}
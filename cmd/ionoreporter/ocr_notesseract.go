@@ -0,0 +1,9 @@
+//go:build notesseract
+// +build notesseract
+
+package main
+
+/* Built with -tags notesseract, i.e without libtesseract, only the template
+ * engine is available.
+ */
+const defaultOcrEngine string = ocrEngineTemplate
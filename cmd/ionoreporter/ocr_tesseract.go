@@ -0,0 +1,104 @@
+//go:build !notesseract
+// +build !notesseract
+
+package main
+
+import (
+  "bytes"
+  "image"
+  "image/png"
+  "strings"
+
+  "github.com/otiai10/gosseract"
+
+  "github.com/sa6mwa/ionoreporter/irlocate"
+)
+
+const defaultOcrEngine string = "tesseract"
+
+func init() {
+  registerOcrEngine("tesseract", func() (OCR, error) {
+    return tesseractOcr{}, nil
+  })
+}
+
+/* tesseractOcr reads text with libtesseract, a new client per image. The
+ * confidence is the lowest word confidence.
+ */
+type tesseractOcr struct{}
+
+/* tesseractClient() returns a client set up with opts and img, the caller
+ * must close it.
+ */
+func tesseractClient(img image.Image, opts OcrOptions) (*gosseract.Client, error) {
+  buf := new(bytes.Buffer)
+  if err := png.Encode(buf, img); err != nil {
+    return nil, err
+  }
+  client := gosseract.NewClient()
+  if opts.Language != "" {
+    if err := client.SetLanguage(strings.Split(opts.Language, "+")...); err != nil {
+      client.Close()
+      return nil, err
+    }
+  }
+  if opts.Psm > 0 {
+    if err := client.SetPageSegMode(gosseract.PageSegMode(opts.Psm)); err != nil {
+      client.Close()
+      return nil, err
+    }
+  }
+  if opts.Whitelist != "" {
+    if err := client.SetWhitelist(opts.Whitelist); err != nil {
+      client.Close()
+      return nil, err
+    }
+  }
+  client.SetImageFromBytes(buf.Bytes())
+  return client, nil
+}
+
+func (tesseractOcr) Text(img image.Image, opts OcrOptions) (string, float64, error) {
+  client, err := tesseractClient(img, opts)
+  if err != nil {
+    return "", 0, err
+  }
+  defer client.Close()
+  text, err := client.Text()
+  if err != nil {
+    return "", 0, err
+  }
+  boxes, err := client.GetBoundingBoxes(gosseract.RIL_WORD)
+  if err != nil {
+    return "", 0, err
+  }
+  confidence := 0.0
+  for n, box := range boxes {
+    if n == 0 || box.Confidence < confidence {
+      confidence = box.Confidence
+    }
+  }
+  return strings.TrimSpace(text), confidence, nil
+}
+
+/* Words() implements WordLocator, the png encoded image starts at 0,0 so
+ * the boxes are relative to the top left corner of img.
+ */
+func (tesseractOcr) Words(img image.Image, opts OcrOptions) ([]irlocate.Word, error) {
+  client, err := tesseractClient(img, opts)
+  if err != nil {
+    return nil, err
+  }
+  defer client.Close()
+  boxes, err := client.GetBoundingBoxes(gosseract.RIL_WORD)
+  if err != nil {
+    return nil, err
+  }
+  words := []irlocate.Word{}
+  for _, box := range boxes {
+    if text := strings.TrimSpace(box.Word); text != "" {
+      words = append(words, irlocate.Word{ Text: text, Box: box.Box })
+    }
+  }
+  return words, nil
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+  "bufio"
+  "flag"
+  "fmt"
+  "image"
+  "os"
+  "path/filepath"
+  "strings"
+  "text/tabwriter"
+  "time"
+
+  "github.com/sa6mwa/ionoreporter/irfilter"
+)
+
+/* The ocrbench command measures how well crops are read with different
+ * preprocessing pipelines (see irfilter and ocrPreprocess) against a
+ * labelled fixture set. The fixture directory has a labels.txt with one
+ * tab separated line per crop:
+ *
+ *   file   field   text   [crop]
+ *
+ * file is an image in the directory, field one of date, foF2, foF1, foE,
+ * fxI, foEs, fmin, hmF2 or hmE (selects the whitelist) and text exactly
+ * what is written in it. With a crop (x,y,width,height) file is a whole
+ * ionogram that the crop is cut from, otherwise file is the crop itself.
+ * Empty lines and lines starting with # are ignored.
+ *
+ * Every pipeline reads every fixture, the pipeline replaces ocrPreprocess,
+ * per-field filters and ocrScale. The other OCR settings come from the
+ * ionosonde given with -ursi (whose filter is applied to whole ionograms),
+ * or the engine defaults.
+ */
+
+const ocrBenchLabels string = "labels.txt"
+
+// ocrBenchDefaults are the pipelines measured without -preprocess
+var ocrBenchDefaults = []string{
+  "",
+  "upscale:3",
+  "upscale:4:cubic",
+  "upscale:4:cubic|otsu|pad:10",
+  "upscale:4:cubic|adaptive:15|pad:10",
+  "upscale:4:nearest|otsu|pad:10",
+  "grayscale|sharpen|upscale:4:lanczos|otsu|pad:10",
+}
+
+// stringList is a flag that can be given several times
+type stringList []string
+
+func (l *stringList) String() (string) {
+  return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) (error) {
+  *l = append(*l, value)
+  return nil
+}
+
+// ocrFixture is a labelled crop, Image is already cut
+type ocrFixture struct {
+  File string
+  Field string
+  Text string
+  Image image.Image
+}
+
+/* loadOcrFixtures() reads labels.txt in dir and cuts the crops, filter is
+ * applied to whole ionograms. Only fixtures of field are returned if it is
+ * not empty.
+ */
+func loadOcrFixtures(dir, field string, filter func(image.Image) (image.Image, error)) ([]ocrFixture, error) {
+  var fixtures []ocrFixture
+  labels := filepath.Join(dir, ocrBenchLabels)
+  f, err := os.Open(labels)
+  if err != nil {
+    return nil, err
+  }
+  defer f.Close()
+  scanner := bufio.NewScanner(f)
+  line := 0
+  for scanner.Scan() {
+    line++
+    if strings.TrimSpace(scanner.Text()) == "" || strings.HasPrefix(scanner.Text(), "#") {
+      continue
+    }
+    columns := strings.Split(scanner.Text(), "\t")
+    if len(columns) < 3 || len(columns) > 4 {
+      return nil, fmt.Errorf("%s:%d: expected file, field, text and optionally crop separated by tabs", labels, line)
+    }
+    fx := ocrFixture{ File: strings.TrimSpace(columns[0]), Text: strings.TrimSpace(columns[2]) }
+    for _, known := range ocrFields {
+      if known != ocrFieldAnchor && strings.EqualFold(known, strings.TrimSpace(columns[1])) {
+        fx.Field = known
+      }
+    }
+    if fx.Field == "" {
+      return nil, fmt.Errorf("%s:%d: unknown field %s", labels, line, columns[1])
+    }
+    if field != "" && ! strings.EqualFold(field, fx.Field) {
+      continue
+    }
+    img, err := loadImage(filepath.Join(dir, fx.File))
+    if err != nil {
+      return nil, fmt.Errorf("%s:%d: %v", labels, line, err)
+    }
+    if len(columns) == 4 {
+      if img, err = filter(img); err != nil {
+        return nil, err
+      }
+      crop, ok, err := cropImage(img, strings.TrimSpace(columns[3]))
+      if err != nil || ! ok {
+        return nil, fmt.Errorf("%s:%d: unable to cut crop %s: %v", labels, line, columns[3], err)
+      }
+      img = crop
+    }
+    fx.Image = img
+    fixtures = append(fixtures, fx)
+  }
+  return fixtures, scanner.Err()
+}
+
+/* editDistance() returns the Levenshtein distance between a and b */
+func editDistance(a, b string) (int) {
+  ra, rb := []rune(a), []rune(b)
+  prev := make([]int, len(rb) + 1)
+  cur := make([]int, len(rb) + 1)
+  for j := range prev {
+    prev[j] = j
+  }
+  for i := 1; i <= len(ra); i++ {
+    cur[0] = i
+    for j := 1; j <= len(rb); j++ {
+      cost := 1
+      if ra[i - 1] == rb[j - 1] {
+        cost = 0
+      }
+      cur[j] = prev[j - 1] + cost
+      if prev[j] + 1 < cur[j] {
+        cur[j] = prev[j] + 1
+      }
+      if cur[j - 1] + 1 < cur[j] {
+        cur[j] = cur[j - 1] + 1
+      }
+    }
+    prev, cur = cur, prev
+  }
+  return prev[len(rb)]
+}
+
+// ocrBenchResult is the outcome of one pipeline
+type ocrBenchResult struct {
+  Pipeline string
+  Exact int
+  Chars int       // characters in the labels
+  Errors int      // edit distance summed over all fixtures
+  Confidence float64
+  Elapsed time.Duration
+}
+
+func cmdOcrBench(args []string) int {
+  fs := flag.NewFlagSet("ocrbench", flag.ContinueOnError)
+  dir := fs.String("fixtures", "", "directory with " + ocrBenchLabels + " and the images (required)")
+  ursi := fs.String("ursi", "", "take the OCR engine, settings and filter from this ionosonde")
+  engineName := fs.String("engine", "", "OCR engine, default the ionosonde's or OCR_ENGINE")
+  field := fs.String("field", "", "only read fixtures of this field, e.g foF2")
+  verbose := fs.Bool("v", false, "print every misread")
+  var pipelines stringList
+  fs.Var(&pipelines, "preprocess", "pipeline to measure, may be repeated (default a set of upscaling and binarization pipelines)")
+  if err := fs.Parse(args); err != nil {
+    return 2
+  }
+  if *dir == "" {
+    fmt.Fprintf(os.Stderr, "-fixtures is required\n")
+    fs.Usage()
+    return 2
+  }
+  if len(pipelines) == 0 {
+    pipelines = ocrBenchDefaults
+  }
+  parsed := make([]irfilter.Pipeline, len(pipelines))
+  for n, spec := range pipelines {
+    p, err := irfilter.Parse(spec)
+    if err != nil {
+      fmt.Fprintf(os.Stderr, "%v\n", err)
+      return 2
+    }
+    parsed[n] = p
+  }
+
+  i := Ionosonde{ UrsiCode: "fixtures" }
+  if *ursi != "" {
+    openDatabase()
+    defer db.Close()
+    var err error
+    if i, err = getIonosondeByUrsi(*ursi); err != nil {
+      fmt.Fprintf(os.Stderr, "%v\n", err)
+      return 1
+    }
+  }
+  if *engineName != "" {
+    i.OcrEngine.String, i.OcrEngine.Valid = *engineName, true
+  }
+  engine, err := ocrForIonosonde(i)
+  if err != nil {
+    fmt.Fprintf(os.Stderr, "%v\n", err)
+    return 1
+  }
+  fixtures, err := loadOcrFixtures(*dir, *field, func(img image.Image) (image.Image, error) {
+    if ! i.Filter.Valid {
+      return img, nil
+    }
+    return applyFilter(img, i.Filter.String, i.UrsiCode)
+  })
+  if err != nil {
+    fmt.Fprintf(os.Stderr, "Unable to load fixtures: %v\n", err)
+    return 1
+  }
+  if len(fixtures) == 0 {
+    fmt.Fprintf(os.Stderr, "No fixtures in %s\n", filepath.Join(*dir, ocrBenchLabels))
+    return 1
+  }
+
+  var results []ocrBenchResult
+  for n, p := range parsed {
+    res := ocrBenchResult{ Pipeline: pipelines[n] }
+    for _, fx := range fixtures {
+      opts, err := ocrOptions(i, fx.Field)
+      if err != nil {
+        fmt.Fprintf(os.Stderr, "%v\n", err)
+        return 1
+      }
+      opts.Filter, opts.Scale = p, 0
+      start := time.Now()
+      text, conf, err := engine.Text(prepareCrop(fx.Image, opts), opts)
+      res.Elapsed += time.Since(start)
+      if err != nil {
+        text, conf = "", 0
+      }
+      text = strings.Join(strings.Fields(text), " ")
+      want := strings.Join(strings.Fields(fx.Text), " ")
+      res.Chars += len([]rune(want))
+      res.Errors += editDistance(want, text)
+      res.Confidence += conf
+      if text == want {
+        res.Exact++
+      } else if *verbose {
+        fmt.Printf("%q: %s %s read %q, expected %q\n", res.Pipeline, fx.File, fx.Field, text, want)
+      }
+    }
+    results = append(results, res)
+  }
+
+  best := 0
+  for n, res := range results {
+    if res.Exact > results[best].Exact || (res.Exact == results[best].Exact && res.Errors < results[best].Errors) {
+      best = n
+    }
+  }
+  fmt.Printf("%d fixtures read with OCR engine %s\n", len(fixtures), ocrEngineName(i))
+  w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+  fmt.Fprintln(w, "PIPELINE\tEXACT\tCHARACTERS\tCONFIDENCE\tTIME/CROP")
+  for n, res := range results {
+    pipeline := res.Pipeline
+    if pipeline == "" {
+      pipeline = "(none)"
+    }
+    if n == best {
+      pipeline += " *"
+    }
+    chars := 100.0
+    if res.Chars > 0 {
+      chars = 100 * (1 - float64(res.Errors) / float64(res.Chars))
+    }
+    fmt.Fprintf(w, "%s\t%d/%d (%.0f%%)\t%.1f%%\t%.1f\t%s\n", pipeline, res.Exact, len(fixtures),
+                100 * float64(res.Exact) / float64(len(fixtures)), chars,
+                res.Confidence / float64(len(fixtures)), (res.Elapsed / time.Duration(len(fixtures))).Round(time.Microsecond))
+  }
+  if err := w.Flush(); err != nil {
+    fmt.Fprintf(os.Stderr, "%v\n", err)
+    return 1
+  }
+  fmt.Printf("* most exact reads, set it with ionoreporter ionosonde edit URSI -ocrpreprocess PIPELINE\n")
+  return 0
+}
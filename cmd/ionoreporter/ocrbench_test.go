@@ -0,0 +1,65 @@
+package main
+
+import (
+  "image"
+  "path/filepath"
+  "testing"
+)
+
+var ocrBenchFixtures = filepath.Join("testdata", "ocrbench")
+
+func noFilter(img image.Image) (image.Image, error) {
+  return img, nil
+}
+
+func TestLoadOcrFixtures(t *testing.T) {
+  fixtures, err := loadOcrFixtures(ocrBenchFixtures, "", noFilter)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(fixtures) != 6 {
+    t.Fatalf("loaded %d fixtures, want 6", len(fixtures))
+  }
+  // the date is cut from the whole ionogram
+  date := fixtures[0]
+  if date.Field != ocrFieldDate || date.Text != "2021 Mar04 063 101500" {
+    t.Errorf("first fixture %s %q, want the date", date.Field, date.Text)
+  }
+  if b := date.Image.Bounds(); b.Dx() != 258 || b.Dy() != 22 {
+    t.Errorf("date crop is %dx%d, want 258x22", b.Dx(), b.Dy())
+  }
+  // the field is matched case insensitively
+  fof2, err := loadOcrFixtures(ocrBenchFixtures, "fof2", noFilter)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(fof2) != 4 {
+    t.Errorf("loaded %d foF2 fixtures, want 4", len(fof2))
+  }
+  for _, fx := range fof2 {
+    if fx.Field != "foF2" {
+      t.Errorf("%s is %s, want foF2", fx.File, fx.Field)
+    }
+  }
+  if _, err := loadOcrFixtures(t.TempDir(), "", noFilter); err == nil {
+    t.Errorf("loadOcrFixtures without %s did not fail", ocrBenchLabels)
+  }
+}
+
+func TestEditDistance(t *testing.T) {
+  for _, c := range []struct {
+    a, b string
+    want int
+  }{
+    { "", "", 0 },
+    { "5.125", "5.125", 0 },
+    { "5.125", "5125", 1 },
+    { "2.40", "2.4O", 1 },
+    { "", "251.7", 5 },
+    { "kitten", "sitting", 3 },
+  } {
+    if d := editDistance(c.a, c.b); d != c.want {
+      t.Errorf("editDistance(%q, %q) = %d, want %d", c.a, c.b, d, c.want)
+    }
+  }
+}
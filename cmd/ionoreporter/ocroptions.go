@@ -0,0 +1,269 @@
+package main
+
+import (
+  "fmt"
+  "image"
+  "strconv"
+  "strings"
+  "time"
+  "unicode"
+
+  "github.com/disintegration/gift"
+
+  "github.com/sa6mwa/ionoreporter/irfilter"
+)
+
+/* OCR settings are stored per ionosonde in the ionosondes table:
+ *
+ * ocrLanguage          tesseract language, e.g eng (default engine default)
+ * ocrPsm               tesseract page segmentation mode, e.g 7 (single line)
+ * ocrScale             scale crops by this factor before OCR, e.g 3
+ * ocrNumericWhitelist  characters allowed in foF2, foE, hmF2, etc, auto is
+ *                      0123456789.
+ * ocrDateWhitelist     characters allowed in the date, auto derives them
+ *                      from dateFormat
+ * ocrPreprocess        filter pipeline applied to every crop (after the
+ *                      filter of the ionosonde), e.g upscale:4:cubic|otsu|pad:10
+ *                      (see irfilter)
+ * ocrFieldOptions      per-field overrides, e.g "date:psm=6,scale=2;foF2:whitelist=0123456789."
+ *                      and per-field filter pipelines replacing
+ *                      ocrPreprocess, e.g "foF2:filter=threshold:128|scale:3"
+ *
+ * The anchor field is the header region read to locate the crops (see
+ * locate.go), it does not use ocrPsm, ocrPreprocess and the whitelists but
+ * defaults to sparse text (psm 11) and can be changed with ocrFieldOptions.
+ * Its filter can not pad, the word boxes would be shifted.
+ *
+ * null means not set, i.e the engine's defaults. The template engine only
+ * uses the whitelist (and scale, which is applied to all engines).
+ */
+
+// OcrOptions are the settings used for reading one crop
+type OcrOptions struct {
+  Language string
+  Psm int         // 0 is the engine's default
+  Whitelist string
+  Scale float64   // 0 or 1 is no scaling
+  Filter irfilter.Pipeline  // applied to the crop before scaling
+}
+
+const (
+  ocrPsmMax int = 13
+  ocrScaleMax float64 = 10
+  ocrWhitelistAuto string = "auto"
+  ocrFieldDate string = "date"
+  ocrFieldAnchor string = "anchor"
+  ocrPsmSparseText int = 11
+)
+
+// ocrFields are the field names accepted in ocrFieldOptions
+var ocrFields = []string{ ocrFieldAnchor, ocrFieldDate, "foF2", "foF1", "foE", "fxI", "foEs", "fmin", "hmF2", "hmE" }
+
+func validateOcrPsm(psm int) (error) {
+  if psm < 0 || psm > ocrPsmMax {
+    return fmt.Errorf("page segmentation mode %d is not between 0 and %d", psm, ocrPsmMax)
+  }
+  return nil
+}
+
+func validateOcrScale(scale float64) (error) {
+  if scale < 0 || scale > ocrScaleMax {
+    return fmt.Errorf("scale %g is not between 0 and %g", scale, ocrScaleMax)
+  }
+  return nil
+}
+
+/* nameLetters() returns the letters of names as written by layout: whole
+ * names if the layout has long (e.g January), the first 3 letters if it has
+ * short (e.g Jan) and the first 3 in upper case if it has short in upper
+ * case (e.g JAN).
+ */
+func nameLetters(layout, long, short string, names []string) (string) {
+  letters := ""
+  for _, name := range names {
+    if strings.Contains(layout, long) {
+      letters += name
+    } else if strings.Contains(layout, short) {
+      letters += name[:3]
+    }
+    if strings.Contains(layout, strings.ToUpper(short)) {
+      letters += strings.ToUpper(name[:3])
+    }
+  }
+  return letters
+}
+
+/* dateWhitelist() returns the characters that can appear in a date written
+ * with layout: digits, the letters of month and weekday names if the layout
+ * has names, and the punctuation and spaces of the layout.
+ */
+func dateWhitelist(layout string) (string) {
+  var months, weekdays []string
+  for m := time.January; m <= time.December; m++ {
+    months = append(months, m.String())
+  }
+  for d := time.Sunday; d <= time.Saturday; d++ {
+    weekdays = append(weekdays, d.String())
+  }
+  letters := nameLetters(layout, "January", "Jan", months) + nameLetters(layout, "Monday", "Mon", weekdays)
+  if strings.Contains(layout, "PM") {
+    letters += "AMP"
+  }
+  chars := "0123456789"
+  for _, c := range letters + layout {
+    if unicode.IsLetter(c) && ! strings.ContainsRune(letters, c) {
+      // letters of the layout are tokens, e.g Z or the letters of Jan
+      continue
+    }
+    if ! strings.ContainsRune(chars, c) {
+      chars += string(c)
+    }
+  }
+  return chars
+}
+
+/* parseOcrFieldOptions() parses ocrFieldOptions, e.g
+ * "date:psm=6,scale=2;foF2:whitelist=0123456789.", into options per field
+ * name (as in ocrFields). Keys are lang, psm, scale, whitelist and filter.
+ */
+func parseOcrFieldOptions(s string) (map[string]map[string]string, error) {
+  fields := map[string]map[string]string{}
+  for _, f := range strings.Split(s, ";") {
+    if strings.TrimSpace(f) == "" {
+      continue
+    }
+    nameAndOpts := strings.SplitN(f, ":", 2)
+    if len(nameAndOpts) != 2 {
+      return nil, fmt.Errorf("%s is not field:key=value,...", f)
+    }
+    name := ""
+    for _, known := range ocrFields {
+      if strings.EqualFold(known, strings.TrimSpace(nameAndOpts[0])) {
+        name = known
+      }
+    }
+    if name == "" {
+      return nil, fmt.Errorf("Unknown field %s, fields are %s", nameAndOpts[0], strings.Join(ocrFields, ", "))
+    }
+    opts := map[string]string{}
+    for _, kv := range strings.Split(nameAndOpts[1], ",") {
+      pair := strings.SplitN(kv, "=", 2)
+      if len(pair) != 2 {
+        return nil, fmt.Errorf("%s is not key=value", kv)
+      }
+      key := strings.ToLower(strings.TrimSpace(pair[0]))
+      value := strings.TrimSpace(pair[1])
+      switch key {
+        case "lang", "whitelist":
+        case "filter":
+          p, err := irfilter.Parse(value)
+          if err != nil {
+            return nil, err
+          }
+          if name == ocrFieldAnchor && p.Has("pad") {
+            return nil, fmt.Errorf("Filter %s: pad is not allowed in the %s filter", value, name)
+          }
+        case "psm":
+          psm, err := strconv.Atoi(value)
+          if err != nil {
+            return nil, fmt.Errorf("psm %s is not an integer", value)
+          }
+          if err := validateOcrPsm(psm); err != nil {
+            return nil, err
+          }
+        case "scale":
+          scale, err := strconv.ParseFloat(value, 64)
+          if err != nil {
+            return nil, fmt.Errorf("scale %s is not a number", value)
+          }
+          if err := validateOcrScale(scale); err != nil {
+            return nil, err
+          }
+        default:
+          return nil, fmt.Errorf("Unknown key %s in %s, keys are lang, psm, scale, whitelist and filter", key, name)
+      }
+      opts[key] = value
+    }
+    fields[name] = opts
+  }
+  return fields, nil
+}
+
+/* ocrOptions() returns the OCR settings of an ionosonde for a field (see
+ * ocrFields).
+ */
+func ocrOptions(i Ionosonde, field string) (OcrOptions, error) {
+  o := OcrOptions{
+    Language: i.OcrLanguage.String,
+    Psm: int(i.OcrPsm.Int64),
+    Scale: i.OcrScale.Float64,
+  }
+  switch field {
+    case ocrFieldAnchor:
+      o.Psm = ocrPsmSparseText
+    case ocrFieldDate:
+      o.Whitelist = i.OcrDateWhitelist.String
+    default:
+      o.Whitelist = i.OcrNumericWhitelist.String
+  }
+  if i.OcrPreprocess.Valid && field != ocrFieldAnchor {
+    p, err := irfilter.Parse(i.OcrPreprocess.String)
+    if err != nil {
+      return o, fmt.Errorf("Invalid ocrPreprocess of %s: %v", i.UrsiCode, err)
+    }
+    o.Filter = p
+  }
+  if i.OcrFieldOptions.Valid {
+    fields, err := parseOcrFieldOptions(i.OcrFieldOptions.String)
+    if err != nil {
+      return o, fmt.Errorf("Invalid ocrFieldOptions of %s: %v", i.UrsiCode, err)
+    }
+    // values are validated by parseOcrFieldOptions()
+    for key, value := range fields[field] {
+      switch key {
+        case "lang":
+          o.Language = value
+        case "psm":
+          o.Psm, _ = strconv.Atoi(value)
+        case "scale":
+          o.Scale, _ = strconv.ParseFloat(value, 64)
+        case "whitelist":
+          o.Whitelist = value
+        case "filter":
+          o.Filter, _ = irfilter.Parse(value)
+      }
+    }
+  }
+  if o.Whitelist == ocrWhitelistAuto {
+    switch field {
+      case ocrFieldAnchor:
+        o.Whitelist = ""
+      case ocrFieldDate:
+        o.Whitelist = dateWhitelist(i.DateFormat)
+      default:
+        o.Whitelist = "0123456789."
+    }
+  }
+  return o, nil
+}
+
+/* prepareCrop() returns crop as it is read by the OCR engine, filtered by
+ * ocrPreprocess or the field's filter and scaled by ocrScale.
+ */
+func prepareCrop(crop image.Image, opts OcrOptions) (image.Image) {
+  return scaleImage(opts.Filter.Apply(crop), opts.Scale)
+}
+
+/* scaleImage() resizes img by factor for OCR, engines generally do better
+ * on larger text than the small fonts in ionograms.
+ */
+func scaleImage(img image.Image, factor float64) (image.Image) {
+  if factor <= 0 || factor == 1 {
+    return img
+  }
+  b := img.Bounds()
+  g := gift.New(gift.Resize(int(float64(b.Dx()) * factor), int(float64(b.Dy()) * factor), gift.LanczosResampling))
+  dst := image.NewRGBA(g.Bounds(b))
+  g.Draw(dst, img)
+  return dst
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+  "strings"
+  "testing"
+  "time"
+  "unicode"
+)
+
+func TestDateWhitelist(t *testing.T) {
+  cases := []struct {
+    layout string
+    upper bool    // the provider writes names in upper case, e.g JAN
+  }{
+    { "2006 Jan02 002 150405", false },
+    { "2006.01.02 (002) 15:04:05", false },
+    { "Mon Jan _2 15:04:05 2006", false },
+    { "Monday, 02-January-2006 15:04", false },
+    { "Mon 02 January 2006 3:04PM", false },
+    { "02 JAN 2006 150405", true },
+    { "MON 02 JAN 2006", true },
+  }
+  // every day of a leap year covers all months and weekdays
+  start := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+  for _, c := range cases {
+    whitelist := dateWhitelist(c.layout)
+    layout := c.layout
+    if c.upper {
+      layout = strings.NewReplacer("JAN", "Jan", "MON", "Mon").Replace(layout)
+    }
+    for d := 0; d < 366; d++ {
+      // a different hour every day for PM
+      text := start.AddDate(0, 0, d).Add(time.Duration(d % 24) * time.Hour).Format(layout)
+      if c.upper {
+        text = strings.ToUpper(text)
+      }
+      for _, r := range text {
+        if ! strings.ContainsRune(whitelist, r) {
+          t.Errorf("%q of layout %q has %q that is not in whitelist %q", text, c.layout, r, whitelist)
+          break
+        }
+      }
+    }
+    for n, r := range whitelist {
+      if strings.ContainsRune(whitelist[:n], r) {
+        t.Errorf("whitelist %q of layout %q has %q twice", whitelist, c.layout, r)
+      }
+    }
+  }
+  // a numeric layout has no letters
+  for _, r := range dateWhitelist("2006-01-02 15:04:05") {
+    if unicode.IsLetter(r) {
+      t.Errorf("whitelist of a numeric layout has %q", r)
+    }
+  }
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+  "flag"
+  "fmt"
+  "os"
+
+  log "github.com/sirupsen/logrus"
+)
+
+/* One-shot commands doing what the daemon does on cron, but only once and
+ * with an exit status suitable for scripts and systemd timers: 0 on success,
+ * 1 on failure and 2 on usage errors.
+ */
+
+const reportKinds string = "daily or frequent"
+
+/* cmdScrape scrapes all ionosondes with scrape=1, or only the one given
+ * with -ursi (regardless of its scrape setting). Fails if any ionogram
+ * could not be scraped, duplicates and rejected (implausible) ionograms are
+ * not failures.
+ */
+func cmdScrape(args []string) int {
+  fs := flag.NewFlagSet("scrape", flag.ContinueOnError)
+  ursi := fs.String("ursi", "", "only scrape ionosonde with this URSI code")
+  if err := fs.Parse(args); err != nil {
+    return 2
+  }
+  openDatabase()
+  defer db.Close()
+  var result scrapeResult
+  var err error
+  if *ursi != "" {
+    if _, err := getIonosondeByUrsi(*ursi); err != nil {
+      fmt.Fprintf(os.Stderr, "%v\n", err)
+      return 1
+    }
+    result, err = scrape("where ursiCode=? collate nocase", *ursi)
+  } else {
+    result, err = scrape("where scrape=1")
+  }
+  if err != nil {
+    fmt.Fprintf(os.Stderr, "Scrape failed: %v\n", err)
+    return 1
+  }
+  log.Infof("Scrape done: %d inserted, %d duplicates, %d rejected, %d failed", result.Inserted,
+            result.Duplicates, result.Rejected, result.Failed)
+  if result.Failed > 0 {
+    return 1
+  }
+  return 0
+}
+
+/* makeReports() makes daily or frequent reports */
+func makeReports(kind string) ([]string, error) {
+  switch kind {
+    case "daily":
+      return makeDailyReports()
+    case "frequent":
+      r, err := makeFrequentReport()
+      return []string{ r }, err
+  }
+  return nil, fmt.Errorf("Unknown report %s, expected %s", kind, reportKinds)
+}
+
+func reportKindArg(name string, args []string) (string, []string, error) {
+  if len(args) == 0 || (args[0] != "daily" && args[0] != "frequent") {
+    return "", args, fmt.Errorf("Usage: ionoreporter %s %s", name, reportKinds)
+  }
+  return args[0], args[1:], nil
+}
+
+/* cmdReport makes daily or frequent reports and logs them, or prints them
+ * as plain text with -stdout.
+ */
+func cmdReport(args []string) int {
+  kind, rest, err := reportKindArg("report", args)
+  if err != nil {
+    fmt.Fprintf(os.Stderr, "%v [-stdout]\n", err)
+    return 2
+  }
+  fs := flag.NewFlagSet("report " + kind, flag.ContinueOnError)
+  stdout := fs.Bool("stdout", false, "print reports as plain text to stdout instead of logging them")
+  if err := fs.Parse(rest); err != nil {
+    return 2
+  }
+  if *stdout {
+    // keep stdout clean for the reports
+    log.SetOutput(os.Stderr)
+  }
+  openDatabase()
+  defer db.Close()
+  reports, err := makeReports(kind)
+  if err != nil {
+    fmt.Fprintf(os.Stderr, "Unable to make %s report: %v\n", kind, err)
+    return 1
+  }
+  for i := range reports {
+    if *stdout {
+      fmt.Println(reports[i])
+    } else {
+      log.Info(reports[i])
+    }
+  }
+  return 0
+}
+
+/* cmdPush makes daily or frequent reports and pushes them to the configured
+ * Discord and/or Slack webhook URLs regardless of DAILY and FREQUENT.
+ */
+func cmdPush(args []string) int {
+  kind, rest, err := reportKindArg("push", args)
+  if err != nil {
+    fmt.Fprintf(os.Stderr, "%v\n", err)
+    return 2
+  }
+  if len(rest) > 0 {
+    fmt.Fprintf(os.Stderr, "Unexpected arguments: %v\n", rest)
+    return 2
+  }
+  discordUrl, slackUrl, header := cnf.DiscordDailyWebhookUrl, cnf.SlackDailyWebhookUrl, dailySlackHeader
+  if kind == "frequent" {
+    discordUrl, slackUrl, header = cnf.DiscordFrequentWebhookUrl, cnf.SlackFrequentWebhookUrl, frequentSlackHeader
+  }
+  if ! cnf.Discord && ! cnf.Slack {
+    fmt.Fprintf(os.Stderr, "Neither Discord nor Slack is enabled, enable with DISCORD=true and/or SLACK=true\n")
+    return 1
+  }
+  if (cnf.Discord && discordUrl == "") || (cnf.Slack && slackUrl == "") {
+    fmt.Fprintf(os.Stderr, "Webhook URL for %s reports is not configured\n", kind)
+    return 1
+  }
+  openDatabase()
+  defer db.Close()
+  reports, err := makeReports(kind)
+  if err != nil {
+    fmt.Fprintf(os.Stderr, "Unable to make %s report: %v\n", kind, err)
+    return 1
+  }
+  if err := pushReports(reports, kind, discordUrl, slackUrl, header); err != nil {
+    fmt.Fprintf(os.Stderr, "Unable to push %s report: %v\n", kind, err)
+    return 1
+  }
+  return 0
+}
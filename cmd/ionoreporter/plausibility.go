@@ -0,0 +1,106 @@
+package main
+
+import (
+  "fmt"
+  "time"
+
+  log "github.com/sirupsen/logrus"
+)
+
+/* Scraped ionograms are checked for plausibility before they are stored.
+ * The reference time is the Last-Modified time sent by the server, or when
+ * the ionogram was downloaded if there is none. An ionogram is rejected if
+ *
+ * stale   the server keeps serving the same image or data file (same hash)
+ *         for longer than DATE_CADENCE (the longest an ionosonde goes
+ *         without a new ionogram), or one last modified more than
+ *         DATE_MAXAGE before it was downloaded
+ * future  the date is more than DATE_MAXFUTURE after the reference time
+ * old     the date is more than DATE_MAXAGE before the reference time
+ *
+ * 0 disables a limit. Every rejection is recorded in the rejections table.
+ */
+
+const (
+  rejectStale string = "stale"
+  rejectFuture string = "future"
+  rejectOld string = "old"
+)
+
+/* checkStaleImage() returns a rejection reason and detail if the image of a
+ * job is the same as the last one downloaded from the ionosonde since more
+ * than DATE_CADENCE or was last modified more than DATE_MAXAGE before it
+ * was downloaded.
+ */
+func checkStaleImage(job scrapeJob) (reason, detail string) {
+  i := job.Ionosonde
+  unchanged := job.Hash != "" && i.LastImageHash.Valid && i.LastImageHash.String == job.Hash
+  if cnf.DateCadence > 0 && unchanged && i.LastImageChanged.Valid {
+    if age := job.Start.Sub(i.LastImageChanged.Time); age > cnf.DateCadence {
+      return rejectStale, fmt.Sprintf("Same image served since %s (%s, expected a new one every %s)",
+                                      i.LastImageChanged.Time.UTC().Format(SqliteDateFormat),
+                                      age.Round(time.Minute), cnf.DateCadence)
+    }
+  }
+  if cnf.DateMaxAge > 0 && ! job.LastModified.IsZero() {
+    if age := job.Start.Sub(job.LastModified); age > cnf.DateMaxAge {
+      return rejectStale, fmt.Sprintf("Image last modified %s (%s before download)",
+                                      job.LastModified.UTC().Format(SqliteDateFormat),
+                                      age.Round(time.Minute))
+    }
+  }
+  return "", ""
+}
+
+/* checkPlausibleDate() returns a rejection reason and detail if the date of
+ * the ionogram of a job is in the future or too old.
+ */
+func checkPlausibleDate(job scrapeJob) (reason, detail string) {
+  reference, what := job.Start, "download"
+  if ! job.LastModified.IsZero() {
+    reference, what = job.LastModified, "Last-Modified"
+  }
+  dt := job.Parameters.Date
+  if cnf.DateMaxFuture > 0 && dt.Sub(reference) > cnf.DateMaxFuture {
+    return rejectFuture, fmt.Sprintf("Date %s is %s after %s %s", dt.UTC().Format(SqliteDateFormat),
+                                     dt.Sub(reference).Round(time.Second), what,
+                                     reference.UTC().Format(SqliteDateFormat))
+  }
+  if cnf.DateMaxAge > 0 && reference.Sub(dt) > cnf.DateMaxAge {
+    return rejectOld, fmt.Sprintf("Date %s is %s before %s %s", dt.UTC().Format(SqliteDateFormat),
+                                  reference.Sub(dt).Round(time.Second), what,
+                                  reference.UTC().Format(SqliteDateFormat))
+  }
+  return "", ""
+}
+
+/* recordRejection() inserts a rejected job into the rejections table. */
+func recordRejection(job scrapeJob) error {
+  var dt, lastModified interface{}
+  if ! job.Parameters.Date.IsZero() {
+    dt = job.Parameters.Date.UTC().Format(SqliteDateFormat)
+  }
+  if ! job.LastModified.IsZero() {
+    lastModified = job.LastModified.UTC().Format(SqliteDateFormat)
+  }
+  _, err := db.Exec("insert into rejections (ionosondeId, dt, downloaded, lastModified, url, reason, detail) " +
+                    "values (?, ?, ?, ?, ?, ?, ?)", job.Ionosonde.IonosondeId, dt,
+                    job.Start.UTC().Format(SqliteDateFormat), lastModified, job.Url,
+                    job.Rejected, job.RejectDetail)
+  return err
+}
+
+/* updateLastImageHash() remembers the hash of the image of a job as the last
+ * image of the ionosonde unless it is the same as before.
+ */
+func updateLastImageHash(job scrapeJob) {
+  i := job.Ionosonde
+  if job.Hash == "" || (i.LastImageHash.Valid && i.LastImageHash.String == job.Hash) {
+    return
+  }
+  _, err := db.Exec("update ionosondes set lastImageHash=?, lastImageChanged=? where ionosondeId=?",
+                    job.Hash, job.Start.UTC().Format(SqliteDateFormat), i.IonosondeId)
+  if err != nil {
+    log.Errorf("Unable to update last image hash of %s: %v", i.UrsiCode, err)
+  }
+}
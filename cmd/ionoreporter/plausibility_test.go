@@ -0,0 +1,121 @@
+package main
+
+import (
+  "database/sql"
+  "path/filepath"
+  "testing"
+  "time"
+)
+
+var plausibilityStart = time.Date(2021, time.March, 20, 12, 0, 0, 0, time.UTC)
+
+func TestCheckStaleImage(t *testing.T) {
+  saved := *cnf
+  defer func() { *cnf = saved }()
+  cnf.DateMaxAge = 6 * time.Hour
+  cnf.DateCadence = time.Hour
+
+  since := func(d time.Duration) sql.NullTime {
+    return sql.NullTime{ Time: plausibilityStart.Add(-d), Valid: true }
+  }
+  hash := sql.NullString{ String: "abc", Valid: true }
+  cases := []struct {
+    name string
+    hash string
+    lastHash sql.NullString
+    lastChanged sql.NullTime
+    lastModified time.Time
+    cadence time.Duration
+    want string
+  }{
+    { "new image", "def", hash, since(3 * time.Hour), time.Time{}, time.Hour, "" },
+    { "first image", "abc", sql.NullString{}, sql.NullTime{}, time.Time{}, time.Hour, "" },
+    { "unchanged within cadence", "abc", hash, since(45 * time.Minute), time.Time{}, time.Hour, "" },
+    { "unchanged beyond cadence", "abc", hash, since(61 * time.Minute), time.Time{}, time.Hour, rejectStale },
+    { "unchanged, cadence disabled", "abc", hash, since(24 * time.Hour), time.Time{}, 0, "" },
+    { "no hash", "", hash, since(24 * time.Hour), time.Time{}, time.Hour, "" },
+    { "last modified recently", "def", hash, since(time.Hour), plausibilityStart.Add(-5 * time.Hour), time.Hour, "" },
+    { "last modified too long ago", "def", hash, since(time.Hour), plausibilityStart.Add(-7 * time.Hour), time.Hour, rejectStale },
+  }
+  for _, c := range cases {
+    cnf.DateCadence = c.cadence
+    job := scrapeJob{ Start: plausibilityStart, Hash: c.hash, LastModified: c.lastModified }
+    job.Ionosonde.LastImageHash = c.lastHash
+    job.Ionosonde.LastImageChanged = c.lastChanged
+    reason, detail := checkStaleImage(job)
+    if reason != c.want {
+      t.Errorf("%s: checkStaleImage = %q (%s), want %q", c.name, reason, detail, c.want)
+    }
+    if (reason == "") != (detail == "") {
+      t.Errorf("%s: reason %q with detail %q", c.name, reason, detail)
+    }
+  }
+}
+
+func TestCheckPlausibleDate(t *testing.T) {
+  saved := *cnf
+  defer func() { *cnf = saved }()
+
+  cases := []struct {
+    name string
+    date time.Duration        // after the start of the job
+    lastModified time.Duration // after the start, 0 if not sent
+    maxAge, maxFuture time.Duration
+    want string
+  }{
+    { "current", -10 * time.Minute, 0, 6 * time.Hour, 15 * time.Minute, "" },
+    { "slightly ahead", 10 * time.Minute, 0, 6 * time.Hour, 15 * time.Minute, "" },
+    { "future", 20 * time.Minute, 0, 6 * time.Hour, 15 * time.Minute, rejectFuture },
+    { "future disabled", 24 * time.Hour, 0, 6 * time.Hour, 0, "" },
+    { "too old", -7 * time.Hour, 0, 6 * time.Hour, 15 * time.Minute, rejectOld },
+    { "old disabled", -30 * 24 * time.Hour, 0, 0, 15 * time.Minute, "" },
+    // Last-Modified is the reference if sent
+    { "old against Last-Modified", -5 * time.Hour, -2 * time.Hour, 2 * time.Hour, 15 * time.Minute, rejectOld },
+    { "future against Last-Modified", -30 * time.Minute, -time.Hour, 6 * time.Hour, 15 * time.Minute, rejectFuture },
+    { "within Last-Modified", -70 * time.Minute, -time.Hour, 6 * time.Hour, 15 * time.Minute, "" },
+  }
+  for _, c := range cases {
+    cnf.DateMaxAge, cnf.DateMaxFuture = c.maxAge, c.maxFuture
+    job := scrapeJob{ Start: plausibilityStart }
+    job.Parameters.Date = plausibilityStart.Add(c.date)
+    if c.lastModified != 0 {
+      job.LastModified = plausibilityStart.Add(c.lastModified)
+    }
+    reason, detail := checkPlausibleDate(job)
+    if reason != c.want {
+      t.Errorf("%s: checkPlausibleDate = %q (%s), want %q", c.name, reason, detail, c.want)
+    }
+  }
+}
+
+func TestStoreFailedRemembersHash(t *testing.T) {
+  saved := *cnf
+  defer func() { *cnf = saved }()
+  cnf.DatabaseFile = filepath.Join(t.TempDir(), "ionoreporter.db")
+  cnf.ArchiveDir = ""
+  cnf.DateCadence = time.Hour
+  openDatabase()
+  defer db.Close()
+
+  ionosondes, err := getIonosondesFromDb("where ursiCode=?", "JR055")
+  if err != nil || len(ionosondes) != 1 {
+    t.Fatalf("JR055: %v", err)
+  }
+  // OCR failed on the image, it is remembered all the same
+  job := scrapeJob{ Ionosonde: ionosondes[0], Start: plausibilityStart, Hash: "abc", Failed: true }
+  if status := storeIonogram(job); status != scrapeFailed {
+    t.Errorf("storeIonogram of a failed job = %v", status)
+  }
+  if ionosondes, err = getIonosondesFromDb("where ursiCode=?", "JR055"); err != nil {
+    t.Fatal(err)
+  }
+  i := ionosondes[0]
+  if i.LastImageHash.String != "abc" || ! i.LastImageChanged.Time.Equal(plausibilityStart) {
+    t.Fatalf("last image %v %v, want abc %s", i.LastImageHash, i.LastImageChanged, plausibilityStart)
+  }
+  // the same image over an hour later is stale before it is interpreted
+  job = scrapeJob{ Ionosonde: i, Start: plausibilityStart.Add(61 * time.Minute), Hash: "abc" }
+  if reason, _ := checkStaleImage(job); reason != rejectStale {
+    t.Errorf("checkStaleImage of the same image = %q, want %q", reason, rejectStale)
+  }
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+  "flag"
+  "fmt"
+  "os"
+  "time"
+  "strings"
+  "path/filepath"
+  "database/sql"
+)
+
+/* The reprocess command runs archived ionograms (see archive.go) of an
+ * ionosonde through interpretIonogram() again using the current crop boxes,
+ * filter and date format. Without -update it only prints the differences
+ * to the stored parameters, with -update the parameters rows are changed in
+ * place. Values are validated again (see validate.go) against the previous
+ * reading in the database. When the date changes the archived image is
+ * renamed after the new date.
+ */
+
+// archivedIonogram is an images row joined with its parameters row
+type archivedIonogram struct {
+  ImageId int64
+  File string
+  Downloaded time.Time
+  Parameters Parameters
+}
+
+/* getArchivedIonogramsFromDb() returns the archived ionograms of an
+ * ionosonde with parameters dt within from and to (inclusive), oldest first.
+ */
+func getArchivedIonogramsFromDb(ionosondeId string, from, to time.Time) ([]archivedIonogram, error) {
+  var ionograms []archivedIonogram
+  rows, err := db.Query("select i.imageId, i.file, i.downloaded, p.parameterId, p.ionosondeId, p.dt, " +
+                        parameterColumns + " " +
+                        "from images i join parameters p on p.parameterId=i.parameterId " +
+                        "where i.ionosondeId=? and p.dt >= ? and p.dt <= ? order by p.dt",
+                        ionosondeId, from.UTC().Format(SqliteDateFormat), to.UTC().Format(SqliteDateFormat))
+  if err != nil {
+    return ionograms, err
+  }
+  defer rows.Close()
+  for rows.Next() {
+    a := archivedIonogram{}
+    p := &a.Parameters
+    err = rows.Scan(append([]interface{}{ &a.ImageId, &a.File, &a.Downloaded, &p.ParameterId,
+                    &p.IonosondeId, &p.Date }, p.scanValues()...)...)
+    if err != nil {
+      return ionograms, err
+    }
+    ionograms = append(ionograms, a)
+  }
+  return ionograms, rows.Err()
+}
+
+/* parameterDiff() returns the differences between old and new as
+ * "name old -> new" strings, NA is an invalid value and flags (see
+ * validate.go) are in parentheses.
+ */
+func parameterDiff(old, new Parameters) ([]string) {
+  var diff []string
+  if ! old.Date.Equal(new.Date) {
+    diff = append(diff, fmt.Sprintf("dt %s -> %s", old.Date.UTC().Format(SqliteDateFormat),
+                                    new.Date.UTC().Format(SqliteDateFormat)))
+  }
+  format := func(v sql.NullFloat64, flag sql.NullString) string {
+    if flag.Valid {
+      return fmt.Sprintf("%s (%s)", formatNullFloat64(v), flag.String)
+    }
+    return formatNullFloat64(v)
+  }
+  newValues := new.values()
+  for n, o := range old.values() {
+    v := newValues[n]
+    if o.Value.Valid != v.Value.Valid || o.Value.Float64 != v.Value.Float64 || o.Flag.String != v.Flag.String {
+      diff = append(diff, fmt.Sprintf("%s %s -> %s", o.Name, format(*o.Value, *o.Flag),
+                                      format(*v.Value, *v.Flag)))
+    }
+  }
+  return diff
+}
+
+/* updateParameters() replaces the date and values of the parameters row
+ * p.ParameterId of archived ionogram a, the date and file name of the
+ * archived image follow.
+ */
+func updateParameters(i Ionosonde, a archivedIonogram, p Parameters) error {
+  file := a.File
+  if ! p.Date.Equal(a.Parameters.Date) {
+    file = archiveFile(i.UrsiCode, p.Date, filepath.Ext(a.File))
+  }
+  oldPath, newPath := filepath.Join(cnf.ArchiveDir, a.File), filepath.Join(cnf.ArchiveDir, file)
+  if file != a.File {
+    if _, err := os.Stat(newPath); err == nil {
+      return fmt.Errorf("Archived image %s already exists", file)
+    }
+    if err := os.MkdirAll(filepath.Dir(newPath), 0755); err != nil {
+      return err
+    }
+    if err := os.Rename(oldPath, newPath); err != nil {
+      return err
+    }
+  }
+  // the file is moved back if the rows can not be updated
+  err := updateParametersRows(a.ImageId, file, p)
+  if file == a.File {
+    return err
+  }
+  if err != nil {
+    os.Rename(newPath, oldPath)
+    removeEmptyArchiveDirs(file)
+    return err
+  }
+  removeEmptyArchiveDirs(a.File)
+  return nil
+}
+
+/* updateParametersRows() updates the parameters and images rows in one
+ * transaction.
+ */
+func updateParametersRows(imageId int64, file string, p Parameters) error {
+  tx, err := db.Begin()
+  if err != nil {
+    return err
+  }
+  dt := p.Date.UTC().Format(SqliteDateFormat)
+  set := "dt=?"
+  for _, c := range strings.Split(parameterColumns, ",") {
+    set += ", " + strings.TrimSpace(c) + "=?"
+  }
+  args := append([]interface{}{ dt }, p.columnValues()...)
+  _, err = tx.Exec("update parameters set " + set + " where parameterId=?", append(args, p.ParameterId)...)
+  if err != nil {
+    tx.Rollback()
+    return err
+  }
+  if _, err := tx.Exec("update images set dt=?, file=? where imageId=?", dt, file, imageId); err != nil {
+    tx.Rollback()
+    return err
+  }
+  return tx.Commit()
+}
+
+func cmdReprocess(args []string) int {
+  fs := flag.NewFlagSet("reprocess", flag.ContinueOnError)
+  ursi := fs.String("ursi", "", "URSI code of the ionosonde to reprocess (required)")
+  fromArg := fs.String("from", "", "reprocess ionograms from this time (default 24 hours ago)")
+  toArg := fs.String("to", "", "reprocess ionograms until this time (default now)")
+  update := fs.Bool("update", false, "update the parameters rows instead of only printing differences")
+  if err := fs.Parse(args); err != nil {
+    return 2
+  }
+  if *ursi == "" {
+    fmt.Fprintf(os.Stderr, "-ursi is required\n")
+    fs.Usage()
+    return 2
+  }
+  if cnf.ArchiveDir == "" {
+    fmt.Fprintf(os.Stderr, "No image archive, configure with environment variable ARCHIVE_DIR\n")
+    return 1
+  }
+  to := time.Now().UTC()
+  from := to.Add(-24 * time.Hour)
+  var err error
+  if *fromArg != "" {
+    if from, err = parseApiTime(*fromArg); err != nil {
+      fmt.Fprintf(os.Stderr, "Invalid -from: %v\n", err)
+      return 2
+    }
+  }
+  if *toArg != "" {
+    if to, err = parseApiEndTime(*toArg); err != nil {
+      fmt.Fprintf(os.Stderr, "Invalid -to: %v\n", err)
+      return 2
+    }
+  }
+  if to.Before(from) {
+    fmt.Fprintf(os.Stderr, "-to is before -from\n")
+    return 2
+  }
+
+  openDatabase()
+  defer db.Close()
+
+  i, err := getIonosondeByUrsi(*ursi)
+  if err != nil {
+    fmt.Fprintf(os.Stderr, "%v\n", err)
+    return 1
+  }
+  ionograms, err := getArchivedIonogramsFromDb(i.IonosondeId, from, to)
+  if err != nil {
+    fmt.Fprintf(os.Stderr, "Unable to query archived ionograms: %v\n", err)
+    return 1
+  }
+
+  changed, updated, failed := 0, 0, 0
+  for _, a := range ionograms {
+    old := a.Parameters
+    label := fmt.Sprintf("%s %s (parameterId %s)", i.UrsiCode, old.Date.UTC().Format(SqliteDateFormat), old.ParameterId)
+    img, err := loadImage(filepath.Join(cnf.ArchiveDir, a.File))
+    if err != nil {
+      fmt.Printf("%s: ERROR %v\n", label, err)
+      failed++
+      continue
+    }
+    p, err := interpretIonogram(i, img, a.Downloaded)
+    if err != nil {
+      fmt.Printf("%s: ERROR %v\n", label, err)
+      failed++
+      continue
+    }
+    p.ParameterId = old.ParameterId
+    prev, err := getPreviousParametersFromDb(i.IonosondeId, p.Date, p.ParameterId)
+    if err != nil {
+      fmt.Printf("%s: ERROR %v\n", label, err)
+      failed++
+      continue
+    }
+    validateParameters(&p, prev)
+    diff := parameterDiff(old, p)
+    if len(diff) == 0 {
+      continue
+    }
+    changed++
+    fmt.Printf("%s: %s\n", label, strings.Join(diff, ", "))
+    if ! *update {
+      continue
+    }
+    if ! p.Date.Equal(old.Date) {
+      var n int
+      err := db.QueryRow("select count(*) from parameters where ionosondeId=? and dt=? and parameterId<>?",
+                         i.IonosondeId, p.Date.UTC().Format(SqliteDateFormat), p.ParameterId).Scan(&n)
+      if err == nil && n > 0 {
+        err = fmt.Errorf("Another parameters row already has dt %s", p.Date.UTC().Format(SqliteDateFormat))
+      }
+      if err != nil {
+        fmt.Printf("%s: not updated: %v\n", label, err)
+        failed++
+        continue
+      }
+    }
+    if err := updateParameters(i, a, p); err != nil {
+      fmt.Printf("%s: not updated: %v\n", label, err)
+      failed++
+      continue
+    }
+    updated++
+  }
+  fmt.Printf("Reprocessed %d archived %s ionograms: %d changed, %d updated, %d failed\n",
+             len(ionograms), i.UrsiCode, changed, updated, failed)
+  if failed > 0 {
+    return 1
+  }
+  return 0
+}
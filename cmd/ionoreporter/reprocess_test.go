@@ -0,0 +1,79 @@
+package main
+
+import (
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "testing"
+  "time"
+)
+
+func TestUpdateParametersRenamesImage(t *testing.T) {
+  saved := *cnf
+  defer func() { *cnf = saved }()
+  dir := t.TempDir()
+  archive := filepath.Join(dir, "archive")
+  cnf.DatabaseFile = filepath.Join(dir, "ionoreporter.db")
+  cnf.ArchiveDir = archive
+  cnf.ArchiveLayout = "{ursi}/{year}/{month}/{day}"
+  openDatabase()
+  defer db.Close()
+
+  i, err := getIonosondeByUrsi("JR055")
+  if err != nil {
+    t.Fatal(err)
+  }
+  img := filepath.Join(dir, "JR055.png")
+  if err := ioutil.WriteFile(img, []byte("png"), 0644); err != nil {
+    t.Fatal(err)
+  }
+  // the date was read a day wrong when scraped
+  wrong := time.Date(2021, time.March, 21, 11, 15, 0, 0, time.UTC)
+  p := Parameters{ Date: wrong }
+  _, parameterId, err := insertParameters(i, &p)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if err := archiveImage(i, parameterId, wrong, wrong, "http://example.com/JR055.png", img); err != nil {
+    t.Fatal(err)
+  }
+  all := func() ([]archivedIonogram) {
+    ionograms, err := getArchivedIonogramsFromDb(i.IonosondeId, wrong.Add(-48 * time.Hour), wrong)
+    if err != nil || len(ionograms) != 1 {
+      t.Fatalf("%d archived ionograms: %v", len(ionograms), err)
+    }
+    return ionograms
+  }
+  a := all()[0]
+  right := a.Parameters
+  right.Date = time.Date(2021, time.March, 20, 11, 15, 0, 0, time.UTC)
+  file := archiveFile("JR055", right.Date, ".png")
+
+  // an image already at the new name is not overwritten
+  if err := os.MkdirAll(filepath.Dir(filepath.Join(archive, file)), 0755); err != nil {
+    t.Fatal(err)
+  }
+  if err := ioutil.WriteFile(filepath.Join(archive, file), nil, 0644); err != nil {
+    t.Fatal(err)
+  }
+  if err := updateParameters(i, a, right); err == nil {
+    t.Errorf("updateParameters over an existing image did not fail")
+  }
+  if b := all()[0]; b.File != a.File || ! b.Parameters.Date.Equal(wrong) {
+    t.Errorf("failed update changed the image to %s %s", b.File, b.Parameters.Date)
+  }
+  os.Remove(filepath.Join(archive, file))
+
+  if err := updateParameters(i, a, right); err != nil {
+    t.Fatal(err)
+  }
+  if b := all()[0]; b.File != file || ! b.Parameters.Date.Equal(right.Date) {
+    t.Errorf("image is %s %s, want %s %s", b.File, b.Parameters.Date, file, right.Date)
+  }
+  if data, err := ioutil.ReadFile(filepath.Join(archive, file)); err != nil || string(data) != "png" {
+    t.Errorf("renamed image %q: %v", data, err)
+  }
+  if _, err := os.Stat(filepath.Dir(filepath.Join(archive, a.File))); ! os.IsNotExist(err) {
+    t.Errorf("directory of the old name was not removed: %v", err)
+  }
+}
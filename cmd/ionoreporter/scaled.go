@@ -0,0 +1,202 @@
+package main
+
+import (
+  "bytes"
+  "crypto/sha256"
+  "database/sql"
+  "encoding/hex"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "net/http"
+  "sort"
+  "strings"
+  "time"
+
+  log "github.com/sirupsen/logrus"
+
+  "github.com/sa6mwa/ionoreporter/irdidbase"
+  "github.com/sa6mwa/ionoreporter/irsao"
+)
+
+/* Digisonde stations often publish the characteristics they autoscale as
+ * SAO 4.x or SAO-XML files. The sourceType of an ionosonde selects where its
+ * parameters come from:
+ *
+ * image    (or null) OCR of the ionogram at imageUrl
+ * sao      SAO 4.x file at dataUrl
+ * saoxml   SAO-XML file at dataUrl
+ * didbase  the last DIDBASE_WINDOW of characteristics queried from
+ *          DIDBASE_URL (or dataUrl if set) by the URSI code
+ *
+ * The newest record goes through the same plausibility checks and validation
+ * as OCR'd ionograms, older records in the same data (e.g readings missed
+ * while the daemon was down) are validated and inserted unless already in
+ * the database. There is no image to archive, reprocess or calibrate.
+ */
+
+const (
+  sourceImage string = "image"
+  sourceSAO string = irsao.FormatSAO
+  sourceSAOXML string = irsao.FormatSAOXML
+  sourceDidbase string = "didbase"
+
+  // maxDataSize limits the size of downloaded data files
+  maxDataSize int64 = 16 << 20
+)
+
+// sourceTypes lists the valid sourceType values
+var sourceTypes = []string{ sourceImage, sourceSAO, sourceSAOXML, sourceDidbase }
+
+/* sourceType() returns the source type of the ionosonde, image if not set */
+func (i Ionosonde) sourceType() (string) {
+  if ! i.SourceType.Valid || strings.TrimSpace(i.SourceType.String) == "" {
+    return sourceImage
+  }
+  return strings.ToLower(strings.TrimSpace(i.SourceType.String))
+}
+
+/* validateSourceType() checks that sourceType is one of sourceTypes */
+func validateSourceType(sourceType string) (error) {
+  for _, t := range sourceTypes {
+    if strings.ToLower(sourceType) == t {
+      return nil
+    }
+  }
+  return fmt.Errorf("Unknown source type %s, valid source types are %s", sourceType, strings.Join(sourceTypes, ", "))
+}
+
+/* downloadData() downloads url into memory and returns the data along with
+ * its Last-Modified time and hash.
+ */
+func downloadData(url string) ([]byte, download, error) {
+  d := download{}
+  resp, err := scrapeClient().Get(url)
+  if err != nil {
+    return nil, d, err
+  }
+  defer resp.Body.Close()
+  if resp.StatusCode != http.StatusOK {
+    return nil, d, httpStatusError{ resp.StatusCode, resp.Status }
+  }
+  d.LastModified = lastModified(resp)
+  data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxDataSize + 1))
+  if err != nil {
+    return nil, d, err
+  }
+  if int64(len(data)) > maxDataSize {
+    return nil, d, fmt.Errorf("File is larger than %d bytes", maxDataSize)
+  }
+  h := sha256.Sum256(data)
+  d.Hash = hex.EncodeToString(h[:])
+  return data, d, nil
+}
+
+/* scaledParameters() parses data of the source type of ionosonde i and
+ * returns its records as Parameters, oldest first.
+ */
+func scaledParameters(i Ionosonde, data []byte) ([]Parameters, error) {
+  var records []irsao.Record
+  var err error
+  if i.sourceType() == sourceDidbase {
+    records, err = irdidbase.Parse(bytes.NewReader(data))
+  } else {
+    records, err = irsao.Parse(i.sourceType(), data)
+  }
+  if err != nil {
+    return nil, err
+  }
+  sort.SliceStable(records, func(a, b int) bool {
+    return records[a].Time.Before(records[b].Time)
+  })
+  var parameters []Parameters
+  for _, r := range records {
+    if r.Station != "" && ! strings.EqualFold(r.Station, i.UrsiCode) {
+      return nil, fmt.Errorf("Data is from station %s, not %s", r.Station, i.UrsiCode)
+    }
+    p := Parameters{ IonosondeId: i.IonosondeId, Date: r.Time }
+    for _, v := range p.values() {
+      if f, ok := r.Values[v.Name]; ok {
+        *v.Value = sql.NullFloat64{ Float64: f, Valid: true }
+      }
+    }
+    parameters = append(parameters, p)
+  }
+  return parameters, nil
+}
+
+/* dataUrls() returns the URLs to try for the scaled data of ionosonde i, for
+ * didbase the query from from to to.
+ */
+func dataUrls(i Ionosonde, from, to time.Time) ([]string) {
+  var urls []string
+  if i.DataUrl.Valid {
+    for _, u := range strings.Split(i.DataUrl.String, `,`) {
+      if u = strings.TrimSpace(u); u != "" {
+        urls = append(urls, u)
+      }
+    }
+  }
+  if i.sourceType() != sourceDidbase {
+    return urls
+  }
+  if len(urls) == 0 {
+    urls = []string{ cnf.DidbaseUrl }
+  }
+  for n := range urls {
+    urls[n] = irdidbase.QueryUrl(urls[n], i.UrsiCode, from, to)
+  }
+  return urls
+}
+
+/* fetchScaledData() is fetchIonogram() for ionosondes with a sao, saoxml or
+ * didbase sourceType, the data is downloaded from the first working URL.
+ */
+func fetchScaledData(job scrapeJob) (scrapeJob) {
+  i := job.Ionosonde
+  urls := dataUrls(i, job.Start.Add(-cnf.DidbaseWindow), job.Start)
+  if len(urls) == 0 {
+    log.Errorf("Ionosonde %s has sourceType %s but no dataUrl", i.UrsiCode, i.sourceType())
+    log.Warning(job.skipmsg())
+    job.Failed = true
+    return job
+  }
+  var data []byte
+  var err error
+  for z := range urls {
+    var d download
+    data, d, err = downloadData(urls[z])
+    if err == nil {
+      job.Url = urls[z]
+      job.LastModified, job.Hash = d.LastModified, d.Hash
+      break
+    }
+  }
+  if err != nil {
+    log.Errorf("Error downloading %v: %v", urls, err)
+    log.Warning(job.skipmsg())
+    metricDownloadFailures.Inc(i.UrsiCode)
+    job.Failed = true
+    return job
+  }
+
+  if job.Rejected, job.RejectDetail = checkStaleImage(job); job.Rejected != "" {
+    return job
+  }
+
+  parameters, err := scaledParameters(i, data)
+  if err == nil && len(parameters) == 0 {
+    err = fmt.Errorf("No records")
+  }
+  if err != nil {
+    log.Errorf("Cannot parse %s data of %s from %s: %v", i.sourceType(), i.UrsiCode, job.Url, err)
+    log.Warning(job.skipmsg())
+    metricParseFailures.Inc(i.UrsiCode)
+    job.Failed = true
+    return job
+  }
+  job.Parameters = parameters[len(parameters) - 1]
+  job.Earlier = parameters[:len(parameters) - 1]
+  job.Rejected, job.RejectDetail = checkPlausibleDate(job)
+  return job
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+  "database/sql"
+  "net/http"
+  "net/http/httptest"
+  "path/filepath"
+  "testing"
+  "time"
+)
+
+/* TestDidbaseScrape serves the recorded DIDBase response of JR055 from a
+ * local stand-in (which ignores the query like the python3 -m http.server
+ * recipe in the README) and scrapes it into a fresh database.
+ */
+func TestDidbaseScrape(t *testing.T) {
+  server := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("..", "..", "irdidbase", "testdata"))))
+  defer server.Close()
+
+  saved := *cnf
+  defer func() { *cnf = saved }()
+  cnf.DatabaseFile = filepath.Join(t.TempDir(), "ionoreporter.db")
+  cnf.DateMaxAge = 0    // the fixture is from 2021
+  cnf.ArchiveDir = ""
+  openDatabase()
+  defer db.Close()
+
+  _, err := db.Exec("update ionosondes set sourceType=?, dataUrl=? where ursiCode=?",
+                    sourceDidbase, server.URL + "/JR055.txt", "JR055")
+  if err != nil {
+    t.Fatal(err)
+  }
+  count := func() int {
+    var n int
+    if err := db.QueryRow("select count(*) from parameters p join ionosondes i on i.ionosondeId=p.ionosondeId " +
+                          "where i.ursiCode=?", "JR055").Scan(&n); err != nil {
+      t.Fatal(err)
+    }
+    return n
+  }
+
+  result, err := scrape("where ursiCode=?", "JR055")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if result.Inserted != 1 || result.Failed != 0 {
+    t.Errorf("scrape = %+v, want the newest record inserted", result)
+  }
+  // the newest record and the 3 earlier ones in the response
+  if n := count(); n != 4 {
+    t.Fatalf("%d parameters rows after scrape, want 4", n)
+  }
+
+  var dt time.Time
+  var fof2, foes, fof1 sql.NullFloat64
+  err = db.QueryRow("select p.dt, p.fof2, p.foes, p.fof1 from parameters p join ionosondes i on " +
+                    "i.ionosondeId=p.ionosondeId where i.ursiCode=? order by p.dt desc limit 1", "JR055").Scan(&dt, &fof2, &foes, &fof1)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if want := time.Date(2021, time.February, 1, 10, 45, 0, 0, time.UTC); ! dt.Equal(want) {
+    t.Errorf("newest dt %s, want %s", dt, want)
+  }
+  if ! fof2.Valid || fof2.Float64 != 6.1 || foes.Valid || fof1.Valid {
+    t.Errorf("newest foF2 %v, foEs %v, foF1 %v, want 6.1 and two missing", fof2, foes, fof1)
+  }
+  err = db.QueryRow("select p.foes from parameters p join ionosondes i on i.ionosondeId=p.ionosondeId " +
+                    "where i.ursiCode=? and p.dt=?", "JR055", "2021-02-01 10:15:00").Scan(&foes)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if ! foes.Valid || foes.Float64 != 3.1 {
+    t.Errorf("foEs at 10:15 %v, want 3.1", foes)
+  }
+
+  // the same response again inserts nothing
+  if _, err := scrape("where ursiCode=?", "JR055"); err != nil {
+    t.Fatal(err)
+  }
+  if n := count(); n != 4 {
+    t.Errorf("%d parameters rows after scraping the same data again, want 4", n)
+  }
+}
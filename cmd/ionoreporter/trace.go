@@ -0,0 +1,71 @@
+package main
+
+import (
+  "database/sql"
+  "fmt"
+  "image"
+  "math"
+
+  log "github.com/sirupsen/logrus"
+
+  "github.com/sa6mwa/ionoreporter/irtrace"
+)
+
+/* Ionosondes with a traceCrop (the plot area of the ionogram) get the echo
+ * traces digitized by irtrace, after OCR, to fill in foF2, foE, fmin and h'F
+ * that are not printed (NA crops) or could not be read. traceFreqAxis and
+ * traceHeightAxis calibrate the axes with two points each as pixel=value,
+ * e.g "100=1,580=10,log" (MHz, x) and "400=100,40=700" (km, y), in the same
+ * image coordinates as the crops. traceColors overrides the trace colors
+ * (irtrace.DefaultColors) as "o=#ff0000,x=#00ff00,tolerance=80". Digitized
+ * values have no OCR confidence and are validated like any other.
+ */
+
+/* traceCalibration() returns the trace calibration of ionosonde i, ok is
+ * false if trace digitization is not enabled (no traceCrop).
+ */
+func traceCalibration(i Ionosonde) (c irtrace.Calibration, ok bool, err error) {
+  if ! i.TraceCrop.Valid {
+    return c, false, nil
+  }
+  c.Area, ok, err = parseCrop(i.TraceCrop.String)
+  if err != nil || ! ok {
+    return c, false, err
+  }
+  if ! i.TraceFreqAxis.Valid || ! i.TraceHeightAxis.Valid {
+    return c, false, fmt.Errorf("Ionosonde %s has a traceCrop but no traceFreqAxis or traceHeightAxis", i.UrsiCode)
+  }
+  if c.Freq, err = irtrace.ParseAxis(i.TraceFreqAxis.String); err != nil {
+    return c, false, fmt.Errorf("Invalid traceFreqAxis of %s: %v", i.UrsiCode, err)
+  }
+  if c.Height, err = irtrace.ParseAxis(i.TraceHeightAxis.String); err != nil {
+    return c, false, fmt.Errorf("Invalid traceHeightAxis of %s: %v", i.UrsiCode, err)
+  }
+  if c.Colors, err = irtrace.ParseColors(i.TraceColors.String); err != nil {
+    return c, false, fmt.Errorf("Invalid traceColors of %s: %v", i.UrsiCode, err)
+  }
+  return c, true, nil
+}
+
+/* digitizeMissing() digitizes the traces of img (unfiltered) and sets the
+ * values of p that are missing. Does nothing unless the ionosonde has a
+ * traceCrop.
+ */
+func digitizeMissing(i Ionosonde, img image.Image, p *Parameters) (error) {
+  c, ok, err := traceCalibration(i)
+  if err != nil || ! ok {
+    return err
+  }
+  res := irtrace.Digitize(img, c)
+  for _, v := range p.values() {
+    f, found := res.Values[v.Name]
+    if v.Value.Valid || ! found {
+      continue
+    }
+    f = math.Round(f * 100) / 100
+    *v.Value = sql.NullFloat64{ Float64: f, Valid: true }
+    *v.Conf = sql.NullFloat64{}
+    log.Infof("Digitized %s %.2f from the %s ionogram trace", v.Name, f, i.UrsiCode)
+  }
+  return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+  "flag"
+  "fmt"
+  "os"
+  "strings"
+
+  "github.com/sa6mwa/ionoreporter/irocr"
+)
+
+/* The train command adds templates for the template OCR engine. It cuts a
+ * crop box (e.g date) out of an ionogram, splits it into glyphs and saves
+ * every glyph as template of the corresponding character in -text, which
+ * must be exactly what is written in the crop. Glyphs already recognized
+ * with a near perfect score are not saved again.
+ */
+
+const trainSkipScore float64 = 0.98
+
+func cmdTrain(args []string) int {
+  fs := flag.NewFlagSet("train", flag.ContinueOnError)
+  ursi := fs.String("ursi", "", "URSI code of the ionosonde (required)")
+  imageFile := fs.String("image", "", "use this local ionogram instead of downloading it")
+  cropName := fs.String("crop", "date", "crop to train on: date, foF2, foF1, foE, fxI, foEs, fmin, hmF2 or hmE")
+  text := fs.String("text", "", "the text written in the crop (required)")
+  dir := fs.String("dir", cnf.OcrTemplates, "template directory")
+  if err := fs.Parse(args); err != nil {
+    return 2
+  }
+  if *ursi == "" || *text == "" {
+    fmt.Fprintf(os.Stderr, "-ursi and -text are required\n")
+    fs.Usage()
+    return 2
+  }
+  openDatabase()
+  defer db.Close()
+  i, err := getIonosondeByUrsi(*ursi)
+  if err != nil {
+    fmt.Fprintf(os.Stderr, "%v\n", err)
+    return 1
+  }
+  crop := namedCrop{}
+  for _, c := range ionosondeCrops(i) {
+    if strings.EqualFold(c.Name, *cropName) {
+      crop = c
+    }
+  }
+  if crop.Crop == "" {
+    fmt.Fprintf(os.Stderr, "Ionosonde %s has no %s crop\n", i.UrsiCode, *cropName)
+    return 1
+  }
+  opts, err := ocrOptions(i, crop.Name)
+  if err != nil {
+    fmt.Fprintf(os.Stderr, "%v\n", err)
+    return 1
+  }
+  source := *imageFile
+  if source == "" {
+    imgFile, _, err := downloadIonogram(i)
+    if err != nil {
+      fmt.Fprintf(os.Stderr, "Unable to download ionogram of %s: %v\n", i.UrsiCode, err)
+      return 1
+    }
+    defer os.Remove(imgFile)
+    source = imgFile
+  }
+  img, err := loadImage(source)
+  if err != nil {
+    fmt.Fprintf(os.Stderr, "Cannot decode ionogram %s: %v\n", source, err)
+    return 1
+  }
+  if i.Filter.Valid {
+    if img, err = applyFilter(img, i.Filter.String, i.UrsiCode); err != nil {
+      fmt.Fprintf(os.Stderr, "%v\n", err)
+      return 1
+    }
+  }
+  cut, ok, err := cropImage(img, crop.Crop)
+  if err != nil || ! ok {
+    fmt.Fprintf(os.Stderr, "Unable to cut %s crop %s: %v\n", crop.Name, crop.Crop, err)
+    return 1
+  }
+  // templates must be made from the crops as they are read
+  glyphs := irocr.Segment(irocr.Binarize(prepareCrop(cut, opts)))
+  chars := []rune(strings.Join(strings.Fields(*text), ""))
+  if len(glyphs) != len(chars) {
+    fmt.Fprintf(os.Stderr, "Found %d glyphs in the %s crop but -text has %d characters (spaces excluded), " +
+                "adjust the crop with calibrate\n", len(glyphs), crop.Name, len(chars))
+    return 1
+  }
+  // an empty or missing directory is fine, it is created by SaveTemplate
+  known, err := irocr.Load(*dir)
+  if err != nil {
+    known = irocr.New()
+  }
+  saved := 0
+  for n, g := range glyphs {
+    if c, score := known.Match(g.Bitmap); c == chars[n] && score >= trainSkipScore {
+      continue
+    }
+    file, err := irocr.SaveTemplate(*dir, chars[n], g.Bitmap)
+    if err != nil {
+      fmt.Fprintf(os.Stderr, "Unable to save template for %q: %v\n", chars[n], err)
+      return 1
+    }
+    fmt.Printf("Saved %q as %s\n", chars[n], file)
+    known.Templates = append(known.Templates, irocr.Template{ Char: chars[n], Glyph: g.Bitmap })
+    saved++
+  }
+  fmt.Printf("Saved %d new templates in %s (%d glyphs already known)\n", saved, *dir, len(glyphs) - saved)
+  return 0
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+  "database/sql"
+  "fmt"
+  "math"
+  "time"
+)
+
+/* Parsed parameters are validated before they are stored and every value
+ * gets a quality flag in the parameters table (the <column>Flag columns),
+ * null if the value passed all checks:
+ *
+ * range  outside 0.5-19.0 MHz (frequencies) or 60-999 km (heights)
+ * order  breaks fmin <= foE <= foF1 <= foF2 <= fxI or hmE < hmF2, both
+ *        values of the pair are flagged
+ * jump   changed more than 3 MHz or 150 km since the previous reading of
+ *        the ionosonde, if that is at most an hour older
+ *
+ * Flagged values are kept but left out of reports, forecasts and metrics.
+ */
+
+const (
+  flagRange string = "range"
+  flagOrder string = "order"
+  flagJump string = "jump"
+
+  validFrequencyMin float64 = 0.5
+  validFrequencyMax float64 = 19.0
+  validHeightMin float64 = 60.0
+  validHeightMax float64 = 999.0
+  jumpFrequencyMax float64 = 3.0
+  jumpHeightMax float64 = 150.0
+  jumpWindow time.Duration = time.Hour
+)
+
+// ParameterFlags are the quality flags of the values in Parameters
+type ParameterFlags struct {
+  FoF2 sql.NullString
+  FoF1 sql.NullString
+  FoE sql.NullString
+  FxI sql.NullString
+  FoEs sql.NullString
+  Fmin sql.NullString
+  HmF2 sql.NullString
+  HmE sql.NullString
+  HF sql.NullString
+}
+
+// ParameterConfidence is the OCR confidence (0-100) of the values in Parameters
+type ParameterConfidence struct {
+  FoF2 sql.NullFloat64
+  FoF1 sql.NullFloat64
+  FoE sql.NullFloat64
+  FxI sql.NullFloat64
+  FoEs sql.NullFloat64
+  Fmin sql.NullFloat64
+  HmF2 sql.NullFloat64
+  HmE sql.NullFloat64
+  HF sql.NullFloat64
+}
+
+// parameterValue is one value of Parameters with its flag, confidence and limits
+type parameterValue struct {
+  Name string
+  Value *sql.NullFloat64
+  Flag *sql.NullString
+  Conf *sql.NullFloat64
+  Min, Max, Jump float64
+}
+
+/* values() returns the values of p in the order of the parameters table
+ * columns, pointing into p.
+ */
+func (p *Parameters) values() ([]parameterValue) {
+  f, c := &p.Flags, &p.Confidence
+  qrg := func(name string, v *sql.NullFloat64, flag *sql.NullString, conf *sql.NullFloat64) parameterValue {
+    return parameterValue{ name, v, flag, conf, validFrequencyMin, validFrequencyMax, jumpFrequencyMax }
+  }
+  qah := func(name string, v *sql.NullFloat64, flag *sql.NullString, conf *sql.NullFloat64) parameterValue {
+    return parameterValue{ name, v, flag, conf, validHeightMin, validHeightMax, jumpHeightMax }
+  }
+  return []parameterValue{
+    qrg("foF2", &p.FoF2, &f.FoF2, &c.FoF2),
+    qrg("foF1", &p.FoF1, &f.FoF1, &c.FoF1),
+    qrg("foE", &p.FoE, &f.FoE, &c.FoE),
+    qrg("fxI", &p.FxI, &f.FxI, &c.FxI),
+    qrg("foEs", &p.FoEs, &f.FoEs, &c.FoEs),
+    qrg("fmin", &p.Fmin, &f.Fmin, &c.Fmin),
+    qah("hmF2", &p.HmF2, &f.HmF2, &c.HmF2),
+    qah("hmE", &p.HmE, &f.HmE, &c.HmE),
+    qah("hF", &p.HF, &f.HF, &c.HF),
+  }
+}
+
+// good returns true if the value is present and not flagged
+func (v parameterValue) good() (bool) {
+  return v.Value.Valid && ! v.Flag.Valid
+}
+
+func (v parameterValue) flag(flag string) {
+  if ! v.Flag.Valid {
+    *v.Flag = sql.NullString{ String: flag, Valid: true }
+  }
+}
+
+/* goodValue() returns v if it is not flagged, otherwise an invalid value */
+func goodValue(v sql.NullFloat64, flag sql.NullString) (sql.NullFloat64) {
+  if flag.Valid {
+    return sql.NullFloat64{}
+  }
+  return v
+}
+
+/* goodColumn() returns an SQL expression of a parameters column that is null
+ * if the value is flagged.
+ */
+func goodColumn(column string) (string) {
+  return fmt.Sprintf("(case when %sFlag is null then %s end)", column, column)
+}
+
+/* validateParameters() sets the quality flags of p, prev is the previous
+ * reading of the same ionosonde (nil if there is none).
+ */
+func validateParameters(p *Parameters, prev *Parameters) {
+  p.Flags = ParameterFlags{}
+  values := p.values()
+  byName := map[string]parameterValue{}
+  for _, v := range values {
+    byName[v.Name] = v
+    if v.Value.Valid && (v.Value.Float64 < v.Min || v.Value.Float64 > v.Max) {
+      v.flag(flagRange)
+    }
+  }
+
+  // each value must not be above the next one present in the chain
+  var last *parameterValue
+  for _, name := range []string{ "fmin", "foE", "foF1", "foF2", "fxI" } {
+    v := byName[name]
+    if ! v.good() {
+      continue
+    }
+    if last != nil && last.Value.Float64 > v.Value.Float64 {
+      last.flag(flagOrder)
+      v.flag(flagOrder)
+    }
+    last = &v
+  }
+  if hmE, hmF2 := byName["hmE"], byName["hmF2"]; hmE.good() && hmF2.good() && hmE.Value.Float64 >= hmF2.Value.Float64 {
+    hmE.flag(flagOrder)
+    hmF2.flag(flagOrder)
+  }
+
+  if prev == nil || p.Date.Sub(prev.Date) <= 0 || p.Date.Sub(prev.Date) > jumpWindow {
+    return
+  }
+  prevValues := prev.values()
+  for n, v := range values {
+    if v.good() && prevValues[n].good() && math.Abs(v.Value.Float64 - prevValues[n].Value.Float64) > v.Jump {
+      v.flag(flagJump)
+    }
+  }
+}
+
+/* flaggedValues() returns the flagged values of p as "name value (flag)"
+ * strings.
+ */
+func flaggedValues(p *Parameters) ([]string) {
+  var flagged []string
+  for _, v := range p.values() {
+    if v.Flag.Valid {
+      flagged = append(flagged, fmt.Sprintf("%s %s (%s)", v.Name, formatNullFloat64(*v.Value), v.Flag.String))
+    }
+  }
+  return flagged
+}
+
+/* getPreviousParametersFromDb() returns the newest parameters row of an
+ * ionosonde older than dt other than parameterId except (empty for none),
+ * nil if there is none.
+ */
+func getPreviousParametersFromDb(ionosondeId string, dt time.Time, except string) (*Parameters, error) {
+  p := &Parameters{}
+  err := db.QueryRow("select parameterId, ionosondeId, dt, " + parameterColumns + " from parameters " +
+                     "where ionosondeId=? and dt < ? and parameterId<>? order by dt desc limit 1", ionosondeId,
+                     dt.UTC().Format(SqliteDateFormat), except).Scan(append([]interface{}{ &p.ParameterId,
+                     &p.IonosondeId, &p.Date }, p.scanValues()...)...)
+  if err == sql.ErrNoRows {
+    return nil, nil
+  }
+  if err != nil {
+    return nil, err
+  }
+  return p, nil
+}
+
+// parameterColumns are the value, flag and confidence columns, see scanValues()
+const parameterColumns string = "fof2, fof1, foe, fxi, foes, fmin, hmf2, hme, hf, " +
+                                "fof2Flag, fof1Flag, foeFlag, fxiFlag, foesFlag, fminFlag, hmf2Flag, hmeFlag, hfFlag, " +
+                                "fof2Conf, fof1Conf, foeConf, fxiConf, foesConf, fminConf, hmf2Conf, hmeConf, hfConf, dtConf"
+
+/* scanValues() returns pointers to scan parameterColumns into */
+func (p *Parameters) scanValues() ([]interface{}) {
+  var dest, flags, confs []interface{}
+  for _, v := range p.values() {
+    dest = append(dest, v.Value)
+    flags = append(flags, v.Flag)
+    confs = append(confs, v.Conf)
+  }
+  return append(append(append(dest, flags...), confs...), &p.DtConf)
+}
+
+/* columnValues() returns the values of parameterColumns for insert and
+ * update statements.
+ */
+func (p *Parameters) columnValues() ([]interface{}) {
+  var values, flags, confs []interface{}
+  for _, v := range p.values() {
+    values = append(values, *v.Value)
+    flags = append(flags, *v.Flag)
+    confs = append(confs, *v.Conf)
+  }
+  return append(append(append(values, flags...), confs...), p.DtConf)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+  "database/sql"
+  "testing"
+  "time"
+)
+
+var validateDate = time.Date(2021, time.March, 20, 12, 0, 0, 0, time.UTC)
+
+/* testParameters returns parameters at validateDate plus age with values
+ * by name (as in values()), flags are set from flags by name.
+ */
+func testParameters(age time.Duration, values map[string]float64, flags map[string]string) (*Parameters) {
+  p := &Parameters{ Date: validateDate.Add(age) }
+  for _, v := range p.values() {
+    if f, ok := values[v.Name]; ok {
+      *v.Value = sql.NullFloat64{ Float64: f, Valid: true }
+    }
+    if flag, ok := flags[v.Name]; ok {
+      *v.Flag = sql.NullString{ String: flag, Valid: true }
+    }
+  }
+  return p
+}
+
+func TestValidateParameters(t *testing.T) {
+  normal := map[string]float64{ "fmin": 1.6, "foE": 2.7, "foF1": 4.1, "foF2": 6.2, "fxI": 6.9,
+                                "foEs": 3.5, "hmE": 110, "hmF2": 260, "hF": 220 }
+  with := func(changes map[string]float64) map[string]float64 {
+    m := map[string]float64{}
+    for n, v := range normal {
+      m[n] = v
+    }
+    for n, v := range changes {
+      if v < 0 {
+        delete(m, n)
+      } else {
+        m[n] = v
+      }
+    }
+    return m
+  }
+  cases := []struct {
+    name string
+    values map[string]float64
+    prev *Parameters
+    want map[string]string
+  }{
+    { "plausible", normal, nil, nil },
+    { "nothing read", map[string]float64{}, nil, nil },
+    // foEs may be above foF2 and is not in the chain
+    { "strong sporadic E", with(map[string]float64{ "foEs": 9.5 }), nil, nil },
+    { "frequency too high", with(map[string]float64{ "foF2": 51.25, "fxI": -1 }), nil,
+      map[string]string{ "foF2": flagRange } },
+    { "frequency too low", with(map[string]float64{ "fmin": 0.2 }), nil, map[string]string{ "fmin": flagRange } },
+    { "height too high", with(map[string]float64{ "hmF2": 1262 }), nil, map[string]string{ "hmF2": flagRange } },
+    { "height too low", with(map[string]float64{ "hF": 22 }), nil, map[string]string{ "hF": flagRange } },
+    { "foE above foF1", with(map[string]float64{ "foE": 4.5 }), nil,
+      map[string]string{ "foE": flagOrder, "foF1": flagOrder } },
+    { "foF1 above foF2", with(map[string]float64{ "foF1": 6.5 }), nil,
+      map[string]string{ "foF1": flagOrder, "foF2": flagOrder } },
+    // without foF1 foE is compared with foF2
+    { "foE above foF2 without foF1", with(map[string]float64{ "foF1": -1, "foE": 6.5 }), nil,
+      map[string]string{ "foE": flagOrder, "foF2": flagOrder } },
+    // a value out of range is not compared, 5.125 read as 51.25
+    { "order skips range flagged", with(map[string]float64{ "foF2": 51.25 }), nil,
+      map[string]string{ "foF2": flagRange } },
+    { "hmE above hmF2", with(map[string]float64{ "hmE": 280 }), nil,
+      map[string]string{ "hmE": flagOrder, "hmF2": flagOrder } },
+    { "jump", with(map[string]float64{ "foF2": 9.8, "fxI": 10.5 }), testParameters(-15 * time.Minute, normal, nil),
+      map[string]string{ "foF2": flagJump, "fxI": flagJump } },
+    { "height jump", with(map[string]float64{ "hmF2": 420 }), testParameters(-15 * time.Minute, normal, nil),
+      map[string]string{ "hmF2": flagJump } },
+    { "no jump after an hour", with(map[string]float64{ "foF2": 9.8, "fxI": 10.5 }), testParameters(-2 * time.Hour, normal, nil), nil },
+    { "previous is newer", with(map[string]float64{ "foF2": 9.8, "fxI": 10.5 }), testParameters(15 * time.Minute, normal, nil), nil },
+    // the previous foF2 was flagged, it can not tell a jump
+    { "jump from a flagged value", normal,
+      testParameters(-15 * time.Minute, with(map[string]float64{ "foF2": 2.1 }), map[string]string{ "foF2": flagJump }), nil },
+    { "jump from a missing value", normal, testParameters(-15 * time.Minute, with(map[string]float64{ "foF2": -1 }), nil), nil },
+    { "missing value does not jump", with(map[string]float64{ "foF2": -1 }), testParameters(-15 * time.Minute, normal, nil), nil },
+  }
+  for _, c := range cases {
+    p := testParameters(0, c.values, map[string]string{ "foF2": "stale flag" })
+    validateParameters(p, c.prev)
+    for _, v := range p.values() {
+      want, flagged := c.want[v.Name]
+      if v.Flag.Valid != flagged || v.Flag.String != want {
+        t.Errorf("%s: %s %s flagged %q (%t), want %q", c.name, v.Name, formatNullFloat64(*v.Value), v.Flag.String, v.Flag.Valid, want)
+      }
+      if _, ok := c.values[v.Name]; ok != v.Value.Valid {
+        t.Errorf("%s: %s changed to %v", c.name, v.Name, *v.Value)
+      }
+    }
+  }
+}
+
+func TestGoodValue(t *testing.T) {
+  v := sql.NullFloat64{ Float64: 5.1, Valid: true }
+  if goodValue(v, sql.NullString{}) != v {
+    t.Errorf("goodValue of an unflagged value is not the value")
+  }
+  if goodValue(v, sql.NullString{ String: flagJump, Valid: true }).Valid {
+    t.Errorf("goodValue of a flagged value is valid")
+  }
+}
@@ -307,7 +307,10 @@ insert into ionosondes (ursiCode, name, latitude, longitude, imageUrl, filter, d
 
 `
 
+/* InitDB initializes an empty database or upgrades an existing one by
+ * applying all pending migrations, see Migrate().
+ */
 func InitDB(db *sql.DB) (error) {
-  _, err := db.Exec(createdbsql)
+  _, err := Migrate(db, false)
   return err
 }
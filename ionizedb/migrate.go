@@ -0,0 +1,700 @@
+package ionizedb
+
+import (
+  "database/sql"
+  "fmt"
+)
+
+/* Migrations are applied in order by Migrate(). The schema version of the
+ * database is kept in PRAGMA user_version, each migration is applied inside a
+ * transaction together with setting user_version to the migration's Version.
+ * Never change a released migration, append a new one instead.
+ */
+
+type Migration struct {
+  Version int
+  Description string
+  SQL string
+}
+
+var Migrations = []Migration{
+  {
+    Version: 1,
+    Description: "Create ionosondes and parameters tables (3.1.0 schema)",
+    SQL: createdbsql,
+  },
+  {
+    Version: 2,
+    Description: "Create images table for the raw ionogram archive",
+    SQL: createimagessql,
+  },
+  {
+    Version: 3,
+    Description: "Add ocrEngine column to ionosondes",
+    SQL: "alter table ionosondes add column ocrEngine varchar(32) null;",
+  },
+  {
+    Version: 4,
+    Description: "Add OCR settings columns to ionosondes",
+    SQL: createocrsettingssql,
+  },
+  {
+    Version: 5,
+    Description: "Add rejections table and last image hash of ionosondes",
+    SQL: createrejectionssql,
+  },
+  {
+    Version: 6,
+    Description: "Add quality flag columns to parameters",
+    SQL: createparameterflagssql,
+  },
+  {
+    Version: 7,
+    Description: "Add OCR confidence columns to parameters and ocrMinConfidence to ionosondes",
+    SQL: createconfidencesql,
+  },
+  {
+    Version: 8,
+    Description: "Add sourceType and dataUrl columns to ionosondes",
+    SQL: createsourcetypesql,
+  },
+  {
+    Version: 9,
+    Description: "Add historyUrl to ionosondes and backfills table",
+    SQL: createbackfillssql,
+  },
+  {
+    Version: 10,
+    Description: "Add h'F to parameters and trace calibration columns to ionosondes",
+    SQL: createtracesql,
+  },
+  {
+    Version: 11,
+    Description: "Add layouts table and layoutId to ionosondes, dateFormat and dateCrop may be null",
+    SQL: createlayoutssql,
+  },
+  {
+    Version: 12,
+    Description: "Add anchorCrop to ionosondes and layouts",
+    SQL: createanchorcropsql,
+  },
+  {
+    Version: 13,
+    Description: "Add ocrPreprocess to ionosondes",
+    SQL: createocrpreprocesssql,
+  },
+}
+
+/* createocrpreprocesssql adds the filter pipeline applied to every crop
+ * before OCR, null is the default (see ocroptions.go of ionoreporter).
+ */
+const createocrpreprocesssql string = `
+alter table ionosondes add column ocrPreprocess varchar(256) null;
+`
+
+/* createanchorcropsql adds the header region that is read to locate the
+ * crops from the labels in it, null disables locating.
+ */
+const createanchorcropsql string = `
+alter table ionosondes add column anchorCrop varchar(20) null;
+alter table layouts add column anchorCrop varchar(20) null;
+`
+
+/* createlayoutssql adds layouts, the date format, crops and filter of an
+ * ionogram layout shared by several ionosondes (e.g all served by lgdc).
+ * Columns of an ionosonde override its layout, null means the layout's
+ * value. dateFormat and dateCrop of ionosondes become nullable, which
+ * requires rebuilding the table. The identical lgdc ionosondes are moved to
+ * an lgdc layout unless their crops have been changed.
+ */
+const createlayoutssql string = `
+create table layouts (
+  layoutId integer primary key autoincrement,
+  name varchar(64) not null,
+  filter varchar(64) null,
+  dateFormat varchar(32) null,
+  dateCrop varchar(20) null,
+  fof2Crop varchar(20) null,
+  fof1Crop varchar(20) null,
+  foeCrop varchar(20) null,
+  fxiCrop varchar(20) null,
+  foesCrop varchar(20) null,
+  fminCrop varchar(20) null,
+  hmf2Crop varchar(20) null,
+  hmeCrop varchar(20) null
+);
+
+create unique index layouts_name on layouts(name);
+
+create table new_ionosondes (
+  ionosondeId integer primary key autoincrement,
+  ursiCode varchar(16) not null,
+  name varchar(64) not null,
+  latitude float not null,
+  longitude float not null,
+  imageUrl varchar(1024) not null,
+  layoutId integer null,
+  filter varchar(64) null,
+  dateFormat varchar(32) null,
+  dateCrop varchar(20) null,
+  fof2Crop varchar(20) null,
+  fof1Crop varchar(20) null,
+  foeCrop varchar(20) null,
+  fxiCrop varchar(20) null,
+  foesCrop varchar(20) null,
+  fminCrop varchar(20) null,
+  hmf2Crop varchar(20) null,
+  hmeCrop varchar(20) null,
+  scrape boolean default 1,
+  enabled boolean default 0,
+  ocrEngine varchar(32) null,
+  ocrLanguage varchar(32) null,
+  ocrPsm integer null,
+  ocrScale float null,
+  ocrNumericWhitelist varchar(128) null,
+  ocrDateWhitelist varchar(128) null,
+  ocrFieldOptions varchar(1024) null,
+  lastImageHash varchar(64) null,
+  lastImageChanged datetime null,
+  ocrMinConfidence float null,
+  sourceType varchar(16) null,
+  dataUrl varchar(1024) null,
+  historyUrl varchar(1024) null,
+  traceCrop varchar(20) null,
+  traceFreqAxis varchar(64) null,
+  traceHeightAxis varchar(64) null,
+  traceColors varchar(64) null
+);
+
+insert into new_ionosondes(ionosondeId, ursiCode, name, latitude, longitude,
+  imageUrl, filter, dateFormat, dateCrop, fof2Crop, fof1Crop, foeCrop, fxiCrop,
+  foesCrop, fminCrop, hmf2Crop, hmeCrop, scrape, enabled, ocrEngine,
+  ocrLanguage, ocrPsm, ocrScale, ocrNumericWhitelist, ocrDateWhitelist,
+  ocrFieldOptions, lastImageHash, lastImageChanged, ocrMinConfidence,
+  sourceType, dataUrl, historyUrl, traceCrop, traceFreqAxis, traceHeightAxis,
+  traceColors)
+  select ionosondeId, ursiCode, name, latitude, longitude,
+  imageUrl, filter, dateFormat, dateCrop, fof2Crop, fof1Crop, foeCrop, fxiCrop,
+  foesCrop, fminCrop, hmf2Crop, hmeCrop, scrape, enabled, ocrEngine,
+  ocrLanguage, ocrPsm, ocrScale, ocrNumericWhitelist, ocrDateWhitelist,
+  ocrFieldOptions, lastImageHash, lastImageChanged, ocrMinConfidence,
+  sourceType, dataUrl, historyUrl, traceCrop, traceFreqAxis, traceHeightAxis,
+  traceColors from ionosondes;
+
+drop table ionosondes;
+
+alter table new_ionosondes rename to ionosondes;
+
+insert into layouts (name, filter, dateFormat, dateCrop, fof2Crop, fof1Crop,
+    foeCrop, fxiCrop, foesCrop, fminCrop, hmf2Crop, hmeCrop)
+  values (
+    "lgdc",
+    null,
+    "2006 Jan02 002 150405",
+    "323,30,197,17",
+    "60,50,66,15",
+    "60,67,66,15",
+    "60,99,66,15",
+    "60,130,66,15",
+    "60,147,66,15",
+    "60,162,66,15",
+    "60,314,66,15",
+    "60,346,66,15"
+);
+
+update ionosondes set layoutId=(select layoutId from layouts where name="lgdc"),
+    dateFormat=null, dateCrop=null, fof2Crop=null, fof1Crop=null, foeCrop=null,
+    fxiCrop=null, foesCrop=null, fminCrop=null, hmf2Crop=null, hmeCrop=null
+  where imageUrl like "%lgdc.uml.edu%" and filter is null
+    and dateFormat="2006 Jan02 002 150405" and dateCrop="323,30,197,17"
+    and fof2Crop="60,50,66,15" and fof1Crop="60,67,66,15"
+    and foeCrop="60,99,66,15" and fxiCrop="60,130,66,15"
+    and foesCrop="60,147,66,15" and fminCrop="60,162,66,15"
+    and hmf2Crop="60,314,66,15" and hmeCrop="60,346,66,15";
+`
+
+/* createtracesql adds h'F (lowest virtual height of the F trace) to
+ * parameters and the plot area, axes and trace colors of ionograms used to
+ * digitize the traces (see irtrace).
+ */
+const createtracesql string = `
+alter table parameters add column hf float null;
+alter table parameters add column hfFlag varchar(16) null;
+alter table parameters add column hfConf float null;
+alter table ionosondes add column traceCrop varchar(20) null;
+alter table ionosondes add column traceFreqAxis varchar(64) null;
+alter table ionosondes add column traceHeightAxis varchar(64) null;
+alter table ionosondes add column traceColors varchar(64) null;
+`
+
+/* createbackfillssql adds the URL template of historical ionograms (or data
+ * files) of an ionosonde and the progress of backfill runs, so an
+ * interrupted backfill resumes after doneUntil.
+ */
+const createbackfillssql string = `
+alter table ionosondes add column historyUrl varchar(1024) null;
+
+create table backfills (
+  backfillId integer primary key not null,
+  ionosondeId integer not null,
+  fromDt datetime not null,
+  toDt datetime not null,
+  doneUntil datetime null,
+  started datetime not null,
+  updated datetime null,
+  finished datetime null,
+  inserted integer not null default 0,
+  duplicates integer not null default 0,
+  missing integer not null default 0,
+  failed integer not null default 0
+);
+
+create unique index backfills_ionosondeId_fromDt_toDt on backfills(ionosondeId, fromDt, toDt);
+`
+
+/* createsourcetypesql adds the source of the parameters of an ionosonde,
+ * null (or image) is OCR of the ionogram at imageUrl, sao and saoxml are
+ * scaled characteristics files at dataUrl.
+ */
+const createsourcetypesql string = `
+alter table ionosondes add column sourceType varchar(16) null;
+alter table ionosondes add column dataUrl varchar(1024) null;
+`
+
+/* createconfidencesql adds the OCR confidence (0-100) of each value and the
+ * date to parameters and a minimum confidence per ionosonde, values below it
+ * are discarded.
+ */
+const createconfidencesql string = `
+alter table parameters add column fof2Conf float null;
+alter table parameters add column fof1Conf float null;
+alter table parameters add column foeConf float null;
+alter table parameters add column fxiConf float null;
+alter table parameters add column foesConf float null;
+alter table parameters add column fminConf float null;
+alter table parameters add column hmf2Conf float null;
+alter table parameters add column hmeConf float null;
+alter table parameters add column dtConf float null;
+alter table ionosondes add column ocrMinConfidence float null;
+`
+
+/* createparameterflagssql adds a quality flag per value to parameters, null
+ * is a value that passed validation (see validate.go of ionoreporter).
+ */
+const createparameterflagssql string = `
+alter table parameters add column fof2Flag varchar(16) null;
+alter table parameters add column fof1Flag varchar(16) null;
+alter table parameters add column foeFlag varchar(16) null;
+alter table parameters add column fxiFlag varchar(16) null;
+alter table parameters add column foesFlag varchar(16) null;
+alter table parameters add column fminFlag varchar(16) null;
+alter table parameters add column hmf2Flag varchar(16) null;
+alter table parameters add column hmeFlag varchar(16) null;
+`
+
+/* createrejectionssql creates the rejections table recording ionograms that
+ * failed the plausibility checks (see DATE_MAXAGE and DATE_MAXFUTURE) and
+ * adds the hash of the last downloaded image to ionosondes to detect
+ * stations serving the same image. dt is null if the image was rejected
+ * before reading the date.
+ */
+const createrejectionssql string = `
+create table rejections (
+  rejectionId integer primary key not null,
+  ionosondeId integer not null,
+  dt datetime null,
+  downloaded datetime not null,
+  lastModified datetime null,
+  url varchar(1024) not null,
+  reason varchar(16) not null,
+  detail varchar(1024) not null
+);
+
+create index rejections_ionosondeId_downloaded on rejections(ionosondeId, downloaded);
+
+alter table ionosondes add column lastImageHash varchar(64) null;
+alter table ionosondes add column lastImageChanged datetime null;
+`
+
+/* createocrsettingssql adds per ionosonde OCR settings, null is the engine's
+ * default.
+ */
+const createocrsettingssql string = `
+alter table ionosondes add column ocrLanguage varchar(32) null;
+alter table ionosondes add column ocrPsm integer null;
+alter table ionosondes add column ocrScale float null;
+alter table ionosondes add column ocrNumericWhitelist varchar(128) null;
+alter table ionosondes add column ocrDateWhitelist varchar(128) null;
+alter table ionosondes add column ocrFieldOptions varchar(1024) null;
+`
+
+/* createimagessql creates the images table keeping track of archived raw
+ * ionograms (see ARCHIVE_DIR). file is relative to the archive directory.
+ */
+const createimagessql string = `
+create table images (
+  imageId integer primary key not null,
+  parameterId integer not null,
+  ionosondeId integer not null,
+  dt datetime not null,
+  downloaded datetime not null,
+  url varchar(1024) not null,
+  file varchar(1024) not null,
+  size integer not null
+);
+
+create index images_parameterId on images(parameterId);
+create index images_downloaded on images(downloaded);
+`
+
+/* Databases created before schema versioning was introduced have
+ * user_version 0 but already contain tables. A 3.1.x database is adopted as
+ * version 1 as is, a 3.0.0 database (without latitude and longitude in the
+ * ionosondes table) is upgraded to version 1 with upgrade300to310sql
+ * (previously upgrade/upgrade-db-from-300-to-310.sql).
+ */
+var (
+  adoptMigration = Migration{
+    Version: 1,
+    Description: "Adopt existing unversioned 3.1.x database as schema version 1",
+    SQL: "",
+  }
+  upgrade300Migration = Migration{
+    Version: 1,
+    Description: "Upgrade unversioned 3.0.0 database to schema version 1 (3.1.0 schema)",
+    SQL: upgrade300to310sql,
+  }
+)
+
+/* LatestVersion returns the schema version after all migrations */
+func LatestVersion() int {
+  return Migrations[len(Migrations)-1].Version
+}
+
+/* Version returns the schema version of the database, 0 is an empty or
+ * unversioned database.
+ */
+func Version(db *sql.DB) (int, error) {
+  var v int
+  err := db.QueryRow("pragma user_version").Scan(&v)
+  return v, err
+}
+
+func tableExists(db *sql.DB, table string) (bool, error) {
+  var n int
+  err := db.QueryRow("select count(*) from sqlite_master where type='table' and name=?", table).Scan(&n)
+  return n > 0, err
+}
+
+func columnExists(db *sql.DB, table, column string) (bool, error) {
+  rows, err := db.Query(fmt.Sprintf("pragma table_info(%s)", table))
+  if err != nil {
+    return false, err
+  }
+  defer rows.Close()
+  for rows.Next() {
+    var cid, notnull, pk int
+    var name, ctype string
+    var dflt sql.NullString
+    if err := rows.Scan(&cid, &name, &ctype, &notnull, &dflt, &pk); err != nil {
+      return false, err
+    }
+    if name == column {
+      return true, nil
+    }
+  }
+  return false, rows.Err()
+}
+
+/* Pending returns the migrations needed to bring the database to
+ * LatestVersion(), in the order they will be applied.
+ */
+func Pending(db *sql.DB) ([]Migration, error) {
+  var pending []Migration
+  version, err := Version(db)
+  if err != nil {
+    return pending, err
+  }
+  if version == 0 {
+    exists, err := tableExists(db, "ionosondes")
+    if err != nil {
+      return pending, err
+    }
+    if exists {
+      hasLatitude, err := columnExists(db, "ionosondes", "latitude")
+      if err != nil {
+        return pending, err
+      }
+      if hasLatitude {
+        pending = append(pending, adoptMigration)
+      } else {
+        pending = append(pending, upgrade300Migration)
+      }
+      version = 1
+    }
+  }
+  if version > LatestVersion() {
+    return pending, fmt.Errorf("Database schema version %d is newer than supported version %d", version, LatestVersion())
+  }
+  for _, m := range Migrations {
+    if m.Version > version {
+      pending = append(pending, m)
+    }
+  }
+  return pending, nil
+}
+
+/* Migrate applies all pending migrations, each in its own transaction. If
+ * dryRun is true nothing is changed. Returns the migrations that were (or
+ * would have been) applied.
+ */
+func Migrate(db *sql.DB, dryRun bool) ([]Migration, error) {
+  pending, err := Pending(db)
+  if err != nil || dryRun {
+    return pending, err
+  }
+  for n, m := range pending {
+    if err := apply(db, m); err != nil {
+      return pending[:n], fmt.Errorf("Migration to version %d (%s) failed: %v", m.Version, m.Description, err)
+    }
+  }
+  return pending, nil
+}
+
+func apply(db *sql.DB, m Migration) error {
+  tx, err := db.Begin()
+  if err != nil {
+    return err
+  }
+  if m.SQL != "" {
+    if _, err := tx.Exec(m.SQL); err != nil {
+      tx.Rollback()
+      return err
+    }
+  }
+  if _, err := tx.Exec(fmt.Sprintf("pragma user_version = %d", m.Version)); err != nil {
+    tx.Rollback()
+    return err
+  }
+  return tx.Commit()
+}
+
+/* upgrade300to310sql upgrades the database released with version 3.0.0 to
+ * support version 3.1.0 with added columns latitude and longitude to the
+ * ionosondes table. It will also add several new ionosondes.
+ */
+const upgrade300to310sql string = `
+create table new_ionosondes (
+  ionosondeId integer primary key autoincrement,
+  ursiCode varchar(16) not null,
+  name varchar(64) not null,
+  latitude float null,
+  longitude float null,
+  imageUrl varchar(1024) not null,
+  filter varchar(64) null,
+  dateFormat varchar(32) not null,
+  dateCrop varchar(20) not null,
+  fof2Crop varchar(20) null,
+  fof1Crop varchar(20) null,
+  foeCrop varchar(20) null,
+  fxiCrop varchar(20) null,
+  foesCrop varchar(20) null,
+  fminCrop varchar(20) null,
+  hmf2Crop varchar(20) null,
+  hmeCrop varchar(20) null,
+  scrape boolean default 1,
+  enabled boolean default 0
+);
+
+insert into new_ionosondes(ionosondeId, ursiCode, name,
+  imageUrl, filter, dateFormat,
+  dateCrop, fof2Crop, fof1Crop, foeCrop, fxiCrop, foesCrop,
+  fminCrop, hmf2Crop, hmeCrop, scrape, enabled)
+  select ionosondeId, ursiCode, name, imageUrl, filter, dateFormat,
+  dateCrop, fof2Crop, fof1Crop, foeCrop, fxiCrop, foesCrop,
+  fminCrop, hmf2Crop, hmeCrop, scrape, enabled from ionosondes;
+
+update new_ionosondes set latitude=54.62863, longitude=13.37433 where ursiCode="JR055";
+update new_ionosondes set latitude=59.6, longitude=19.2 where ursiCode="TR169";
+update new_ionosondes set latitude=37.9, longitude=284.5 where ursiCode="WP937";
+update new_ionosondes set latitude=50.1, longitude=4.6 where ursiCode="DB049";
+update new_ionosondes set latitude=41.8, longitude=12.5 where ursiCode="RA041";
+
+drop table ionosondes;
+
+create table ionosondes (
+  ionosondeId integer primary key autoincrement,
+  ursiCode varchar(16) not null,
+  name varchar(64) not null,
+  latitude float not null,
+  longitude float not null,
+  imageUrl varchar(1024) not null,
+  filter varchar(64) null,
+  dateFormat varchar(32) not null,
+  dateCrop varchar(20) not null,
+  fof2Crop varchar(20) null,
+  fof1Crop varchar(20) null,
+  foeCrop varchar(20) null,
+  fxiCrop varchar(20) null,
+  foesCrop varchar(20) null,
+  fminCrop varchar(20) null,
+  hmf2Crop varchar(20) null,
+  hmeCrop varchar(20) null,
+  scrape boolean default 1,
+  enabled boolean default 0
+);
+
+insert into ionosondes(ionosondeId, ursiCode, name, latitude, longitude,
+  imageUrl, filter, dateFormat,
+  dateCrop, fof2Crop, fof1Crop, foeCrop, fxiCrop, foesCrop,
+  fminCrop, hmf2Crop, hmeCrop, scrape, enabled)
+  select ionosondeId, ursiCode, name, latitude, longitude, imageUrl, filter,
+  dateFormat, dateCrop, fof2Crop, fof1Crop, foeCrop, fxiCrop, foesCrop,
+  fminCrop, hmf2Crop, hmeCrop, scrape, enabled from new_ionosondes;
+
+drop table new_ionosondes;
+
+-- disable and do not scrape ionogram RA041, replace with RO041
+update ionosondes set scrape=0, enabled=0 where ursiCode="RA041";
+-- disable DB049 Dourbes, Chilton will replace it
+update ionosondes set enabled=0 where ursiCode="DB049";
+
+-- add ionogram EG931, THJ76, EB040, and RO041
+insert into ionosondes (ursiCode, name, latitude, longitude, imageUrl, filter, dateFormat,
+    dateCrop, fof2Crop, fof1Crop, foeCrop, fxiCrop, foesCrop, fminCrop,
+    hmf2Crop, hmeCrop, scrape, enabled)
+  values (
+    "EG931",
+    "Eglin AFB",
+    30.5, 273.5,
+    "https://lgdc.uml.edu/common/ShowRandomIonogram?ursiCode=EG931",
+    null,
+    "2006 Jan02 002 150405",
+    "325,30,195,17",
+    "61,50,65,15",
+    "61,66,65,15",
+    "61,99,65,15",
+    "61,130,65,15",
+    "61,147,65,15",
+    "61,162,65,15",
+    "61,314,65,15",
+    "61,346,65,15",
+    1,
+    1
+);
+
+insert into ionosondes (ursiCode, name, latitude, longitude, imageUrl, filter, dateFormat,
+    dateCrop, fof2Crop, fof1Crop, foeCrop, fxiCrop, foesCrop, fminCrop,
+    hmf2Crop, hmeCrop, scrape, enabled)
+  values (
+    "THJ76",
+    "Thule",
+    76.5, 291.6,
+    "https://lgdc.uml.edu/common/ShowRandomIonogram?ursiCode=THJ76",
+    null,
+    "2006 Jan02 002 150405",
+    "323,30,197,17",
+    "60,50,66,15",
+    "60,67,66,15",
+    "60,99,66,15",
+    "60,130,66,15",
+    "60,147,66,15",
+    "60,162,66,15",
+    "60,314,66,15",
+    "60,346,66,15",
+    1,
+    0
+);
+
+insert into ionosondes (ursiCode, name, latitude, longitude, imageUrl, filter, dateFormat,
+    dateCrop, fof2Crop, fof1Crop, foeCrop, fxiCrop, foesCrop, fminCrop,
+    hmf2Crop, hmeCrop, scrape, enabled)
+  values (
+    "EB040",
+    "Roquetes",
+    40.8, 0.5,
+    "https://lgdc.uml.edu/common/ShowRandomIonogram?ursiCode=EB040",
+    null,
+    "2006 Jan02 002 150405",
+    "323,30,197,17",
+    "60,50,66,15",
+    "60,67,66,15",
+    "60,99,66,15",
+    "60,130,66,15",
+    "60,147,66,15",
+    "60,162,66,15",
+    "60,314,66,15",
+    "60,346,66,15",
+    1,
+    1
+);
+
+insert into ionosondes (ursiCode, name, latitude, longitude, imageUrl, filter, dateFormat,
+    dateCrop, fof2Crop, fof1Crop, foeCrop, fxiCrop, foesCrop, fminCrop,
+    hmf2Crop, hmeCrop, scrape, enabled)
+  values (
+    "RO041",
+    "Rome",
+    41.9, 12.5,
+    "https://lgdc.uml.edu/common/ShowRandomIonogram?ursiCode=RO041",
+    null,
+    "2006 Jan02 002 150405",
+    "323,30,197,17",
+    "60,50,66,15",
+    "60,67,66,15",
+    "60,99,66,15",
+    "60,130,66,15",
+    "60,147,66,15",
+    "60,162,66,15",
+    "60,314,66,15",
+    "60,346,66,15",
+    1,
+    0
+);
+
+insert into ionosondes (ursiCode, name, latitude, longitude, imageUrl, filter, dateFormat,
+    dateCrop, fof2Crop, fof1Crop, foeCrop, fxiCrop, foesCrop, fminCrop,
+    hmf2Crop, hmeCrop, scrape, enabled)
+  values (
+    "RL052",
+    "Chilton",
+    51.5, 359.4,
+    "https://lgdc.uml.edu/common/ShowRandomIonogram?ursiCode=RL052",
+    null,
+    "2006 Jan02 002 150405",
+    "323,30,197,17",
+    "60,50,66,15",
+    "60,67,66,15",
+    "60,99,66,15",
+    "60,130,66,15",
+    "60,147,66,15",
+    "60,162,66,15",
+    "60,314,66,15",
+    "60,346,66,15",
+    1,
+    1
+);
+
+insert into ionosondes (ursiCode, name, latitude, longitude, imageUrl, filter, dateFormat,
+    dateCrop, fof2Crop, fof1Crop, foeCrop, fxiCrop, foesCrop, fminCrop,
+    hmf2Crop, hmeCrop, scrape, enabled)
+  values (
+    "FF051",
+    "Fairford",
+    51.7, 358.2,
+    "https://lgdc.uml.edu/common/ShowRandomIonogram?ursiCode=FF051",
+    null,
+    "2006 Jan02 002 150405",
+    "323,30,197,17",
+    "60,50,66,15",
+    "60,67,66,15",
+    "60,99,66,15",
+    "60,130,66,15",
+    "60,147,66,15",
+    "60,162,66,15",
+    "60,314,66,15",
+    "60,346,66,15",
+    1,
+    0
+);
+`
@@ -0,0 +1,459 @@
+/* Package irdate recognizes the date and time printed on ionograms from
+ * (often slightly wrong) OCR output. The Go time layout of the ionosonde is
+ * split into fields (year, month name, day, day of year, hour, ...) and
+ * literals, and the OCR text is aligned against it allowing for commonly
+ * confused characters (O/0, l/1, ?/7, @/0, ...), spurious and missing
+ * characters, each with a cost. All alignments within the cost limit are
+ * tried in order of cost and the cheapest one that parses (which includes
+ * checking day of year against month and day) and is close enough to the
+ * reference time (e.g when the ionogram was downloaded) is returned.
+ */
+package irdate
+
+import (
+  "fmt"
+  "math"
+  "sort"
+  "strings"
+  "time"
+  "unicode"
+)
+
+const (
+  // DefaultMaxCost is the highest total cost of corrections accepted
+  DefaultMaxCost float64 = 3.0
+  // maxNodes bounds the search for pathological input
+  maxNodes int = 2000000
+  // costStep is the first cost limit searched, doubled until MaxCost
+  costStep float64 = 0.5
+  // wildcard is an unknown digit in a correction
+  wildcard rune = '\uFFFD'
+
+  costCase float64 = 0.1      // a vs A
+  costConfusion float64 = 0.3 // O read as 0 etc
+  costUnknownDigit float64 = 0.8  // ? or similar where a digit is expected
+  costDigit float64 = 1.0     // one digit read as another
+  costSpace float64 = 0.2     // missing or extra space
+  costJunk float64 = 0.5      // leading or trailing junk
+  costDelete float64 = 1.0    // spurious character
+  costInsert float64 = 1.0    // missing character
+)
+
+// digitConfusions maps characters OCR commonly returns instead of a digit
+var digitConfusions = map[rune]rune{
+  'O': '0', 'o': '0', 'Q': '0', 'D': '0', 'U': '0', '@': '0',
+  'l': '1', 'i': '1', 'I': '1', '|': '1', '!': '1', ']': '1', '[': '1', 'j': '1', 'L': '1',
+  'Z': '2', 'z': '2',
+  'S': '5', 's': '5', '$': '5',
+  'G': '6', 'b': '6',
+  '?': '7', 'T': '7',
+  'B': '8', '&': '8',
+  'g': '9', 'q': '9',
+  'A': '4',
+}
+
+// digitDigitConfusions are digits OCR commonly mistakes for other digits
+var digitDigitConfusions = map[[2]rune]bool{
+  { '6', '0' }: true, { '0', '6' }: true, { '8', '0' }: true, { '0', '8' }: true,
+  { '8', '3' }: true, { '3', '8' }: true, { '1', '7' }: true, { '7', '1' }: true,
+  { '5', '6' }: true, { '6', '5' }: true, { '9', '0' }: true,
+}
+
+// letterConfusions maps characters OCR commonly returns instead of a letter
+var letterConfusions = map[rune]rune{
+  '0': 'O', '@': 'O', '1': 'I', 'l': 'I', '|': 'I', '5': 'S', '8': 'B', '2': 'Z', '6': 'G',
+  'H': 'N', 'h': 'N', 'v': 'V', 'u': 'V', 'U': 'V',
+}
+
+var (
+  monthNames = []string{ "January", "February", "March", "April", "May", "June", "July",
+                         "August", "September", "October", "November", "December" }
+  dayNames = []string{ "Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday" }
+)
+
+type slot struct {
+  digit bool
+  char rune   // expected character if not digit
+}
+
+// element is a part of the layout, one of alternatives (each a sequence of
+// slots) is expected in the text.
+type element struct {
+  alternatives [][]slot
+}
+
+func literal(s string) []slot {
+  slots := []slot{}
+  for _, c := range s {
+    slots = append(slots, slot{ char: c })
+  }
+  return slots
+}
+
+func digits(n int) []slot {
+  slots := []slot{}
+  for ; n > 0; n-- {
+    slots = append(slots, slot{ digit: true })
+  }
+  return slots
+}
+
+func names(list []string, short bool) element {
+  e := element{}
+  for _, n := range list {
+    if short {
+      n = n[:3]
+    }
+    e.alternatives = append(e.alternatives, literal(n))
+  }
+  return e
+}
+
+// layoutTokens in the order they are tried at each position of a layout
+var layoutTokens = []struct {
+  token string
+  elem func() element
+}{
+  { "January", func() element { return names(monthNames, false) } },
+  { "Monday", func() element { return names(dayNames, false) } },
+  { "2006", func() element { return element{ [][]slot{ digits(4) } } } },
+  { "002", func() element { return element{ [][]slot{ digits(3) } } } },
+  { "Jan", func() element { return names(monthNames, true) } },
+  { "Mon", func() element { return names(dayNames, true) } },
+  { "MST", nil },
+  { "Z07", nil },
+  { "-07", nil },
+  { ".000", nil },
+  { ".999", nil },
+  { ",000", nil },
+  { "01", func() element { return element{ [][]slot{ digits(2) } } } },
+  { "02", func() element { return element{ [][]slot{ digits(2) } } } },
+  { "03", func() element { return element{ [][]slot{ digits(2) } } } },
+  { "04", func() element { return element{ [][]slot{ digits(2) } } } },
+  { "05", func() element { return element{ [][]slot{ digits(2) } } } },
+  { "06", func() element { return element{ [][]slot{ digits(2) } } } },
+  { "15", func() element { return element{ [][]slot{ digits(2) } } } },
+  // space padding is lost when whitespace is normalized
+  { "__2", func() element { return element{ [][]slot{ digits(1), digits(2), digits(3) } } } },
+  { "_2", func() element { return element{ [][]slot{ digits(1), digits(2) } } } },
+  { "PM", func() element { return element{ [][]slot{ literal("AM"), literal("PM") } } } },
+  { "pm", func() element { return element{ [][]slot{ literal("am"), literal("pm") } } } },
+  { "1", func() element { return element{ [][]slot{ digits(1), digits(2) } } } },
+  { "2", func() element { return element{ [][]slot{ digits(1), digits(2) } } } },
+  { "3", func() element { return element{ [][]slot{ digits(1), digits(2) } } } },
+  { "4", func() element { return element{ [][]slot{ digits(1), digits(2) } } } },
+  { "5", func() element { return element{ [][]slot{ digits(1), digits(2) } } } },
+}
+
+/* Recognizer recognizes dates written with Layout, Recognize may be called
+ * concurrently.
+ */
+type Recognizer struct {
+  Layout string
+  // MaxCost is the highest total cost of corrections accepted
+  MaxCost float64
+  // MaxSkew rejects dates further than this from the reference time, 0
+  // disables the check.
+  MaxSkew time.Duration
+  layout string   // Layout with normalized whitespace
+  elements []element
+}
+
+/* New returns a Recognizer for a Go time layout, e.g "2006 Jan02 002 150405".
+ * Time zones and fractional seconds are not supported.
+ */
+func New(layout string, maxSkew time.Duration) (*Recognizer, error) {
+  r := &Recognizer{ Layout: layout, MaxCost: DefaultMaxCost, MaxSkew: maxSkew }
+  r.layout = string(normalize(layout))
+  rest := r.layout
+  for len(rest) > 0 {
+    found := false
+    for _, t := range layoutTokens {
+      if ! strings.HasPrefix(rest, t.token) {
+        continue
+      }
+      if t.elem == nil {
+        return nil, fmt.Errorf("Layout %s: %s is not supported", layout, t.token)
+      }
+      r.elements = append(r.elements, t.elem())
+      rest = rest[len(t.token):]
+      found = true
+      break
+    }
+    if ! found {
+      c := []rune(rest)[0]
+      r.elements = append(r.elements, element{ [][]slot{ literal(string(c)) } })
+      rest = rest[len(string(c)):]
+    }
+  }
+  if len(r.elements) == 0 {
+    return nil, fmt.Errorf("Layout is empty")
+  }
+  return r, nil
+}
+
+// Result of Recognize()
+type Result struct {
+  Time time.Time
+  Text string     // the corrected text, parses with Layout
+  Cost float64    // total cost of corrections, 0 if the OCR text was right
+}
+
+// normalize collapses whitespace to single spaces
+func normalize(s string) []rune {
+  return []rune(strings.Join(strings.Fields(s), " "))
+}
+
+/* matchCost() returns the characters to output when c is read where s is
+ * expected and the cost, ok is false if c can not be s. A wildcard is a
+ * digit that is unknown.
+ */
+func matchCost(c rune, s slot) (out []rune, cost []float64, ok bool) {
+  if s.digit {
+    if unicode.IsDigit(c) {
+      return []rune{ c }, []float64{ 0 }, true
+    }
+    if d, ok := digitConfusions[c]; ok {
+      if c == '?' {
+        // ? is most often 7 but can be anything
+        return []rune{ d, wildcard }, []float64{ costConfusion, costUnknownDigit }, true
+      }
+      return []rune{ d }, []float64{ costConfusion }, true
+    }
+    if c != ' ' {
+      return []rune{ wildcard }, []float64{ costUnknownDigit + costConfusion }, true
+    }
+    return nil, nil, false
+  }
+  if c == s.char {
+    return []rune{ s.char }, []float64{ 0 }, true
+  }
+  if unicode.ToUpper(c) == unicode.ToUpper(s.char) {
+    return []rune{ s.char }, []float64{ costCase }, true
+  }
+  if l, ok := letterConfusions[c]; ok && l == unicode.ToUpper(s.char) {
+    return []rune{ s.char }, []float64{ costConfusion }, true
+  }
+  return nil, nil, false
+}
+
+type candidate struct {
+  text string
+  cost float64
+}
+
+// edits, to avoid trying a deletion and an insertion where a substitution does
+const (
+  editNone = iota
+  editDelete
+  editInsert
+)
+
+// searchKey is a node of the search, out is the text output so far
+type searchKey struct {
+  n, alt, k, pos, last int
+  out string
+}
+
+type search struct {
+  r *Recognizer
+  text []rune
+  maxCost float64
+  nodes int
+  seen map[searchKey]float64
+  found map[string]float64
+}
+
+/* align() aligns slot k of alternative alt of element n and the rest of the
+ * layout against the text from pos, adding every complete alignment within
+ * maxCost to found.
+ */
+func (s *search) align(n, alt, k, pos int, out []rune, cost float64, last int) {
+  s.nodes++
+  if cost > s.maxCost || s.nodes > maxNodes {
+    return
+  }
+  if n == len(s.r.elements) {
+    // trailing junk
+    cost += float64(len(s.text) - pos) * costJunk
+    if cost > s.maxCost {
+      return
+    }
+    text := string(out)
+    if c, ok := s.found[text]; ! ok || cost < c {
+      s.found[text] = cost
+    }
+    return
+  }
+  slots := s.r.elements[n].alternatives[alt]
+  if k == len(slots) {
+    if n + 1 == len(s.r.elements) {
+      s.align(n + 1, 0, 0, pos, out, cost, editNone)
+      return
+    }
+    for a := range s.r.elements[n + 1].alternatives {
+      s.align(n + 1, a, 0, pos, out, cost, editNone)
+    }
+    return
+  }
+  key := searchKey{ n, alt, k, pos, last, string(out) }
+  if c, ok := s.seen[key]; ok && c <= cost {
+    return
+  }
+  s.seen[key] = cost
+  next := func(r rune) []rune {
+    return append(append([]rune{}, out...), r)
+  }
+  sl := slots[k]
+  if pos < len(s.text) {
+    c := s.text[pos]
+    if chars, costs, ok := matchCost(c, sl); ok {
+      for j, x := range chars {
+        s.align(n, alt, k + 1, pos + 1, next(x), cost + costs[j], editNone)
+      }
+    }
+    if sl.digit && unicode.IsDigit(c) {
+      // a digit read as another digit
+      for x := '0'; x <= '9'; x++ {
+        if digitDigitConfusions[[2]rune{ c, x }] {
+          s.align(n, alt, k + 1, pos + 1, next(x), cost + 2 * costConfusion, editNone)
+        }
+      }
+      s.align(n, alt, k + 1, pos + 1, next(wildcard), cost + costDigit, editNone)
+    }
+    if last != editInsert {
+      // spurious character in the text
+      del := costDelete
+      if c == ' ' {
+        del = costSpace
+      }
+      s.align(n, alt, k, pos + 1, out, cost + del, editDelete)
+    }
+  }
+  if last != editDelete {
+    // missing character in the text
+    if sl.digit {
+      s.align(n, alt, k + 1, pos, next(wildcard), cost + costInsert, editInsert)
+    } else if sl.char == ' ' {
+      s.align(n, alt, k + 1, pos, next(' '), cost + costSpace, editInsert)
+    } else {
+      s.align(n, alt, k + 1, pos, next(sl.char), cost + costInsert, editInsert)
+    }
+  }
+}
+
+/* candidates() returns all corrections of text within maxCost, cheapest
+ * first.
+ */
+func (r *Recognizer) candidates(text string, maxCost float64) []candidate {
+  s := &search{ r: r, text: normalize(text), maxCost: maxCost, seen: map[searchKey]float64{}, found: map[string]float64{} }
+  // leading junk, e.g a frame line next to the date
+  for skip := 0; skip <= len(s.text); skip++ {
+    for a := range r.elements[0].alternatives {
+      s.align(0, a, 0, skip, []rune{}, float64(skip) * costJunk, editNone)
+    }
+  }
+  list := []candidate{}
+  for t, c := range s.found {
+    list = append(list, candidate{ t, c })
+  }
+  sort.Slice(list, func(a, b int) bool {
+    if list[a].cost != list[b].cost {
+      return list[a].cost < list[b].cost
+    }
+    return list[a].text < list[b].text
+  })
+  return list
+}
+
+/* resolve() returns the times text can be when each wildcard is replaced by
+ * a digit, only those within MaxSkew of reference unless it is zero.
+ */
+func (r *Recognizer) resolve(text string, reference time.Time) []time.Time {
+  i := strings.IndexRune(text, wildcard)
+  if i < 0 {
+    t, err := time.Parse(r.layout, text)
+    if err != nil {
+      // e.g day of year not matching month and day
+      return nil
+    }
+    if ! reference.IsZero() && r.MaxSkew > 0 && skew(t, reference) > r.MaxSkew {
+      return nil
+    }
+    return []time.Time{ t }
+  }
+  var times []time.Time
+  for d := '0'; d <= '9'; d++ {
+    times = append(times, r.resolve(text[:i] + string(d) + text[i + len(string(wildcard)):], reference)...)
+  }
+  return times
+}
+
+func skew(t, reference time.Time) time.Duration {
+  d := t.Sub(reference)
+  if d < 0 {
+    d = -d
+  }
+  if d < 0 {
+    // -minDuration overflows
+    d = math.MaxInt64
+  }
+  return d
+}
+
+/* Recognize returns the date in text. reference is when the ionogram was
+ * made available (e.g downloaded), dates further than MaxSkew from it are
+ * rejected and among equally cheap corrections the one closest to reference
+ * wins. A zero reference disables both. Corrections with unknown digits are
+ * only accepted if exactly one digit gives a valid date, e.g when the day
+ * of year decides the day of month.
+ */
+func (r *Recognizer) Recognize(text string, reference time.Time) (Result, error) {
+  // text that is already right needs no search
+  if t, err := time.ParseInLocation(r.layout, string(normalize(text)), time.UTC); err == nil {
+    if reference.IsZero() || r.MaxSkew <= 0 || skew(t, reference) <= r.MaxSkew {
+      return Result{ Time: t, Text: t.Format(r.layout) }, nil
+    }
+  }
+  /* Most text needs few corrections, a search within a lower cost limit
+   * is much smaller and finds all corrections up to the limit, so if one of
+   * them is accepted it is also the cheapest within MaxCost.
+   */
+  for limit := costStep; ; limit *= 2 {
+    if limit > r.MaxCost {
+      limit = r.MaxCost
+    }
+    if best := r.cheapest(text, reference, limit); best != nil {
+      return *best, nil
+    }
+    if limit == r.MaxCost {
+      break
+    }
+  }
+  if ! reference.IsZero() && r.MaxSkew > 0 {
+    return Result{}, fmt.Errorf("Unable to recognize '%s' as %s within %s of %s", text, r.Layout,
+                                r.MaxSkew, reference.UTC().Format(time.RFC3339))
+  }
+  return Result{}, fmt.Errorf("Unable to recognize '%s' as %s", text, r.Layout)
+}
+
+/* cheapest() returns the cheapest accepted correction of text within
+ * maxCost, nil if there is none.
+ */
+func (r *Recognizer) cheapest(text string, reference time.Time, maxCost float64) (*Result) {
+  var best *Result
+  for _, c := range r.candidates(text, maxCost) {
+    if best != nil && c.cost > best.Cost {
+      break
+    }
+    times := r.resolve(c.text, reference)
+    if len(times) != 1 {
+      continue
+    }
+    t := times[0]
+    if best == nil || (! reference.IsZero() && skew(t, reference) < skew(best.Time, reference)) {
+      best = &Result{ Time: t, Text: t.Format(r.layout), Cost: c.cost }
+    }
+  }
+  return best
+}
@@ -0,0 +1,160 @@
+package irdate
+
+import (
+  "testing"
+  "time"
+)
+
+const testLayout string = "2006 Jan02 002 150405"
+
+/* The cases are built from the replacement list of fixDate() that irdate
+ * replaced, every OCR text has one of its misreads (the replacement is in
+ * the comment) and must be recognized as the date it was fixed to.
+ */
+var fixDateCases = []struct {
+  ocr string
+  want string   // as testLayout
+}{
+  { "2020 oOct05 279 101500", "2020 Oct05 279 101500" },     // oOct -> Oct
+  { "2020 Hov27 332 101500", "2020 Nov27 332 101500" },      // Hov -> Nov
+  { "2021 Jan10 610 101500", "2021 Jan10 010 101500" },      // " 610 " -> " 010 "
+  { "2021 Jan25 625 101500", "2021 Jan25 025 101500" },      // " 625 " -> " 025 "
+  { "2021 Feb19 650 101500", "2021 Feb19 050 101500" },      // " 650 " -> " 050 "
+  { "2021 Jan20 0620 101500", "2021 Jan20 020 101500" },     // " 0620 " -> " 020 "
+  { "2021 Jan13 6013 101500", "2021 Jan13 013 101500" },     // " 6013 " -> " 013 "
+  { "2021 Feb09 6040 101500", "2021 Feb09 040 101500" },     // " 6040 " -> " 040 "
+  { "2020 DecO01 336 101500", "2020 Dec01 336 101500" },     // "DecO01 " -> "Dec01 "
+  { "2020 DecO@1 336 101500", "2020 Dec01 336 101500" },     // "DecO@1 " -> "Dec01 "
+  { "2020 DecO1l 336 101500", "2020 Dec01 336 101500" },     // "DecO1l " -> "Dec01 "
+  { "2020 DecOl 336 101500", "2020 Dec01 336 101500" },      // "DecOl " -> "Dec01 "
+  { "2020 DecO?2 337 101500", "2020 Dec02 337 101500" },     // "DecO?2 " -> "Dec02 "
+  { "2020 DecO@2 337 101500", "2020 Dec02 337 101500" },     // "DecO@2 " -> "Dec02 "
+  { "2020 DecO? 342 101500", "2020 Dec07 342 101500" },      // "DecO? " -> "Dec07 "
+  { "2020 Dec1? 347 101500", "2020 Dec12 347 101500" },      // "Dec1? " -> "Dec12 "
+  { "2020 Decl? 353 101500", "2020 Dec18 353 101500" },      // "Decl? " -> "Dec18 "
+  { "2020 Decl15 350 101500", "2020 Dec15 350 101500" },     // "Decl15 " -> "Dec15 "
+  { "2020 DeclO 345 101500", "2020 Dec10 345 101500" },      // "DeclO " -> "Dec10 "
+  { "2020 Decll 346 101500", "2020 Dec11 346 101500" },      // "Decll " -> "Dec11 "
+  { "2020 Dec@5 340 101500", "2020 Dec05 340 101500" },      // "Dec@" -> "Dec0"
+  { "2021 Jan?21 021 101500", "2021 Jan21 021 101500" },     // "Jan?21 " -> "Jan21 "
+  { "2021 JanlO 010 101500", "2021 Jan10 010 101500" },      // "JanlO " -> "Jan10 "
+  { "2021 JanlO0 010 101500", "2021 Jan10 010 101500" },     // "JanlO0 " -> "Jan10 "
+  { "2021 Jan1O0 010 101500", "2021 Jan10 010 101500" },     // "Jan1O0 " -> "Jan10 "
+  { "2021 Jani0 010 101500", "2021 Jan10 010 101500" },      // "Jani0 " -> "Jan10 "
+  { "2021 Jan110 010 101500", "2021 Jan10 010 101500" },     // "Jan110 " -> "Jan10 "
+  { "2021 Jani10 010 101500", "2021 Jan10 010 101500" },     // "Jani10 " -> "Jan10 "
+  { "2021 Jan1l 011 101500", "2021 Jan11 011 101500" },      // "Jan1l " -> "Jan11 "
+  { "2021 Janii1 011 101500", "2021 Jan11 011 101500" },     // "Janii1 " -> "Jan11 "
+  { "2021 Janil 011 101500", "2021 Jan11 011 101500" },      // "Janil " -> "Jan11 "
+  { "2021 Jani? 017 101500", "2021 Jan17 017 101500" },      // "Jani? 017 " -> "Jan17 017 "
+  { "2021 Jani? 012 101500", "2021 Jan12 012 101500" },      // "Jani? " -> "Jan12 "
+  { "2021 Janl? 012 101500", "2021 Jan12 012 101500" },      // "Janl? " -> "Jan12 "
+  { "2021 Jani15 015 101500", "2021 Jan15 015 101500" },     // "Jani15 " -> "Jan15 "
+  { "2021 Janl18 018 101500", "2021 Jan18 018 101500" },     // "Janl18 " -> "Jan18 "
+  { "2021 Jani3 013 101500", "2021 Jan13 013 101500" },      // "Jani3 " -> "Jan13 "
+  { "2021 Janil7 017 101500", "2021 Jan17 017 101500" },     // "Janil7 " -> "Jan17 "
+  { "2021 Jan1l5 015 101500", "2021 Jan15 015 101500" },     // "Jan1l5 " -> "Jan15 "
+  { "2021 Jan0O4 004 101500", "2021 Jan04 004 101500" },     // "Jan0O" -> "Jan0"
+  { "2021 JanO3 003 101500", "2021 Jan03 003 101500" },      // "JanO" -> "Jan0"
+  { "2021 Mar006 065 101500", "2021 Mar06 065 101500" },     // "Mar00" -> "Mar0"
+  { "2021 Jan10 010 1O1500", "2021 Jan10 010 101500" },      // "1O " -> "10 "
+  { "2021 Jan10 010 O01500", "2021 Jan10 010 001500" },      // " O0" -> " 00"
+  { "2020 Novl19 324 101500", "2020 Nov19 324 101500" },     // "Novl19 " -> "Nov19 "
+  { "2020 Nov1?7 322 101500", "2020 Nov17 322 101500" },     // "Nov1?7 " -> "Nov17 "
+  { "2020 Nov1? 322 101500", "2020 Nov17 322 101500" },      // "Nov1? " -> "Nov17 "
+  { "2020 Nov1l5 320 101500", "2020 Nov15 320 101500" },     // "Nov1l5" -> "Nov15"
+  { "2020 Nov1?2 317 101500", "2020 Nov12 317 101500" },     // "Nov1?2" -> "Nov12"
+  { "2020 Nov113 318 101500", "2020 Nov13 318 101500" },     // "Nov113 " -> "Nov13 "
+  { "2020 NovO01l 306 101500", "2020 Nov01 306 101500" },    // "NovO01l " -> "Nov01 "
+  { "2020 NovO0l1 306 101500", "2020 Nov01 306 101500" },    // "NovO0l1 " -> "Nov01 "
+  { "2020 Nov@l 306 101500", "2020 Nov01 306 101500" },      // "Nov@l " -> "Nov01 "
+  { "2020 NovOl 306 101500", "2020 Nov01 306 101500" },      // "NovOl " -> "Nov01 "
+  { "2021 Febl17 048 101500", "2021 Feb17 048 101500" },     // "Febl" -> "Feb1"
+  { "2021 Octl4 287 101500", "2021 Oct14 287 101500" },      // "Octl" -> "Oct1"
+  { "2021 MarO5 064 101500", "2021 Mar05 064 101500" },      // "O5 " -> "05 "
+  { "2021 Aug09 22? 101500", "2021 Aug09 221 101500" },      // ? where the day of year decides
+}
+
+func TestRecognizeFixDateCases(t *testing.T) {
+  r, err := New(testLayout, time.Hour)
+  if err != nil {
+    t.Fatal(err)
+  }
+  for _, c := range fixDateCases {
+    want, err := time.Parse(testLayout, c.want)
+    if err != nil {
+      t.Fatalf("%s: %v", c.want, err)
+    }
+    res, err := r.Recognize(c.ocr, want.Add(5 * time.Minute))
+    if err != nil {
+      t.Errorf("Recognize(%q): %v", c.ocr, err)
+      continue
+    }
+    if ! res.Time.Equal(want) || res.Text != c.want {
+      t.Errorf("Recognize(%q) = %q, want %q", c.ocr, res.Text, c.want)
+    }
+  }
+}
+
+func TestRecognizeExact(t *testing.T) {
+  r, err := New(testLayout, time.Hour)
+  if err != nil {
+    t.Fatal(err)
+  }
+  res, err := r.Recognize("2020 Nov27 332 101500", time.Time{})
+  if err != nil {
+    t.Fatal(err)
+  }
+  if res.Cost != 0 || res.Text != "2020 Nov27 332 101500" {
+    t.Errorf("Recognize of a correct date = %q cost %g, want cost 0", res.Text, res.Cost)
+  }
+}
+
+func TestRecognizeRejects(t *testing.T) {
+  r, err := New(testLayout, time.Hour)
+  if err != nil {
+    t.Fatal(err)
+  }
+  reference := time.Date(2021, time.January, 10, 10, 20, 0, 0, time.UTC)
+  cases := []struct {
+    name string
+    ocr string
+    reference time.Time
+    maxCost float64
+  }{
+    // day of year 020 is Jan20, without corrections Jan10 can not be day 20
+    { "day of year contradicts month and day", "2021 Jan10 020 101500", time.Time{}, 0 },
+    { "day of year contradicts month and day near reference", "2021 Jan10 020 101500", reference, 0 },
+    // right date two days before the reference
+    { "outside MaxSkew", "2021 Jan08 008 101500", reference, DefaultMaxCost },
+    { "outside MaxSkew after correction", "2021 JanZ8 028 101500", reference, DefaultMaxCost },
+    { "not a date", "foF2 5.35", reference, DefaultMaxCost },
+    { "empty", "", time.Time{}, DefaultMaxCost },
+  }
+  for _, c := range cases {
+    r.MaxCost = c.maxCost
+    if res, err := r.Recognize(c.ocr, c.reference); err == nil {
+      t.Errorf("%s: Recognize(%q) = %q, want an error", c.name, c.ocr, res.Text)
+    }
+  }
+}
+
+func TestRecognizeWithoutReference(t *testing.T) {
+  r, err := New(testLayout, time.Hour)
+  if err != nil {
+    t.Fatal(err)
+  }
+  // a zero reference disables MaxSkew
+  if _, err := r.Recognize("2021 Jan08 008 101500", time.Time{}); err != nil {
+    t.Errorf("Recognize without reference: %v", err)
+  }
+}
+
+func TestNew(t *testing.T) {
+  if _, err := New("", 0); err == nil {
+    t.Errorf("New with an empty layout did not fail")
+  }
+  if _, err := New("2006-01-02 15:04:05 MST", 0); err == nil {
+    t.Errorf("New with a time zone did not fail")
+  }
+}
@@ -0,0 +1,167 @@
+/* Package irdidbase queries scaled characteristics of an ionosonde over a
+ * time range from GIRO's DIDBase (the DIDBGetValues service at
+ * lgdc.uml.edu) and parses the plain text table it responds with:
+ *
+ *   # Location: GEO 54.6N 13.4E, URSI-Code JR055 JULIUSRUH
+ *   #Time                     CS   foF2 QD   foE QD
+ *   2021-02-01T00:00:00.000Z  70  3.450 //   ---
+ *
+ * Comment lines start with #, the #Time line names the columns. Every
+ * characteristic is followed by its qualifying/descriptive letters (QD),
+ * missing values are written as ---. CS is the autoscaling confidence score.
+ */
+package irdidbase
+
+import (
+  "bufio"
+  "fmt"
+  "io"
+  "net/url"
+  "regexp"
+  "strconv"
+  "strings"
+  "time"
+
+  "github.com/sa6mwa/ionoreporter/irsao"
+)
+
+// DefaultUrl is the DIDBGetValues service of DIDBase
+const DefaultUrl string = `https://lgdc.uml.edu/common/DIDBGetValues`
+
+// dateFormat is the format of fromDate and toDate in queries
+const dateFormat string = `2006.01.02 15:04:05`
+
+/* Characteristics are the DIDBase names of the characteristics queried, the
+ * same names as irsao uses.
+ */
+var Characteristics = []string{
+  irsao.FoF2, irsao.FoF1, irsao.FoE, irsao.FxI, irsao.FoEs, irsao.Fmin, irsao.HmF2, irsao.HmE, irsao.HF,
+}
+
+var ursiCodeRe = regexp.MustCompile(`URSI-Code\s+([A-Za-z0-9]+)`)
+
+/* QueryUrl returns the URL of the characteristics of ursiCode from from to
+ * to at the DIDBGetValues service at base (DefaultUrl if empty).
+ */
+func QueryUrl(base, ursiCode string, from, to time.Time) (string) {
+  if base == "" {
+    base = DefaultUrl
+  }
+  q := url.Values{}
+  q.Set("ursiCode", ursiCode)
+  q.Set("charName", strings.Join(Characteristics, ","))
+  q.Set("DMUF", "3000")
+  q.Set("fromDate", from.UTC().Format(dateFormat))
+  q.Set("toDate", to.UTC().Format(dateFormat))
+  sep := "?"
+  if strings.Contains(base, "?") {
+    sep = "&"
+  }
+  return base + sep + q.Encode()
+}
+
+/* Parse parses a DIDBGetValues response into one record per line, in the
+ * order of the response. Station is taken from the URSI-Code comment, if
+ * any. An error is returned if there is no #Time header, as DIDBase
+ * answers errors in plain text too.
+ */
+func Parse(r io.Reader) ([]irsao.Record, error) {
+  var records []irsao.Record
+  var columns []string
+  station := ""
+  scanner := bufio.NewScanner(r)
+  line := 0
+  for scanner.Scan() {
+    line++
+    text := strings.TrimSpace(scanner.Text())
+    if text == "" {
+      continue
+    }
+    if strings.HasPrefix(text, "#") {
+      if m := ursiCodeRe.FindStringSubmatch(text); m != nil {
+        station = strings.ToUpper(m[1])
+      }
+      fields := strings.Fields(strings.TrimPrefix(text, "#"))
+      if len(fields) > 0 && fields[0] == "Time" {
+        columns = characteristicColumns(fields[1:])
+      }
+      continue
+    }
+    if columns == nil {
+      return nil, fmt.Errorf("Not a DIDBase response, line %d before the #Time header: %s", line, text)
+    }
+    rec, err := parseLine(text, columns)
+    if err != nil {
+      return nil, fmt.Errorf("Line %d: %v", line, err)
+    }
+    rec.Station = station
+    records = append(records, rec)
+  }
+  if err := scanner.Err(); err != nil {
+    return nil, err
+  }
+  if columns == nil {
+    return nil, fmt.Errorf("Not a DIDBase response, no #Time header")
+  }
+  return records, nil
+}
+
+/* characteristicColumns returns the names of the characteristics in the
+ * header after #Time, i.e without CS and the QD columns.
+ */
+func characteristicColumns(header []string) ([]string) {
+  columns := []string{}
+  for _, h := range header {
+    if h != "CS" && h != "QD" {
+      columns = append(columns, h)
+    }
+  }
+  return columns
+}
+
+/* parseLine parses one data line. The QD after a value may be blank, so it
+ * is only consumed if it is not a value (QD are letters or //).
+ */
+func parseLine(text string, columns []string) (irsao.Record, error) {
+  fields := strings.Fields(text)
+  rec := irsao.Record{ Values: map[string]float64{} }
+  if len(fields) < 2 {
+    return rec, fmt.Errorf("Too few columns: %s", text)
+  }
+  dt, err := time.Parse(time.RFC3339, fields[0])
+  if err != nil {
+    return rec, fmt.Errorf("Invalid time %s: %v", fields[0], err)
+  }
+  rec.Time = dt.UTC()
+  isValue := func(f string) bool {
+    if f == "---" {
+      return true
+    }
+    _, err := strconv.ParseFloat(f, 64)
+    return err == nil
+  }
+  n := 2  // after time and CS
+  for _, name := range columns {
+    if n >= len(fields) {
+      break
+    }
+    f := fields[n]
+    n++
+    if ! isValue(f) {
+      return rec, fmt.Errorf("%s is not a value: %s", name, f)
+    }
+    if n < len(fields) && ! isValue(fields[n]) {
+      n++
+    }
+    if f == "---" {
+      continue
+    }
+    v, _ := strconv.ParseFloat(f, 64)
+    for _, c := range Characteristics {
+      if strings.EqualFold(c, name) {
+        rec.Values[c] = v
+      }
+    }
+  }
+  return rec, nil
+}
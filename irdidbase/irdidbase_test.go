@@ -0,0 +1,88 @@
+package irdidbase
+
+import (
+  "net/url"
+  "os"
+  "strings"
+  "testing"
+  "time"
+
+  "github.com/sa6mwa/ionoreporter/irsao"
+)
+
+func TestParseFixture(t *testing.T) {
+  f, err := os.Open("testdata/JR055.txt")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer f.Close()
+  records, err := Parse(f)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(records) != 4 {
+    t.Fatalf("Parse returned %d records, want 4", len(records))
+  }
+  start := time.Date(2021, time.February, 1, 10, 0, 0, 0, time.UTC)
+  for n, rec := range records {
+    if want := start.Add(time.Duration(n) * 15 * time.Minute); ! rec.Time.Equal(want) {
+      t.Errorf("record %d time %s, want %s", n, rec.Time, want)
+    }
+    if rec.Station != "JR055" {
+      t.Errorf("record %d station %q, want JR055", n, rec.Station)
+    }
+    // foF1 is --- in every row
+    if _, ok := rec.Values[irsao.FoF1]; ok {
+      t.Errorf("record %d has foF1 %g, want missing", n, rec.Values[irsao.FoF1])
+    }
+  }
+  want := []map[string]float64{
+    { irsao.FoF2: 5.85, irsao.FoE: 2.65, irsao.FxI: 6.7, irsao.Fmin: 1.55, irsao.HmF2: 262.4, irsao.HmE: 110 },
+    { irsao.FoF2: 5.925, irsao.FoE: 2.7, irsao.FxI: 6.8, irsao.FoEs: 3.1, irsao.Fmin: 1.5, irsao.HmF2: 258.9, irsao.HmE: 110 },
+    // blank QD after foF1 and foEs
+    { irsao.FoF2: 6.05, irsao.FoE: 2.7, irsao.FxI: 6.9, irsao.Fmin: 1.6, irsao.HmF2: 255, irsao.HmE: 110 },
+    { irsao.FoF2: 6.1, irsao.FoE: 2.75, irsao.FxI: 6.95, irsao.Fmin: 1.6, irsao.HmF2: 251.7, irsao.HmE: 110 },
+  }
+  for n, values := range want {
+    if len(records[n].Values) != len(values) {
+      t.Errorf("record %d has %d values %v, want %v", n, len(records[n].Values), records[n].Values, values)
+    }
+    for name, v := range values {
+      if got, ok := records[n].Values[name]; ! ok || got != v {
+        t.Errorf("record %d %s = %g (%t), want %g", n, name, got, ok, v)
+      }
+    }
+  }
+}
+
+func TestParseErrors(t *testing.T) {
+  for _, text := range []string{
+    "",
+    "Error: unknown URSI code XX000\n",
+    "#Time CS foF2 QD\n2021-02-01 90 5.850 //\n",
+    "#Time CS foF2 QD\n2021-02-01T10:00:00.000Z 90 five //\n",
+  } {
+    if _, err := Parse(strings.NewReader(text)); err == nil {
+      t.Errorf("Parse(%q) did not fail", text)
+    }
+  }
+}
+
+func TestQueryUrl(t *testing.T) {
+  from := time.Date(2021, time.February, 1, 10, 0, 0, 0, time.UTC)
+  u, err := url.Parse(QueryUrl("", "JR055", from, from.Add(time.Hour)))
+  if err != nil {
+    t.Fatal(err)
+  }
+  if ! strings.HasPrefix(u.String(), DefaultUrl + "?") {
+    t.Errorf("QueryUrl %s does not use %s", u, DefaultUrl)
+  }
+  q := u.Query()
+  if q.Get("ursiCode") != "JR055" || q.Get("fromDate") != "2021.02.01 10:00:00" ||
+      q.Get("toDate") != "2021.02.01 11:00:00" || q.Get("charName") != strings.Join(Characteristics, ",") {
+    t.Errorf("QueryUrl query %v", q)
+  }
+  if u := QueryUrl("http://127.0.0.1/didbase?x=1", "JR055", from, from); ! strings.Contains(u, "?x=1&") {
+    t.Errorf("QueryUrl %s does not keep the query of the base", u)
+  }
+}
@@ -0,0 +1,164 @@
+package irfilter
+
+import (
+  "image"
+  "image/color"
+  "image/draw"
+
+  "github.com/disintegration/gift"
+)
+
+/* Steps meant for the small crops read by OCR: binarization (otsu and
+ * adaptive) and a white border (pad). tesseract reads black text on white
+ * best, so invert before binarizing light on dark text. These are gift
+ * filters like the others, they work on the luminance of the source.
+ */
+
+// adaptiveOffset is how much darker than the mean of its window ink must be
+const adaptiveOffset int = 7
+
+// Resamplings are the resampling filters of upscale by name
+var Resamplings = map[string]gift.Resampling{
+  "nearest": gift.NearestNeighborResampling,
+  "box": gift.BoxResampling,
+  "linear": gift.LinearResampling,
+  "cubic": gift.CubicResampling,
+  "lanczos": gift.LanczosResampling,
+}
+
+// luminance returns the gray value of every pixel of src, row by row
+func luminance(src image.Image) ([]uint8) {
+  b := src.Bounds()
+  lum := make([]uint8, b.Dx() * b.Dy())
+  for y := 0; y < b.Dy(); y++ {
+    for x := 0; x < b.Dx(); x++ {
+      lum[y * b.Dx() + x] = color.GrayModel.Convert(src.At(b.Min.X + x, b.Min.Y + y)).(color.Gray).Y
+    }
+  }
+  return lum
+}
+
+// drawBinary draws ink black and the rest white into dst
+func drawBinary(dst draw.Image, ink []bool, width int) {
+  min := dst.Bounds().Min
+  for n, black := range ink {
+    c := color.Gray{ 255 }
+    if black {
+      c = color.Gray{ 0 }
+    }
+    dst.Set(min.X + n % width, min.Y + n / width, c)
+  }
+}
+
+/* otsuThreshold returns the threshold maximizing the between class variance
+ * of lum, pixels <= threshold are ink.
+ */
+func otsuThreshold(lum []uint8) (uint8) {
+  var hist [256]int
+  var sum float64
+  for _, l := range lum {
+    hist[l]++
+    sum += float64(l)
+  }
+  var sumB, best float64
+  wB := 0
+  threshold := uint8(127)
+  for i, n := range hist {
+    wB += n
+    if wB == 0 {
+      continue
+    }
+    wF := len(lum) - wB
+    if wF == 0 {
+      break
+    }
+    sumB += float64(i * n)
+    mB := sumB / float64(wB)
+    mF := (sum - sumB) / float64(wF)
+    between := float64(wB) * float64(wF) * (mB - mF) * (mB - mF)
+    if between > best {
+      best = between
+      threshold = uint8(i)
+    }
+  }
+  return threshold
+}
+
+// otsuFilter binarizes with Otsu's threshold of the whole image
+type otsuFilter struct{}
+
+func (otsuFilter) Bounds(srcBounds image.Rectangle) (image.Rectangle) {
+  return image.Rect(0, 0, srcBounds.Dx(), srcBounds.Dy())
+}
+
+func (otsuFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+  lum := luminance(src)
+  t := otsuThreshold(lum)
+  ink := make([]bool, len(lum))
+  for n, l := range lum {
+    ink[n] = l <= t
+  }
+  drawBinary(dst, ink, src.Bounds().Dx())
+}
+
+/* adaptiveFilter binarizes against the mean of a window of size by size
+ * pixels around every pixel, which copes with uneven backgrounds (e.g grid
+ * lines or a gradient behind the text).
+ */
+type adaptiveFilter struct {
+  size int
+}
+
+func (adaptiveFilter) Bounds(srcBounds image.Rectangle) (image.Rectangle) {
+  return image.Rect(0, 0, srcBounds.Dx(), srcBounds.Dy())
+}
+
+func (f adaptiveFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+  lum := luminance(src)
+  w, h := src.Bounds().Dx(), src.Bounds().Dy()
+  // integral image, one row and column larger
+  sums := make([]int, (w + 1) * (h + 1))
+  for y := 0; y < h; y++ {
+    row := 0
+    for x := 0; x < w; x++ {
+      row += int(lum[y * w + x])
+      sums[(y + 1) * (w + 1) + x + 1] = sums[y * (w + 1) + x + 1] + row
+    }
+  }
+  clamp := func(v, max int) int {
+    if v < 0 {
+      return 0
+    } else if v > max {
+      return max
+    }
+    return v
+  }
+  r := f.size / 2
+  ink := make([]bool, len(lum))
+  for y := 0; y < h; y++ {
+    y0, y1 := clamp(y - r, h), clamp(y + r + 1, h)
+    for x := 0; x < w; x++ {
+      x0, x1 := clamp(x - r, w), clamp(x + r + 1, w)
+      sum := sums[y1 * (w + 1) + x1] - sums[y0 * (w + 1) + x1] - sums[y1 * (w + 1) + x0] + sums[y0 * (w + 1) + x0]
+      mean := sum / ((x1 - x0) * (y1 - y0))
+      ink[y * w + x] = int(lum[y * w + x]) < mean - adaptiveOffset
+    }
+  }
+  drawBinary(dst, ink, w)
+}
+
+// padFilter adds a white border of width pixels
+type padFilter struct {
+  width int
+}
+
+func (f padFilter) Bounds(srcBounds image.Rectangle) (image.Rectangle) {
+  return image.Rect(0, 0, srcBounds.Dx() + 2 * f.width, srcBounds.Dy() + 2 * f.width)
+}
+
+func (f padFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+  b := dst.Bounds()
+  draw.Draw(dst, b, image.White, image.Point{}, draw.Src)
+  inner := image.Rect(f.width, f.width, f.width + src.Bounds().Dx(), f.width + src.Bounds().Dy()).Add(b.Min)
+  draw.Draw(dst, inner, src, src.Bounds().Min, draw.Src)
+}
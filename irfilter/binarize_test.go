@@ -0,0 +1,154 @@
+package irfilter
+
+import (
+  "image"
+  "image/color"
+  "testing"
+)
+
+func gray(img image.Image, x, y int) (uint8) {
+  return color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y
+}
+
+func TestOtsuThreshold(t *testing.T) {
+  // dark text on a light background, more background than ink
+  lum := make([]uint8, 0, 100)
+  for n := 0; n < 30; n++ {
+    lum = append(lum, 40, 45)
+  }
+  for n := 0; n < 20; n++ {
+    lum = append(lum, 200, 210)
+  }
+  if th := otsuThreshold(lum); th < 45 || th >= 200 {
+    t.Errorf("otsuThreshold of 40/45 and 200/210 = %d, want between the modes", th)
+  }
+  // a single value has nothing to separate, nothing is ink below it
+  if th := otsuThreshold([]uint8{ 128, 128, 128 }); th >= 128 {
+    t.Errorf("otsuThreshold of a flat histogram = %d, want below 128", th)
+  }
+}
+
+func TestOtsu(t *testing.T) {
+  // a dark square on a light background
+  src := image.NewGray(image.Rect(0, 0, 10, 10))
+  for y := 0; y < 10; y++ {
+    for x := 0; x < 10; x++ {
+      src.SetGray(x, y, color.Gray{ 190 })
+      if x >= 3 && x < 7 && y >= 3 && y < 7 {
+        src.SetGray(x, y, color.Gray{ 60 })
+      }
+    }
+  }
+  p, err := Parse("otsu")
+  if err != nil {
+    t.Fatal(err)
+  }
+  dst := p.Apply(src)
+  if gray(dst, 5, 5) != 0 || gray(dst, 0, 0) != 255 {
+    t.Errorf("otsu ink %d and background %d, want 0 and 255", gray(dst, 5, 5), gray(dst, 0, 0))
+  }
+}
+
+func TestAdaptive(t *testing.T) {
+  // dark dots on a horizontal gradient, the darkest background is darker
+  // than the lightest dot so no global threshold separates them
+  src := image.NewGray(image.Rect(0, 0, 60, 9))
+  for y := 0; y < 9; y++ {
+    for x := 0; x < 60; x++ {
+      src.SetGray(x, y, color.Gray{ uint8(240 - 3 * x) })
+    }
+  }
+  for _, x := range []int{ 5, 30, 55 } {
+    src.SetGray(x, 4, color.Gray{ uint8(240 - 3 * x - 60) })
+  }
+  p, err := Parse("adaptive:9")
+  if err != nil {
+    t.Fatal(err)
+  }
+  dst := p.Apply(src)
+  for _, x := range []int{ 5, 30, 55 } {
+    if gray(dst, x, 4) != 0 {
+      t.Errorf("dot at %d is %d, want ink", x, gray(dst, x, 4))
+    }
+    if gray(dst, x + 2, 4) != 255 {
+      t.Errorf("background at %d is %d, want white", x + 2, gray(dst, x + 2, 4))
+    }
+  }
+}
+
+func TestPad(t *testing.T) {
+  src := image.NewGray(image.Rect(0, 0, 10, 4))
+  p, err := Parse("pad:5")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if ! p.Resizes() {
+    t.Errorf("pad does not resize")
+  }
+  dst := p.Apply(src)
+  if b := dst.Bounds(); b != image.Rect(0, 0, 20, 14) {
+    t.Errorf("pad:5 of 10x4 is %v, want 20x14", b)
+  }
+  // white border around the black source
+  for _, pt := range []image.Point{ { 0, 0 }, { 4, 4 }, { 15, 9 }, { 19, 13 } } {
+    if gray(dst, pt.X, pt.Y) != 255 {
+      t.Errorf("border at %v is %d, want white", pt, gray(dst, pt.X, pt.Y))
+    }
+  }
+  for _, pt := range []image.Point{ { 5, 5 }, { 14, 8 } } {
+    if gray(dst, pt.X, pt.Y) != 0 {
+      t.Errorf("source at %v is %d, want black", pt, gray(dst, pt.X, pt.Y))
+    }
+  }
+}
+
+func TestUpscale(t *testing.T) {
+  src := image.NewGray(image.Rect(0, 0, 10, 4))
+  for _, spec := range []string{ "upscale:3", "upscale:3:nearest", "upscale:3:Cubic" } {
+    p, err := Parse(spec)
+    if err != nil {
+      t.Errorf("Parse(%q): %v", spec, err)
+      continue
+    }
+    if b := p.Apply(src).Bounds(); b.Dx() != 30 || b.Dy() != 12 {
+      t.Errorf("%s of 10x4 is %v, want 30x12", spec, b)
+    }
+  }
+}
+
+func TestParseBinarizeSteps(t *testing.T) {
+  for spec, want := range map[string]string{
+    "upscale:2": "upscale:2:lanczos",
+    "upscale:4:CUBIC|otsu|pad:10": "upscale:4:cubic|otsu|pad:10",
+    "adaptive": "adaptive:15",
+    "adaptive:21": "adaptive:21",
+    "grayscale|sharpen|upscale:4:nearest|adaptive|pad:1": "grayscale|sharpen:1|upscale:4:nearest|adaptive:15|pad:1",
+  } {
+    p, err := Parse(spec)
+    if err != nil {
+      t.Errorf("Parse(%q): %v", spec, err)
+      continue
+    }
+    if p.String() != want {
+      t.Errorf("Parse(%q).String() = %q, want %q", spec, p.String(), want)
+    }
+  }
+  for _, spec := range []string{
+    "adaptive:14",        // even window
+    "adaptive:1",         // out of range
+    "adaptive:53",
+    "upscale",            // requires a factor
+    "upscale:1",
+    "upscale:9",
+    "upscale:2.5",        // not an integer
+    "upscale:3:bogus",    // unknown resampling
+    "upscale:3:cubic:1",
+    "otsu:128",           // takes no argument
+    "pad:0",
+    "pad",
+  } {
+    if p, err := Parse(spec); err == nil {
+      t.Errorf("Parse(%q) = %q, want an error", spec, p.String())
+    }
+  }
+}
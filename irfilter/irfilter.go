@@ -0,0 +1,307 @@
+/* Package irfilter parses image filter pipelines for ionograms and crops,
+ * e.g
+ *
+ *   invert|grayscale|brightness:-40|contrast:80|threshold:128|scale:3|sharpen
+ *
+ * into a gift (github.com/disintegration/gift) filter chain. Steps are
+ * separated by | and applied left to right, arguments follow a colon:
+ *
+ * invert             invert the colors
+ * grayscale          remove the colors
+ * brightness:P       change the brightness by P percent (-100 to 100)
+ * contrast:P         change the contrast by P percent (-100 to 100)
+ * gamma:G            gamma correction, below 1 darkens (0.1 to 10)
+ * threshold:T        black below T, white from T (1 to 254)
+ * blur:S             gaussian blur with sigma S (0.1 to 10)
+ * median:K           median of K by K pixels, odd K (3 to 9)
+ * sharpen[:A]        unsharp mask with amount A (default 1, 0.1 to 5)
+ * scale:F            resize by factor F (0.1 to 10), changes the size
+ * upscale:N[:R]      resize by the integer factor N (2 to 8) with the
+ *                    resampling R, nearest, box, linear, cubic or lanczos
+ *                    (default), changes the size
+ * otsu               black and white by Otsu's threshold of the image
+ * adaptive[:W]       black and white by the mean of a W by W window around
+ *                    every pixel, odd W (default 15, 3 to 51)
+ * pad:P              add a white border of P pixels (1 to 100), changes
+ *                    the size
+ *
+ * upscale, otsu, adaptive and pad are meant for the crops read by OCR (see
+ * binarize.go), e.g upscale:4:cubic|otsu|pad:10.
+ *
+ * The filter names of earlier versions (e.g invertAndBlackAndWhite) are
+ * accepted as aliases of the same pipelines.
+ */
+package irfilter
+
+import (
+  "fmt"
+  "image"
+  "sort"
+  "strconv"
+  "strings"
+
+  "github.com/disintegration/gift"
+)
+
+/* Aliases maps the legacy filter names to pipelines, none and the like are
+ * no filter at all.
+ */
+var Aliases = map[string]string{
+  "none": "",
+  "na": "",
+  "n/a": "",
+  "nil": "",
+  "invert": "invert",
+  "grayscale": "grayscale",
+  "blackandwhite": "grayscale|brightness:-40|contrast:80",
+  "invertandgrayscale": "invert|grayscale",
+  "invertandblackandwhite": "invert|grayscale|brightness:-40|contrast:80",
+}
+
+// step is one parsed step, filter returns the gift filter for a source size
+type step struct {
+  name string
+  arg string
+  resizes bool
+  filter func(size image.Point) gift.Filter
+}
+
+// Pipeline is a parsed filter pipeline, the zero value does nothing
+type Pipeline struct {
+  steps []step
+}
+
+// argument is the range of a step argument
+type argument struct {
+  min, max float64
+  def string    // default, empty if the argument is required
+  integer bool
+  options []string  // names allowed after a second colon, e.g resamplings
+  defOption string
+}
+
+var arguments = map[string]*argument{
+  "invert": nil,
+  "grayscale": nil,
+  "brightness": { -100, 100, "", false, nil, "" },
+  "contrast": { -100, 100, "", false, nil, "" },
+  "gamma": { 0.1, 10, "", false, nil, "" },
+  "threshold": { 1, 254, "", true, nil, "" },
+  "blur": { 0.1, 10, "", false, nil, "" },
+  "median": { 3, 9, "", true, nil, "" },
+  "sharpen": { 0.1, 5, "1", false, nil, "" },
+  "scale": { 0.1, 10, "", false, nil, "" },
+  "upscale": { 2, 8, "", true, resamplingNames(), "lanczos" },
+  "otsu": nil,
+  "adaptive": { 3, 51, "15", true, nil, "" },
+  "pad": { 1, 100, "", true, nil, "" },
+}
+
+// resamplingNames returns the names of Resamplings, sorted
+func resamplingNames() ([]string) {
+  names := []string{}
+  for name := range Resamplings {
+    names = append(names, name)
+  }
+  sort.Strings(names)
+  return names
+}
+
+/* Names returns the names of the steps, sorted */
+func Names() ([]string) {
+  names := []string{}
+  for name := range arguments {
+    names = append(names, name)
+  }
+  sort.Strings(names)
+  return names
+}
+
+/* Parse parses spec (a pipeline or a legacy name, case insensitive), an
+ * empty spec is an empty pipeline.
+ */
+func Parse(spec string) (Pipeline, error) {
+  p := Pipeline{}
+  s := strings.ToLower(strings.TrimSpace(spec))
+  if alias, ok := Aliases[s]; ok {
+    s = alias
+  }
+  if s == "" {
+    return p, nil
+  }
+  for _, part := range strings.Split(s, "|") {
+    st, err := parseStep(strings.TrimSpace(part))
+    if err != nil {
+      return Pipeline{}, fmt.Errorf("Filter %s: %v", spec, err)
+    }
+    p.steps = append(p.steps, st)
+  }
+  return p, nil
+}
+
+func parseStep(part string) (step, error) {
+  nameAndArg := strings.SplitN(part, ":", 2)
+  name := strings.TrimSpace(nameAndArg[0])
+  arg := ""
+  if len(nameAndArg) == 2 {
+    arg = strings.TrimSpace(nameAndArg[1])
+  }
+  if name == "" {
+    return step{}, fmt.Errorf("Empty step, steps are separated by |")
+  }
+  a, known := arguments[name]
+  if ! known {
+    return step{}, fmt.Errorf("Unknown step %s, steps are %s", name, strings.Join(Names(), ", "))
+  }
+  if a == nil && arg != "" {
+    return step{}, fmt.Errorf("%s takes no argument", name)
+  }
+  var v float64
+  option := ""
+  if a != nil {
+    if arg == "" {
+      arg = a.def
+    }
+    if a.options != nil {
+      valueAndOption := strings.SplitN(arg, ":", 2)
+      arg, option = strings.TrimSpace(valueAndOption[0]), a.defOption
+      if len(valueAndOption) == 2 {
+        option = strings.TrimSpace(valueAndOption[1])
+      }
+      known := false
+      for _, o := range a.options {
+        known = known || o == option
+      }
+      if ! known {
+        return step{}, fmt.Errorf("%s option %s is not one of %s", name, option, strings.Join(a.options, ", "))
+      }
+    }
+    if arg == "" {
+      return step{}, fmt.Errorf("%s requires an argument between %g and %g", name, a.min, a.max)
+    }
+    var err error
+    v, err = strconv.ParseFloat(arg, 64)
+    if err != nil {
+      return step{}, fmt.Errorf("%s argument %s is not a number", name, arg)
+    }
+    if v < a.min || v > a.max {
+      return step{}, fmt.Errorf("%s argument %s is not between %g and %g", name, arg, a.min, a.max)
+    }
+    if a.integer && v != float64(int(v)) {
+      return step{}, fmt.Errorf("%s argument %s is not an integer", name, arg)
+    }
+  }
+  st := step{ name: name, arg: arg }
+  if option != "" {
+    st.arg += ":" + option
+  }
+  f := float32(v)
+  switch name {
+    case "invert":
+      st.filter = constant(gift.Invert())
+    case "grayscale":
+      st.filter = constant(gift.Grayscale())
+    case "brightness":
+      st.filter = constant(gift.Brightness(f))
+    case "contrast":
+      st.filter = constant(gift.Contrast(f))
+    case "gamma":
+      st.filter = constant(gift.Gamma(f))
+    case "threshold":
+      // gift takes the threshold in percent
+      st.filter = constant(gift.Threshold(f / 255 * 100))
+    case "blur":
+      st.filter = constant(gift.GaussianBlur(f))
+    case "median":
+      if int(v) % 2 == 0 {
+        return step{}, fmt.Errorf("median argument %s is not odd", arg)
+      }
+      st.filter = constant(gift.Median(int(v), false))
+    case "sharpen":
+      st.filter = constant(gift.UnsharpMask(1, f, 0))
+    case "scale":
+      st.resizes = true
+      st.filter = func(size image.Point) gift.Filter {
+        return gift.Resize(int(float64(size.X) * v + 0.5), int(float64(size.Y) * v + 0.5), gift.LanczosResampling)
+      }
+    case "upscale":
+      st.resizes = true
+      st.filter = func(size image.Point) gift.Filter {
+        return gift.Resize(size.X * int(v), size.Y * int(v), Resamplings[option])
+      }
+    case "otsu":
+      st.filter = constant(otsuFilter{})
+    case "adaptive":
+      if int(v) % 2 == 0 {
+        return step{}, fmt.Errorf("adaptive argument %s is not odd", arg)
+      }
+      st.filter = constant(adaptiveFilter{ int(v) })
+    case "pad":
+      st.resizes = true
+      st.filter = constant(padFilter{ int(v) })
+  }
+  return st, nil
+}
+
+func constant(f gift.Filter) (func(image.Point) gift.Filter) {
+  return func(image.Point) gift.Filter {
+    return f
+  }
+}
+
+/* Empty returns true if the pipeline does nothing */
+func (p Pipeline) Empty() (bool) {
+  return len(p.steps) == 0
+}
+
+/* Has returns true if the pipeline has a step named name */
+func (p Pipeline) Has(name string) (bool) {
+  for _, st := range p.steps {
+    if st.name == name {
+      return true
+    }
+  }
+  return false
+}
+
+/* Resizes returns true if a step changes the size of the image, i.e the
+ * pipeline can not be applied before cropping with fixed coordinates.
+ */
+func (p Pipeline) Resizes() (bool) {
+  for _, st := range p.steps {
+    if st.resizes {
+      return true
+    }
+  }
+  return false
+}
+
+/* String returns the pipeline in canonical form, legacy names expanded */
+func (p Pipeline) String() (string) {
+  var parts []string
+  for _, st := range p.steps {
+    if st.arg != "" {
+      parts = append(parts, st.name + ":" + st.arg)
+    } else {
+      parts = append(parts, st.name)
+    }
+  }
+  return strings.Join(parts, "|")
+}
+
+/* Apply returns src filtered by the pipeline, src itself if it is empty */
+func (p Pipeline) Apply(src image.Image) (image.Image) {
+  if p.Empty() {
+    return src
+  }
+  g := gift.New()
+  bounds := src.Bounds()
+  for _, st := range p.steps {
+    f := st.filter(bounds.Size())
+    g.Add(f)
+    bounds = f.Bounds(bounds)
+  }
+  dst := image.NewRGBA(g.Bounds(src.Bounds()))
+  g.Draw(dst, src)
+  return dst
+}
@@ -0,0 +1,98 @@
+package irfilter
+
+import (
+  "image"
+  "image/color"
+  "testing"
+)
+
+func TestParse(t *testing.T) {
+  cases := []struct {
+    spec string
+    want string    // String() of the pipeline
+    resizes bool
+  }{
+    { "", "", false },
+    { "none", "", false },
+    { "N/A", "", false },
+    { "invert", "invert", false },
+    { "blackandwhite", "grayscale|brightness:-40|contrast:80", false },
+    { "invertAndGrayscale", "invert|grayscale", false },
+    { "invertandblackandwhite", "invert|grayscale|brightness:-40|contrast:80", false },
+    { " Invert | GrayScale ", "invert|grayscale", false },
+    { "invert|grayscale|brightness:-40|contrast:80|threshold:128", "invert|grayscale|brightness:-40|contrast:80|threshold:128", false },
+    { "sharpen", "sharpen:1", false },
+    { "sharpen:2.5|median:3|blur:0.5|gamma:0.8", "sharpen:2.5|median:3|blur:0.5|gamma:0.8", false },
+    { "threshold:128|scale:3|sharpen", "threshold:128|scale:3|sharpen:1", true },
+  }
+  for _, c := range cases {
+    p, err := Parse(c.spec)
+    if err != nil {
+      t.Errorf("Parse(%q): %v", c.spec, err)
+      continue
+    }
+    if p.String() != c.want {
+      t.Errorf("Parse(%q).String() = %q, want %q", c.spec, p.String(), c.want)
+    }
+    if p.Empty() != (c.want == "") {
+      t.Errorf("Parse(%q).Empty() = %t", c.spec, p.Empty())
+    }
+    if p.Resizes() != c.resizes {
+      t.Errorf("Parse(%q).Resizes() = %t, want %t", c.spec, p.Resizes(), c.resizes)
+    }
+    // the canonical form parses to itself
+    if again, err := Parse(p.String()); err != nil || again.String() != p.String() {
+      t.Errorf("Parse(%q) = %q, %v", p.String(), again.String(), err)
+    }
+  }
+}
+
+func TestParseErrors(t *testing.T) {
+  for _, spec := range []string{
+    "bogus",                // unknown step
+    "invert||grayscale",    // empty step
+    "invert:1",             // takes no argument
+    "grayscale:50",
+    "brightness",           // requires an argument
+    "brightness:-101",      // out of range
+    "contrast:101",
+    "gamma:0",
+    "threshold:0",
+    "threshold:255",
+    "threshold:127.5",      // not an integer
+    "threshold:x",          // not a number
+    "median:4",             // even window
+    "median:11",
+    "median:3.5",
+    "sharpen:6",
+    "scale:11",
+    "invert|blackandwhite", // aliases are whole filters, not steps
+  } {
+    if p, err := Parse(spec); err == nil {
+      t.Errorf("Parse(%q) = %q, want an error", spec, p.String())
+    }
+  }
+}
+
+func TestApply(t *testing.T) {
+  src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+  for x := 0; x < 4; x++ {
+    src.Set(x, 0, color.RGBA{ 255, 255, 255, 255 })
+    src.Set(x, 1, color.RGBA{ 0, 0, 0, 255 })
+  }
+  if p, _ := Parse(""); p.Apply(src) != image.Image(src) {
+    t.Errorf("empty pipeline did not return src")
+  }
+  p, _ := Parse("invert")
+  dst := p.Apply(src)
+  if r, _, _, _ := dst.At(0, 0).RGBA(); r != 0 {
+    t.Errorf("inverted white is %d, want 0", r)
+  }
+  if r, _, _, _ := dst.At(0, 1).RGBA(); r != 0xffff {
+    t.Errorf("inverted black is %d, want 0xffff", r)
+  }
+  p, _ = Parse("scale:2.5")
+  if b := p.Apply(src).Bounds(); b.Dx() != 10 || b.Dy() != 5 {
+    t.Errorf("scale:2.5 of 4x2 is %v, want 10x5", b)
+  }
+}
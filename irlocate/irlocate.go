@@ -0,0 +1,177 @@
+/* Package irlocate finds the value boxes in the header of an ionogram from
+ * the labels printed next to them, so crops follow the text when a provider
+ * shifts the header by a few pixels. The header is read word by word by an
+ * OCR engine, the words (with their boxes) are searched for labels such as
+ * "foF2" and "fmin" and for the date line, and the value box of a label is
+ * the number right of it on the same line:
+ *
+ *   foF2  5.125      label "foF2", value box around "5.125"
+ *   fmin  1.60
+ *
+ * Fields whose label is not found are left out, the caller falls back to
+ * the stored crops.
+ */
+package irlocate
+
+import (
+  "image"
+  "sort"
+  "strings"
+  "unicode"
+)
+
+// Pad is the margin (pixels) around a located value or date
+const Pad int = 2
+
+// Word is a word read by OCR and its box in image coordinates
+type Word struct {
+  Text string
+  Box image.Rectangle
+}
+
+// Line is words on the same text line, left to right
+type Line struct {
+  Words []Word
+  Box image.Rectangle
+}
+
+/* Labels are the labels of each field normalized (see normalize()), with
+ * common alternatives and OCR misreads.
+ */
+var Labels = map[string][]string{
+  "foF2": { "fof2" },
+  "foF1": { "fof1", "fofl" },
+  "foE": { "foe" },
+  "fxI": { "fxi", "fxl", "fx1" },
+  "foEs": { "foes" },
+  "fmin": { "fmin" },
+  "hmF2": { "hmf2", "zmf2" },
+  "hmE": { "hme", "zme" },
+}
+
+/* normalize returns s in lower case without punctuation, 0 is read as o
+ * (labels have no zeroes).
+ */
+func normalize(s string) (string) {
+  var b strings.Builder
+  for _, r := range strings.ToLower(s) {
+    switch {
+      case r == '0':
+        b.WriteRune('o')
+      case unicode.IsLetter(r) || unicode.IsDigit(r):
+        b.WriteRune(r)
+    }
+  }
+  return b.String()
+}
+
+// centerY returns the vertical center of r
+func centerY(r image.Rectangle) (int) {
+  return (r.Min.Y + r.Max.Y) / 2
+}
+
+// sameLine returns true if the vertical center of b is within a
+func sameLine(a, b image.Rectangle) (bool) {
+  cy := centerY(b)
+  return cy >= a.Min.Y && cy < a.Max.Y
+}
+
+/* Lines groups words into text lines, top to bottom */
+func Lines(words []Word) ([]Line) {
+  sorted := append([]Word{}, words...)
+  sort.SliceStable(sorted, func(a, b int) bool {
+    return sorted[a].Box.Min.Y < sorted[b].Box.Min.Y
+  })
+  var lines []Line
+  for _, w := range sorted {
+    n := 0
+    for ; n < len(lines); n++ {
+      if sameLine(lines[n].Words[0].Box, w.Box) {
+        break
+      }
+    }
+    if n == len(lines) {
+      lines = append(lines, Line{ Box: w.Box })
+    }
+    lines[n].Words = append(lines[n].Words, w)
+    lines[n].Box = lines[n].Box.Union(w.Box)
+  }
+  for n := range lines {
+    ws := lines[n].Words
+    sort.SliceStable(ws, func(a, b int) bool {
+      return ws[a].Box.Min.X < ws[b].Box.Min.X
+    })
+  }
+  return lines
+}
+
+/* FindLabel returns the top left word that is a label of field (see
+ * Labels), ok is false if there is none.
+ */
+func FindLabel(words []Word, field string) (label Word, ok bool) {
+  for _, w := range words {
+    text := normalize(w.Text)
+    for _, l := range Labels[field] {
+      if text != l {
+        continue
+      }
+      if ! ok || w.Box.Min.Y < label.Box.Min.Y ||
+          (w.Box.Min.Y == label.Box.Min.Y && w.Box.Min.X < label.Box.Min.X) {
+        label, ok = w, true
+      }
+    }
+  }
+  return label, ok
+}
+
+/* ValueBox returns the box of the value of label: the first word with a
+ * digit right of it on the same line, padded by Pad, with the height of
+ * size centered on the line. Without such a word the box of size starts
+ * right after the label.
+ */
+func ValueBox(words []Word, label Word, size image.Point) (image.Rectangle) {
+  top := centerY(label.Box) - size.Y / 2
+  value, found := Word{}, false
+  for _, w := range words {
+    if w.Box.Min.X < label.Box.Max.X || ! sameLine(label.Box, w.Box) {
+      continue
+    }
+    if strings.IndexFunc(w.Text, unicode.IsDigit) < 0 {
+      continue
+    }
+    if ! found || w.Box.Min.X < value.Box.Min.X {
+      value, found = w, true
+    }
+  }
+  if ! found {
+    x := label.Box.Max.X + Pad
+    return image.Rect(x, top, x + size.X, top + size.Y)
+  }
+  return image.Rect(value.Box.Min.X - Pad, top, value.Box.Max.X + Pad, top + size.Y)
+}
+
+/* FindDate returns the box of the date: n consecutive words on one line
+ * that match accepts, the one with the lowest cost (e.g irdate correction
+ * cost) if several do. ok is false if no words match.
+ */
+func FindDate(words []Word, n int, match func(text string) (cost float64, ok bool)) (box image.Rectangle, ok bool) {
+  if n < 1 {
+    n = 1
+  }
+  best := 0.0
+  for _, line := range Lines(words) {
+    for start := 0; start + n <= len(line.Words); start++ {
+      var texts []string
+      r := line.Words[start].Box
+      for _, w := range line.Words[start:start + n] {
+        texts = append(texts, w.Text)
+        r = r.Union(w.Box)
+      }
+      cost, matched := match(strings.Join(texts, " "))
+      if matched && (! ok || cost < best) {
+        box, best, ok = r.Inset(-Pad), cost, true
+      }
+    }
+  }
+  return box, ok
+}
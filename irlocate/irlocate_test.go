@@ -0,0 +1,156 @@
+package irlocate
+
+import (
+  "image"
+  "strings"
+  "testing"
+)
+
+func word(text string, x0, y0, x1, y1 int) (Word) {
+  return Word{ Text: text, Box: image.Rect(x0, y0, x1, y1) }
+}
+
+/* header is the anchor region of an ionogram, slightly skewed: every word
+ * is 1 pixel lower than the one left of it. The date is spread over four
+ * words on the first line.
+ */
+var header = []Word{
+  word("101500", 190, 13, 240, 25),
+  word("2021", 10, 10, 45, 22),
+  word("Mar04", 52, 11, 100, 23),
+  word("063", 150, 12, 180, 24),
+  word("foF2", 10, 40, 45, 52),
+  word("5.125", 60, 41, 105, 53),
+  word("f0E", 130, 42, 160, 54),
+  word("2.60", 170, 43, 205, 55),
+  word("fmin", 10, 70, 45, 82),
+  word("1.60", 60, 71, 95, 83),
+  word("MHz", 100, 72, 130, 84),
+  // the value of hmF2 is at the right edge of the image
+  word("zmF2", 240, 71, 280, 83),
+  word("262", 288, 72, 320, 84),
+}
+
+func TestLines(t *testing.T) {
+  lines := Lines(header)
+  want := []string{
+    "2021 Mar04 063 101500",
+    "foF2 5.125 f0E 2.60",
+    "fmin 1.60 MHz zmF2 262",
+  }
+  if len(lines) != len(want) {
+    t.Fatalf("Lines found %d lines, want %d", len(lines), len(want))
+  }
+  for n, line := range lines {
+    var texts []string
+    for _, w := range line.Words {
+      texts = append(texts, w.Text)
+    }
+    if strings.Join(texts, " ") != want[n] {
+      t.Errorf("line %d is %q, want %q", n, strings.Join(texts, " "), want[n])
+    }
+  }
+  if want := image.Rect(10, 10, 240, 25); lines[0].Box != want {
+    t.Errorf("box of line 0 is %v, want %v", lines[0].Box, want)
+  }
+  if len(Lines(nil)) != 0 {
+    t.Errorf("Lines without words found lines")
+  }
+}
+
+func TestFindLabel(t *testing.T) {
+  cases := []struct {
+    field string
+    want string  // text of the label, empty if missing
+  }{
+    { "foF2", "foF2" },
+    { "foE", "f0E" },      // 0 read for o
+    { "fmin", "fmin" },
+    { "hmF2", "zmF2" },    // alternative label
+    { "foF1", "" },
+    { "fxI", "" },
+    { "bogus", "" },
+  }
+  for _, c := range cases {
+    label, ok := FindLabel(header, c.field)
+    if ok != (c.want != "") || label.Text != c.want {
+      t.Errorf("FindLabel(%s) = %q, %t, want %q", c.field, label.Text, ok, c.want)
+    }
+  }
+  // the top left of several labels
+  words := []Word{ word("fmin", 50, 40, 80, 50), word("FMIN", 10, 40, 40, 50), word("fmin", 0, 60, 30, 70) }
+  if label, _ := FindLabel(words, "fmin"); label.Box.Min != image.Pt(10, 40) {
+    t.Errorf("FindLabel of several = %v, want the top left", label.Box)
+  }
+}
+
+func TestValueBox(t *testing.T) {
+  bounds := image.Rect(0, 0, 320, 100)
+  size := image.Pt(50, 16)
+  cases := []struct {
+    field string
+    want image.Rectangle
+  }{
+    // the first word with a digit right of the label, height of size
+    // centered on the label
+    { "foF2", image.Rect(58, 38, 107, 54) },
+    { "foE", image.Rect(168, 40, 207, 56) },
+    { "fmin", image.Rect(58, 68, 97, 84) },
+    // padded past the right edge, clipped by the caller
+    { "hmF2", image.Rect(286, 69, 320, 85) },
+  }
+  for _, c := range cases {
+    label, ok := FindLabel(header, c.field)
+    if ! ok {
+      t.Fatalf("no label of %s", c.field)
+    }
+    if box := ValueBox(header, label, size).Intersect(bounds); box != c.want {
+      t.Errorf("ValueBox(%s) = %v, want %v", c.field, box, c.want)
+    }
+  }
+  if box := ValueBox(header, header[11], size); box.Max.X != 322 {
+    t.Errorf("ValueBox at the edge = %v, want it padded to 322", box)
+  }
+
+  // without a value on the line the box of size starts after the label
+  label := word("foEs", 10, 90, 45, 100)
+  if box := ValueBox(header, label, size); box != image.Rect(47, 87, 97, 103) {
+    t.Errorf("ValueBox without a value = %v", box)
+  }
+}
+
+func TestFindDate(t *testing.T) {
+  // a date matcher, with a correction for O read for 0
+  match := func(text string) (float64, bool) {
+    if corrected := strings.Replace(text, "O", "0", -1); corrected == "2021 Mar04 063 101500" {
+      return float64(strings.Count(text, "O")), true
+    }
+    return 0, false
+  }
+  box, ok := FindDate(header, 4, match)
+  if ! ok {
+    t.Fatal("FindDate did not find the date")
+  }
+  if want := image.Rect(10, 10, 240, 25).Inset(-Pad); box != want {
+    t.Errorf("FindDate = %v, want %v", box, want)
+  }
+  // the cheapest wins, not the first
+  words := []Word{
+    word("2O21", 10, 10, 45, 22), word("Mar04", 52, 10, 100, 22), word("O63", 150, 10, 180, 22), word("101500", 190, 10, 240, 22),
+    word("2021", 10, 40, 45, 52), word("Mar04", 52, 40, 100, 52), word("063", 150, 40, 180, 52), word("101500", 190, 40, 240, 52),
+  }
+  if box, _ := FindDate(words, 4, match); box != image.Rect(10, 40, 240, 52).Inset(-Pad) {
+    t.Errorf("FindDate of two dates = %v, want the second", box)
+  }
+  // words of different lines are not joined
+  split := []Word{ word("2021", 10, 10, 45, 22), word("Mar04", 52, 10, 100, 22), word("063", 150, 40, 180, 52), word("101500", 190, 40, 240, 52) }
+  if box, ok := FindDate(split, 4, match); ok {
+    t.Errorf("FindDate over two lines = %v", box)
+  }
+  if _, ok := FindDate(header, 5, match); ok {
+    t.Errorf("FindDate of 5 words found a date")
+  }
+  if _, ok := FindDate(nil, 4, match); ok {
+    t.Errorf("FindDate without words found a date")
+  }
+}
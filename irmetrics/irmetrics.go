@@ -0,0 +1,288 @@
+/* Package irmetrics is a minimal implementation of counters, gauges and
+ * histograms with labels exported in the Prometheus text exposition format,
+ * see https://prometheus.io/docs/instrumenting/exposition_formats/
+ */
+package irmetrics
+
+import (
+  "fmt"
+  "io"
+  "math"
+  "net/http"
+  "sort"
+  "strconv"
+  "strings"
+  "sync"
+)
+
+// DefaultBuckets are histogram upper bounds in seconds suitable for scrape durations
+var DefaultBuckets = []float64{ 0.5, 1, 2.5, 5, 10, 15, 30, 60 }
+
+type collector interface {
+  write(w io.Writer) error
+}
+
+// Registry holds all metrics to export
+type Registry struct {
+  mu sync.Mutex
+  collectors []collector
+}
+
+func NewRegistry() *Registry {
+  return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+  r.mu.Lock()
+  defer r.mu.Unlock()
+  r.collectors = append(r.collectors, c)
+}
+
+/* Write writes all registered metrics in the Prometheus text format */
+func (r *Registry) Write(w io.Writer) error {
+  r.mu.Lock()
+  collectors := append([]collector{}, r.collectors...)
+  r.mu.Unlock()
+  for _, c := range collectors {
+    if err := c.write(w); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+/* ServeHTTP makes the Registry a http.Handler for e.g /metrics */
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+  w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+  r.Write(w)
+}
+
+// vec is the common part of all metrics, values are keyed by label values
+type vec struct {
+  mu sync.Mutex
+  name string
+  help string
+  kind string
+  labels []string
+}
+
+func (v *vec) key(labelValues []string) string {
+  if len(labelValues) != len(v.labels) {
+    panic(fmt.Sprintf("%s: expected %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+  }
+  return strings.Join(labelValues, "\xff")
+}
+
+func (v *vec) header(w io.Writer) error {
+  _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, escapeHelp(v.help), v.name, v.kind)
+  return err
+}
+
+/* labelPairs formats {a="b",c="d"}, extra is appended as is (used for le) */
+func (v *vec) labelPairs(key string, extra string) string {
+  pairs := []string{}
+  if len(v.labels) > 0 {
+    values := strings.Split(key, "\xff")
+    for i := range v.labels {
+      pairs = append(pairs, fmt.Sprintf(`%s="%s"`, v.labels[i], escapeLabel(values[i])))
+    }
+  }
+  if extra != "" {
+    pairs = append(pairs, extra)
+  }
+  if len(pairs) == 0 {
+    return ""
+  }
+  return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func sortedKeys(m map[string]float64) []string {
+  keys := []string{}
+  for k := range m {
+    keys = append(keys, k)
+  }
+  sort.Strings(keys)
+  return keys
+}
+
+// CounterVec is a monotonically increasing value per label combination
+type CounterVec struct {
+  vec
+  values map[string]float64
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+  c := &CounterVec{
+    vec: vec{ name: name, help: help, kind: "counter", labels: labels },
+    values: map[string]float64{},
+  }
+  r.register(c)
+  return c
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+  c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+  if v < 0 {
+    return
+  }
+  k := c.key(labelValues)
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  c.values[k] += v
+}
+
+func (c *CounterVec) write(w io.Writer) error {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  if err := c.header(w); err != nil {
+    return err
+  }
+  for _, k := range sortedKeys(c.values) {
+    if _, err := fmt.Fprintf(w, "%s%s %s\n", c.name, c.labelPairs(k, ""), formatFloat(c.values[k])); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+// GaugeVec is a value that can go up and down per label combination
+type GaugeVec struct {
+  vec
+  values map[string]float64
+}
+
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+  g := &GaugeVec{
+    vec: vec{ name: name, help: help, kind: "gauge", labels: labels },
+    values: map[string]float64{},
+  }
+  r.register(g)
+  return g
+}
+
+func (g *GaugeVec) Set(v float64, labelValues ...string) {
+  k := g.key(labelValues)
+  g.mu.Lock()
+  defer g.mu.Unlock()
+  g.values[k] = v
+}
+
+/* Delete removes the value for a label combination, e.g when it is unknown */
+func (g *GaugeVec) Delete(labelValues ...string) {
+  k := g.key(labelValues)
+  g.mu.Lock()
+  defer g.mu.Unlock()
+  delete(g.values, k)
+}
+
+func (g *GaugeVec) write(w io.Writer) error {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+  if err := g.header(w); err != nil {
+    return err
+  }
+  for _, k := range sortedKeys(g.values) {
+    if _, err := fmt.Fprintf(w, "%s%s %s\n", g.name, g.labelPairs(k, ""), formatFloat(g.values[k])); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+// HistogramVec counts observations in cumulative buckets per label combination
+type HistogramVec struct {
+  vec
+  buckets []float64
+  values map[string]*histogram
+}
+
+type histogram struct {
+  counts []uint64
+  count uint64
+  sum float64
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+  b := append([]float64{}, buckets...)
+  sort.Float64s(b)
+  h := &HistogramVec{
+    vec: vec{ name: name, help: help, kind: "histogram", labels: labels },
+    buckets: b,
+    values: map[string]*histogram{},
+  }
+  r.register(h)
+  return h
+}
+
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+  k := h.key(labelValues)
+  h.mu.Lock()
+  defer h.mu.Unlock()
+  hg, ok := h.values[k]
+  if ! ok {
+    hg = &histogram{ counts: make([]uint64, len(h.buckets)) }
+    h.values[k] = hg
+  }
+  for i, upper := range h.buckets {
+    if v <= upper {
+      hg.counts[i]++
+    }
+  }
+  hg.count++
+  hg.sum += v
+}
+
+func (h *HistogramVec) write(w io.Writer) error {
+  h.mu.Lock()
+  defer h.mu.Unlock()
+  if err := h.header(w); err != nil {
+    return err
+  }
+  keys := []string{}
+  for k := range h.values {
+    keys = append(keys, k)
+  }
+  sort.Strings(keys)
+  for _, k := range keys {
+    hg := h.values[k]
+    for i, upper := range h.buckets {
+      le := fmt.Sprintf(`le="%s"`, formatFloat(upper))
+      if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(k, le), hg.counts[i]); err != nil {
+        return err
+      }
+    }
+    if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+        h.name, h.labelPairs(k, `le="+Inf"`), hg.count,
+        h.name, h.labelPairs(k, ""), formatFloat(hg.sum),
+        h.name, h.labelPairs(k, ""), hg.count); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+func formatFloat(f float64) string {
+  switch {
+    case math.IsInf(f, 1):
+      return "+Inf"
+    case math.IsInf(f, -1):
+      return "-Inf"
+    case math.IsNaN(f):
+      return "NaN"
+  }
+  return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+  return labelEscaper.Replace(s)
+}
+
+func escapeHelp(s string) string {
+  return helpEscaper.Replace(s)
+}
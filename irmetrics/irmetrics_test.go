@@ -0,0 +1,100 @@
+package irmetrics
+
+import (
+  "bytes"
+  "math"
+  "net/http/httptest"
+  "strings"
+  "testing"
+)
+
+func TestWrite(t *testing.T) {
+  r := NewRegistry()
+  c := r.NewCounterVec("test_total", "Number of tests,\nback\\slash.", "ursi", "reason")
+  g := r.NewGaugeVec("test_mhz", "Latest value.", "ursi")
+  h := r.NewHistogramVec("test_seconds", "Time of a test.", []float64{ 5, 1, 2.5 }, "ursi")
+  n := r.NewGaugeVec("test_plain", "Without labels.")
+
+  c.Inc("JR055", `quote "x"`)
+  c.Add(2, "JR055", "a\\b\nc")
+  c.Add(-1, "JR055", "a\\b\nc")  // counters do not go down
+  c.Inc("EB040", `quote "x"`)
+  g.Set(5.125, "JR055")
+  g.Set(3, "EB040")
+  g.Delete("EB040")
+  g.Set(math.Inf(1), "RO041")
+  h.Observe(0.5, "JR055")
+  h.Observe(2.5, "JR055")
+  h.Observe(12, "JR055")
+  n.Set(1)
+
+  var b bytes.Buffer
+  if err := r.Write(&b); err != nil {
+    t.Fatal(err)
+  }
+  want := `# HELP test_total Number of tests,\nback\\slash.
+# TYPE test_total counter
+test_total{ursi="EB040",reason="quote \"x\""} 1
+test_total{ursi="JR055",reason="a\\b\nc"} 2
+test_total{ursi="JR055",reason="quote \"x\""} 1
+# HELP test_mhz Latest value.
+# TYPE test_mhz gauge
+test_mhz{ursi="JR055"} 5.125
+test_mhz{ursi="RO041"} +Inf
+# HELP test_seconds Time of a test.
+# TYPE test_seconds histogram
+test_seconds_bucket{ursi="JR055",le="1"} 1
+test_seconds_bucket{ursi="JR055",le="2.5"} 2
+test_seconds_bucket{ursi="JR055",le="5"} 2
+test_seconds_bucket{ursi="JR055",le="+Inf"} 3
+test_seconds_sum{ursi="JR055"} 15
+test_seconds_count{ursi="JR055"} 3
+# HELP test_plain Without labels.
+# TYPE test_plain gauge
+test_plain 1
+`
+  if b.String() != want {
+    t.Errorf("Write =\n%s\nwant\n%s", b.String(), want)
+  }
+}
+
+func TestServeHTTP(t *testing.T) {
+  r := NewRegistry()
+  r.NewCounterVec("test_total", "Number of tests.", "ursi").Inc("JR055")
+  w := httptest.NewRecorder()
+  r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+  if ct := w.Header().Get("Content-Type"); ! strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+    t.Errorf("Content-Type is %q", ct)
+  }
+  if ! strings.Contains(w.Body.String(), "test_total{ursi=\"JR055\"} 1\n") {
+    t.Errorf("body is %q", w.Body.String())
+  }
+}
+
+func TestWrongLabels(t *testing.T) {
+  defer func() {
+    if recover() == nil {
+      t.Errorf("Inc with a missing label value did not panic")
+    }
+  }()
+  NewRegistry().NewCounterVec("test_total", "Number of tests.", "ursi", "reason").Inc("JR055")
+}
+
+func TestFormatFloat(t *testing.T) {
+  cases := []struct {
+    f float64
+    want string
+  }{
+    { 0, "0" },
+    { 0.85, "0.85" },
+    { 1e21, "1e+21" },
+    { math.Inf(1), "+Inf" },
+    { math.Inf(-1), "-Inf" },
+    { math.NaN(), "NaN" },
+  }
+  for _, c := range cases {
+    if s := formatFloat(c.f); s != c.want {
+      t.Errorf("formatFloat(%g) = %q, want %q", c.f, s, c.want)
+    }
+  }
+}
@@ -0,0 +1,436 @@
+/* Package irocr is a small pure-Go OCR for the fixed bitmap fonts printed
+ * on ionograms (e.g Digisonde/Lowell SAO-Explorer ionograms). It reads a
+ * single line of text by binarizing the image, splitting it into glyphs at
+ * empty columns and matching every glyph against templates of known
+ * characters. Templates are "trained" by saving glyphs cut from real
+ * ionograms with SaveTemplate(), one PNG file per glyph.
+ */
+package irocr
+
+import (
+  "fmt"
+  "image"
+  "image/color"
+  "image/png"
+  "io/ioutil"
+  "math"
+  "os"
+  "path/filepath"
+  "sort"
+  "strings"
+  "unicode/utf8"
+)
+
+// DefaultMinScore is the lowest score accepted as a match
+const DefaultMinScore float64 = 0.75
+
+// Template names of characters not allowed or awkward in file names
+var templateAliases = map[string]rune{
+  "dot": '.',
+  "comma": ',',
+  "colon": ':',
+  "slash": '/',
+  "minus": '-',
+  "plus": '+',
+  "lparen": '(',
+  "rparen": ')',
+  "question": '?',
+  "at": '@',
+}
+
+// Bitmap is a binarized image, true is ink
+type Bitmap struct {
+  W, H int
+  Bits []bool
+}
+
+func (b Bitmap) at(x, y int) bool {
+  return b.Bits[y * b.W + x]
+}
+
+// Template is a known character and its glyph
+type Template struct {
+  Char rune
+  Glyph Bitmap
+}
+
+// Match is a recognized character, Score is 0 to 1
+type Match struct {
+  Char rune
+  Score float64
+  Box image.Rectangle
+}
+
+// Result of Recognize(), Chars does not include spaces
+type Result struct {
+  Text string
+  Chars []Match
+}
+
+/* Confidence returns the lowest score of all characters, 0 if there are
+ * none.
+ */
+func (r Result) Confidence() float64 {
+  if len(r.Chars) == 0 {
+    return 0
+  }
+  c := 1.0
+  for _, m := range r.Chars {
+    c = math.Min(c, m.Score)
+  }
+  return c
+}
+
+// Recognizer matches glyphs against templates, it is safe for concurrent
+// use once all templates are added.
+type Recognizer struct {
+  Templates []Template
+  // MinScore is the lowest score accepted, glyphs matching no template
+  // better are returned as Unknown.
+  MinScore float64
+  Unknown rune
+}
+
+/* New returns a Recognizer without templates */
+func New() *Recognizer {
+  return &Recognizer{ MinScore: DefaultMinScore, Unknown: '?' }
+}
+
+/* Only returns a copy of r that only recognizes the characters in chars */
+func (r *Recognizer) Only(chars string) *Recognizer {
+  o := *r
+  o.Templates = nil
+  for _, t := range r.Templates {
+    if strings.ContainsRune(chars, t.Char) {
+      o.Templates = append(o.Templates, t)
+    }
+  }
+  return &o
+}
+
+/* Load returns a Recognizer with all templates in dir. Template files are
+ * PNG images of one glyph named after the character, optionally followed by
+ * _ and anything to allow several templates per character, e.g 7.png,
+ * 7_2.png, A.png, dot_1.png (see templateAliases).
+ */
+func Load(dir string) (*Recognizer, error) {
+  r := New()
+  files, err := ioutil.ReadDir(dir)
+  if err != nil {
+    return nil, err
+  }
+  for _, f := range files {
+    if f.IsDir() || strings.ToLower(filepath.Ext(f.Name())) != ".png" {
+      continue
+    }
+    c, err := templateChar(f.Name())
+    if err != nil {
+      return nil, err
+    }
+    img, err := loadPng(filepath.Join(dir, f.Name()))
+    if err != nil {
+      return nil, fmt.Errorf("Template %s: %v", f.Name(), err)
+    }
+    if err := r.Add(c, img); err != nil {
+      return nil, fmt.Errorf("Template %s: %v", f.Name(), err)
+    }
+  }
+  if len(r.Templates) == 0 {
+    return nil, fmt.Errorf("No templates found in %s", dir)
+  }
+  return r, nil
+}
+
+func templateChar(file string) (rune, error) {
+  name := strings.TrimSuffix(file, filepath.Ext(file))
+  if n := strings.Index(name, "_"); n > 0 {
+    name = name[:n]
+  }
+  if c, ok := templateAliases[name]; ok {
+    return c, nil
+  }
+  if utf8.RuneCountInString(name) != 1 {
+    return 0, fmt.Errorf("Template file name %s is not a single character or alias", file)
+  }
+  c, _ := utf8.DecodeRuneInString(name)
+  return c, nil
+}
+
+func templateName(c rune) string {
+  for name, a := range templateAliases {
+    if a == c {
+      return name
+    }
+  }
+  return string(c)
+}
+
+func loadPng(file string) (image.Image, error) {
+  f, err := os.Open(file)
+  if err != nil {
+    return nil, err
+  }
+  defer f.Close()
+  return png.Decode(f)
+}
+
+/* Add adds the glyph in img (one dark character on light background, as
+ * written by SaveTemplate) as template for character c.
+ */
+func (r *Recognizer) Add(c rune, img image.Image) error {
+  b := trim(binarize(img, false))
+  if b.W == 0 || b.H == 0 {
+    return fmt.Errorf("Template for %q is empty", c)
+  }
+  r.Templates = append(r.Templates, Template{ Char: c, Glyph: b })
+  return nil
+}
+
+/* SaveTemplate writes glyph as a black on white PNG template for c in dir,
+ * named so that it does not overwrite existing templates. Returns the file
+ * name.
+ */
+func SaveTemplate(dir string, c rune, glyph Bitmap) (string, error) {
+  if err := os.MkdirAll(dir, 0755); err != nil {
+    return "", err
+  }
+  name := templateName(c)
+  file := filepath.Join(dir, name + ".png")
+  for n := 2; ; n++ {
+    if _, err := os.Stat(file); os.IsNotExist(err) {
+      break
+    }
+    file = filepath.Join(dir, fmt.Sprintf("%s_%d.png", name, n))
+  }
+  img := image.NewGray(image.Rect(0, 0, glyph.W, glyph.H))
+  for y := 0; y < glyph.H; y++ {
+    for x := 0; x < glyph.W; x++ {
+      if glyph.at(x, y) {
+        img.SetGray(x, y, color.Gray{ 0 })
+      } else {
+        img.SetGray(x, y, color.Gray{ 255 })
+      }
+    }
+  }
+  f, err := os.Create(file)
+  if err != nil {
+    return "", err
+  }
+  if err := png.Encode(f, img); err != nil {
+    f.Close()
+    os.Remove(file)
+    return "", err
+  }
+  return file, f.Close()
+}
+
+/* Binarize converts img to a Bitmap using Otsu's threshold. The darker or
+ * brighter side, whichever covers the smaller area, is taken as ink so both
+ * dark on light and light on dark text work.
+ */
+func Binarize(img image.Image) Bitmap {
+  return binarize(img, true)
+}
+
+/* binarize uses Otsu's threshold, if detectInk is false dark is ink */
+func binarize(img image.Image, detectInk bool) Bitmap {
+  bounds := img.Bounds()
+  w, h := bounds.Dx(), bounds.Dy()
+  lum := make([]uint8, w * h)
+  var hist [256]int
+  for y := 0; y < h; y++ {
+    for x := 0; x < w; x++ {
+      g := color.GrayModel.Convert(img.At(bounds.Min.X + x, bounds.Min.Y + y)).(color.Gray)
+      lum[y * w + x] = g.Y
+      hist[g.Y]++
+    }
+  }
+  t := otsu(hist, w * h)
+  dark := 0
+  for _, l := range lum {
+    if l <= t {
+      dark++
+    }
+  }
+  inkIsDark := ! detectInk || dark * 2 <= len(lum)
+  b := Bitmap{ W: w, H: h, Bits: make([]bool, w * h) }
+  for n, l := range lum {
+    b.Bits[n] = (l <= t) == inkIsDark
+  }
+  return b
+}
+
+/* otsu returns the threshold maximizing the between class variance, pixels
+ * <= threshold are one class.
+ */
+func otsu(hist [256]int, total int) uint8 {
+  var sum float64
+  for i, n := range hist {
+    sum += float64(i * n)
+  }
+  var sumB, best float64
+  var wB int
+  threshold := uint8(127)
+  for i, n := range hist {
+    wB += n
+    if wB == 0 {
+      continue
+    }
+    wF := total - wB
+    if wF == 0 {
+      break
+    }
+    sumB += float64(i * n)
+    mB := sumB / float64(wB)
+    mF := (sum - sumB) / float64(wF)
+    between := float64(wB) * float64(wF) * (mB - mF) * (mB - mF)
+    if between > best {
+      best = between
+      threshold = uint8(i)
+    }
+  }
+  return threshold
+}
+
+// sub returns the part of b within r
+func (b Bitmap) sub(r image.Rectangle) Bitmap {
+  s := Bitmap{ W: r.Dx(), H: r.Dy(), Bits: make([]bool, r.Dx() * r.Dy()) }
+  for y := 0; y < s.H; y++ {
+    for x := 0; x < s.W; x++ {
+      s.Bits[y * s.W + x] = b.at(r.Min.X + x, r.Min.Y + y)
+    }
+  }
+  return s
+}
+
+// inkBounds returns the smallest rectangle containing all ink within r
+func (b Bitmap) inkBounds(r image.Rectangle) image.Rectangle {
+  box := image.Rectangle{}
+  for y := r.Min.Y; y < r.Max.Y; y++ {
+    for x := r.Min.X; x < r.Max.X; x++ {
+      if b.at(x, y) {
+        box = box.Union(image.Rect(x, y, x + 1, y + 1))
+      }
+    }
+  }
+  return box
+}
+
+func trim(b Bitmap) Bitmap {
+  return b.sub(b.inkBounds(image.Rect(0, 0, b.W, b.H)))
+}
+
+// Glyph is one character found by Segment(), Space is true if there is a
+// word gap before it.
+type Glyph struct {
+  Box image.Rectangle
+  Bitmap Bitmap
+  Space bool
+}
+
+/* Segment splits a line of text into glyphs at columns without ink. A gap
+ * wider than 3/4 of the median glyph height is a space, narrow glyphs (e.g
+ * . next to 1) of a fixed width font leave gaps over half the height.
+ */
+func Segment(b Bitmap) []Glyph {
+  var glyphs []Glyph
+  inGlyph := false
+  start := 0
+  flush := func(end int) {
+    box := b.inkBounds(image.Rect(start, 0, end, b.H))
+    if ! box.Empty() {
+      glyphs = append(glyphs, Glyph{ Box: box, Bitmap: b.sub(box) })
+    }
+  }
+  for x := 0; x < b.W; x++ {
+    ink := false
+    for y := 0; y < b.H; y++ {
+      if b.at(x, y) {
+        ink = true
+        break
+      }
+    }
+    if ink && ! inGlyph {
+      start = x
+      inGlyph = true
+    } else if ! ink && inGlyph {
+      flush(x)
+      inGlyph = false
+    }
+  }
+  if inGlyph {
+    flush(b.W)
+  }
+  if len(glyphs) < 2 {
+    return glyphs
+  }
+  heights := []int{}
+  for _, g := range glyphs {
+    heights = append(heights, g.Box.Dy())
+  }
+  sort.Ints(heights)
+  spaceGap := float64(heights[len(heights) / 2]) * 3 / 4
+  for n := 1; n < len(glyphs); n++ {
+    if float64(glyphs[n].Box.Min.X - glyphs[n - 1].Box.Max.X) > spaceGap {
+      glyphs[n].Space = true
+    }
+  }
+  return glyphs
+}
+
+/* score compares glyph g with template t, 1 is identical. The glyph is
+ * sampled at the size of the template and the fraction of agreeing pixels
+ * is weighted by how similar the sizes are.
+ */
+func score(g, t Bitmap) float64 {
+  agree := 0
+  for y := 0; y < t.H; y++ {
+    gy := y * g.H / t.H
+    for x := 0; x < t.W; x++ {
+      gx := x * g.W / t.W
+      if g.at(gx, gy) == t.at(x, y) {
+        agree++
+      }
+    }
+  }
+  size := math.Min(float64(g.W), float64(t.W)) / math.Max(float64(g.W), float64(t.W)) *
+          math.Min(float64(g.H), float64(t.H)) / math.Max(float64(g.H), float64(t.H))
+  return float64(agree) / float64(t.W * t.H) * math.Sqrt(size)
+}
+
+/* Match returns the best matching character of glyph and its score,
+ * r.Unknown if no template scores at least r.MinScore.
+ */
+func (r *Recognizer) Match(glyph Bitmap) (rune, float64) {
+  best := r.Unknown
+  bestScore := 0.0
+  for _, t := range r.Templates {
+    if s := score(glyph, t.Glyph); s > bestScore {
+      best, bestScore = t.Char, s
+    }
+  }
+  if bestScore < r.MinScore {
+    return r.Unknown, bestScore
+  }
+  return best, bestScore
+}
+
+/* Recognize reads a single line of text in img */
+func (r *Recognizer) Recognize(img image.Image) (Result, error) {
+  res := Result{}
+  if len(r.Templates) == 0 {
+    return res, fmt.Errorf("No templates")
+  }
+  var text strings.Builder
+  min := img.Bounds().Min
+  for _, g := range Segment(Binarize(img)) {
+    c, s := r.Match(g.Bitmap)
+    if g.Space {
+      text.WriteRune(' ')
+    }
+    text.WriteRune(c)
+    res.Chars = append(res.Chars, Match{ Char: c, Score: s, Box: g.Box.Add(min) })
+  }
+  res.Text = text.String()
+  return res, nil
+}
@@ -0,0 +1,190 @@
+package irocr
+
+import (
+  "image"
+  "image/color"
+  "io/ioutil"
+  "path/filepath"
+  "testing"
+)
+
+// testFont is a 5x7 bitmap font like the ones printed on ionograms
+var testFont = map[rune][7]string{
+  '0': { ".###.", "#...#", "#..##", "#.#.#", "##..#", "#...#", ".###." },
+  '1': { "..#..", ".##..", "..#..", "..#..", "..#..", "..#..", ".###." },
+  '2': { ".###.", "#...#", "....#", "...#.", "..#..", ".#...", "#####" },
+  '3': { "####.", "....#", "....#", ".###.", "....#", "....#", "####." },
+  '4': { "...#.", "..##.", ".#.#.", "#..#.", "#####", "...#.", "...#." },
+  '5': { "#####", "#....", "####.", "....#", "....#", "#...#", ".###." },
+  '6': { "..##.", ".#...", "#....", "####.", "#...#", "#...#", ".###." },
+  '7': { "#####", "....#", "...#.", "..#..", ".#...", ".#...", ".#..." },
+  '8': { ".###.", "#...#", "#...#", ".###.", "#...#", "#...#", ".###." },
+  '9': { ".###.", "#...#", "#...#", ".####", "....#", "...#.", ".##.." },
+  '.': { ".....", ".....", ".....", ".....", ".....", ".##..", ".##.." },
+  'F': { "#####", "#....", "#....", "####.", "#....", "#....", "#...." },
+}
+
+const testScale = 2
+
+/* render draws text in testFont scaled by testScale with one empty column
+ * between characters and a margin of 3 pixels, fg on bg.
+ */
+func render(text string, fg, bg color.Color) (*image.RGBA) {
+  img := image.NewRGBA(image.Rect(0, 0, len(text) * 6 * testScale + 6, 7 * testScale + 6))
+  for y := 0; y < img.Bounds().Dy(); y++ {
+    for x := 0; x < img.Bounds().Dx(); x++ {
+      img.Set(x, y, bg)
+    }
+  }
+  for n, c := range text {
+    for gy, row := range testFont[c] {
+      for gx, p := range row {
+        if p != '#' {
+          continue
+        }
+        for d := 0; d < testScale * testScale; d++ {
+          img.Set(3 + (n * 6 + gx) * testScale + d % testScale, 3 + gy * testScale + d / testScale, fg)
+        }
+      }
+    }
+  }
+  return img
+}
+
+// testRecognizer has a template of every character in testFont
+func testRecognizer(t *testing.T) (*Recognizer) {
+  r := New()
+  for c := range testFont {
+    if err := r.Add(c, render(string(c), color.Black, color.White)); err != nil {
+      t.Fatal(err)
+    }
+  }
+  return r
+}
+
+func TestSegment(t *testing.T) {
+  glyphs := Segment(Binarize(render("5.1 20", color.Black, color.White)))
+  if len(glyphs) != 5 {
+    t.Fatalf("Segment found %d glyphs, want 5", len(glyphs))
+  }
+  for n, space := range []bool{ false, false, false, true, false } {
+    if glyphs[n].Space != space {
+      t.Errorf("glyph %d Space is %t, want %t", n, glyphs[n].Space, space)
+    }
+  }
+  // the box is the ink only, 5 is 5 columns wide and . 2
+  if want := image.Rect(3, 3, 3 + 5 * testScale, 3 + 7 * testScale); glyphs[0].Box != want {
+    t.Errorf("box of 5 is %v, want %v", glyphs[0].Box, want)
+  }
+  if b := glyphs[1].Box; b.Dx() != 2 * testScale || b.Dy() != 2 * testScale {
+    t.Errorf("box of . is %v, want %dx%d", b, 2 * testScale, 2 * testScale)
+  }
+  if len(Segment(Binarize(render("", color.Black, color.White)))) != 0 {
+    t.Errorf("Segment of an empty image found glyphs")
+  }
+}
+
+func TestRecognize(t *testing.T) {
+  r := testRecognizer(t)
+  cases := []struct {
+    text string
+    fg, bg color.Color
+  }{
+    { "5.125", color.Black, color.White },
+    { "2021 0314", color.Black, color.White },
+    // light on dark and colored text
+    { "6.0 7.89", color.White, color.Black },
+    { "F2 3.45", color.RGBA{ 0, 0, 160, 255 }, color.RGBA{ 230, 230, 230, 255 } },
+  }
+  for _, c := range cases {
+    res, err := r.Recognize(render(c.text, c.fg, c.bg))
+    if err != nil {
+      t.Fatal(err)
+    }
+    if res.Text != c.text {
+      t.Errorf("Recognize(%q) = %q", c.text, res.Text)
+    }
+    if res.Confidence() < 0.99 {
+      t.Errorf("Recognize(%q) confidence %g, want 1", c.text, res.Confidence())
+    }
+  }
+
+  // without templates for the letters F is unknown
+  res, err := r.Only("0123456789.").Recognize(render("F2", color.Black, color.White))
+  if err != nil {
+    t.Fatal(err)
+  }
+  if res.Text != "?2" || res.Chars[0].Char != '?' || res.Confidence() >= DefaultMinScore {
+    t.Errorf("Recognize(F2) with digits only = %q confidence %g", res.Text, res.Confidence())
+  }
+  if res.Chars[1].Box.Min.X <= res.Chars[0].Box.Max.X {
+    t.Errorf("boxes %v and %v overlap", res.Chars[0].Box, res.Chars[1].Box)
+  }
+  if _, err := New().Recognize(render("1", color.Black, color.White)); err == nil {
+    t.Errorf("Recognize without templates did not fail")
+  }
+  if (Result{}).Confidence() != 0 {
+    t.Errorf("Confidence without characters is not 0")
+  }
+}
+
+func TestMatch(t *testing.T) {
+  r := testRecognizer(t)
+  glyph := trim(binarize(render("8", color.Black, color.White), false))
+  if c, s := r.Match(glyph); c != '8' || s != 1 {
+    t.Errorf("Match(8) = %q %g, want '8' 1", c, s)
+  }
+  // an 8 with a pixel flipped still matches, but not perfectly
+  glyph.Bits[0] = ! glyph.Bits[0]
+  if c, s := r.Match(glyph); c != '8' || s >= 1 || s < DefaultMinScore {
+    t.Errorf("Match of a damaged 8 = %q %g", c, s)
+  }
+}
+
+func TestSaveTemplateLoad(t *testing.T) {
+  dir := filepath.Join(t.TempDir(), "templates")
+  text := "0123456789.F"
+  glyphs := Segment(Binarize(render(text, color.Black, color.White)))
+  if len(glyphs) != len(text) {
+    t.Fatalf("Segment found %d glyphs, want %d", len(glyphs), len(text))
+  }
+  for n, c := range text {
+    if _, err := SaveTemplate(dir, c, glyphs[n].Bitmap); err != nil {
+      t.Fatal(err)
+    }
+  }
+  // a second template of a character does not overwrite the first
+  file, err := SaveTemplate(dir, '.', glyphs[10].Bitmap)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if filepath.Base(file) != "dot_2.png" {
+    t.Errorf("second template of . is %s, want dot_2.png", filepath.Base(file))
+  }
+
+  r, err := Load(dir)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(r.Templates) != len(text) + 1 {
+    t.Errorf("Load found %d templates, want %d", len(r.Templates), len(text) + 1)
+  }
+  res, err := r.Recognize(render("F2 5.125", color.Black, color.White))
+  if err != nil {
+    t.Fatal(err)
+  }
+  if res.Text != "F2 5.125" || res.Confidence() < 0.99 {
+    t.Errorf("Recognize with loaded templates = %q confidence %g", res.Text, res.Confidence())
+  }
+
+  // a file that is not named after a character
+  if err := ioutil.WriteFile(filepath.Join(dir, "ab.png"), nil, 0644); err != nil {
+    t.Fatal(err)
+  }
+  if _, err := Load(dir); err == nil {
+    t.Errorf("Load with ab.png did not fail")
+  }
+  if _, err := Load(t.TempDir()); err == nil {
+    t.Errorf("Load of an empty directory did not fail")
+  }
+}
@@ -0,0 +1,208 @@
+/* Package irpredict predicts ionospheric parameters (foF2, foE, fmin, etc) from
+ * the history stored in the parameters table. The prediction method is
+ * pluggable through the Predictor interface, use New() to get a Predictor by
+ * name.
+ */
+package irpredict
+
+import (
+  "fmt"
+  "sort"
+  "strings"
+  "time"
+)
+
+const (
+  MethodSameHourMean string = `samehourmean`
+  MethodSameHourTrend string = `samehourtrend`
+  MethodLinearTrend string = `lineartrend`
+)
+
+// Methods lists the names accepted by New()
+var Methods = []string{ MethodSameHourMean, MethodSameHourTrend, MethodLinearTrend }
+
+// Sample is one observed value (e.g foF2) at a given time
+type Sample struct {
+  Time time.Time
+  Value float64
+}
+
+// Predictor predicts the value at time at from a history of samples. ok is
+// false if there is not enough history to make a prediction.
+type Predictor interface {
+  Predict(history []Sample, at time.Time) (value float64, ok bool)
+  String() string
+}
+
+/* New returns a Predictor by method name using the last days of history */
+func New(method string, days int) (Predictor, error) {
+  if days < 1 {
+    return nil, fmt.Errorf("Number of days must be at least 1, got %d", days)
+  }
+  switch strings.ToLower(strings.TrimSpace(method)) {
+    case MethodSameHourMean:
+      return SameHourMean{ Days: days }, nil
+    case MethodSameHourTrend:
+      return SameHourTrend{ Days: days }, nil
+    case MethodLinearTrend:
+      return LinearTrend{ Days: days }, nil
+  }
+  return nil, fmt.Errorf("Unknown prediction method %s, valid methods are %s", method, strings.Join(Methods, ", "))
+}
+
+// Point is an x,y pair used by LinearRegression()
+type Point struct {
+  X float64
+  Y float64
+}
+
+/* LinearRegression fits y = m*x + b to series using least squares. ok is
+ * false if the series is too short or all x values are equal.
+ * Inspired by https://stackoverflow.com/a/16423799
+ */
+func LinearRegression(series []Point) (m, b float64, ok bool) {
+  q := len(series)
+  if q < 2 {
+    return 0, 0, false
+  }
+  p := float64(q)
+  sum_x, sum_y, sum_xx, sum_xy := 0.0, 0.0, 0.0, 0.0
+  for _, s := range series {
+    sum_x += s.X
+    sum_y += s.Y
+    sum_xx += s.X * s.X
+    sum_xy += s.X * s.Y
+  }
+  d := p*sum_xx - sum_x*sum_x
+  if d == 0 {
+    return 0, 0, false
+  }
+  m = (p*sum_xy - sum_x*sum_y) / d
+  b = (sum_y / p) - (m * sum_x / p)
+  return m, b, true
+}
+
+/* sameHourDailyMeans returns one point per day (x is days relative to at,
+ * e.g -1 for yesterday) with the mean of all samples within the same UTC hour
+ * as at. Only samples from the last days days before at are used.
+ */
+func sameHourDailyMeans(history []Sample, at time.Time, days int) ([]Point) {
+  at = at.UTC()
+  from := at.Add(-time.Duration(days) * 24 * time.Hour)
+  type acc struct {
+    sum float64
+    n int
+  }
+  byDay := map[int]*acc{}
+  for _, s := range history {
+    t := s.Time.UTC()
+    if t.Before(from) || ! t.Before(at) || t.Hour() != at.Hour() {
+      continue
+    }
+    // whole days between the sample and at (same hour, so truncating is fine)
+    d := -int(at.Truncate(time.Hour).Sub(t.Truncate(time.Hour)).Hours() / 24)
+    if byDay[d] == nil {
+      byDay[d] = &acc{}
+    }
+    byDay[d].sum += s.Value
+    byDay[d].n++
+  }
+  points := []Point{}
+  for d, a := range byDay {
+    points = append(points, Point{ X: float64(d), Y: a.sum / float64(a.n) })
+  }
+  sort.Slice(points, func(i, j int) bool { return points[i].X < points[j].X })
+  return points
+}
+
+func mean(points []Point) (float64) {
+  sum := 0.0
+  for _, p := range points {
+    sum += p.Y
+  }
+  return sum / float64(len(points))
+}
+
+func positive(v float64) (float64) {
+  if v < 0 {
+    return 0
+  }
+  return v
+}
+
+// SameHourMean predicts the mean of the values at the same UTC hour over
+// the last Days days.
+type SameHourMean struct {
+  Days int
+}
+
+func (s SameHourMean) Predict(history []Sample, at time.Time) (float64, bool) {
+  points := sameHourDailyMeans(history, at, s.Days)
+  if len(points) == 0 {
+    return 0, false
+  }
+  return mean(points), true
+}
+
+func (s SameHourMean) String() string {
+  return fmt.Sprintf("%s over %d days", MethodSameHourMean, s.Days)
+}
+
+// SameHourTrend fits a linear trend through the daily same-hour means over
+// the last Days days and extrapolates it to the day of the prediction. It
+// falls back to the same-hour mean with less than 3 days of history.
+type SameHourTrend struct {
+  Days int
+}
+
+func (s SameHourTrend) Predict(history []Sample, at time.Time) (float64, bool) {
+  points := sameHourDailyMeans(history, at, s.Days)
+  if len(points) == 0 {
+    return 0, false
+  }
+  if len(points) < 3 {
+    return mean(points), true
+  }
+  // at is day 0, so the intercept is the prediction
+  _, b, ok := LinearRegression(points)
+  if ! ok {
+    return mean(points), true
+  }
+  return positive(b), true
+}
+
+func (s SameHourTrend) String() string {
+  return fmt.Sprintf("%s over %d days", MethodSameHourTrend, s.Days)
+}
+
+// LinearTrend fits a linear trend through all samples of the last Days
+// days regardless of hour and extrapolates it to at. Mostly useful for
+// short horizons as it does not follow the diurnal variation.
+type LinearTrend struct {
+  Days int
+}
+
+func (l LinearTrend) Predict(history []Sample, at time.Time) (float64, bool) {
+  from := at.Add(-time.Duration(l.Days) * 24 * time.Hour)
+  points := []Point{}
+  for _, s := range history {
+    if s.Time.Before(from) || ! s.Time.Before(at) {
+      continue
+    }
+    // x is hours relative to at
+    points = append(points, Point{ X: s.Time.Sub(at).Hours(), Y: s.Value })
+  }
+  // at is x=0, so the intercept is the prediction
+  _, b, ok := LinearRegression(points)
+  if ! ok {
+    if len(points) > 0 {
+      return mean(points), true
+    }
+    return 0, false
+  }
+  return positive(b), true
+}
+
+func (l LinearTrend) String() string {
+  return fmt.Sprintf("%s over %d days", MethodLinearTrend, l.Days)
+}
@@ -0,0 +1,113 @@
+package irpredict
+
+import (
+  "math"
+  "testing"
+  "time"
+)
+
+var at = time.Date(2021, time.March, 10, 12, 0, 0, 0, time.UTC)
+
+/* sameHourSeries returns one sample per day at the hour of at for the days
+ * before it, value(d) with d -1 for yesterday, -2 the day before, etc, and
+ * a sample at another hour that must be ignored by the same-hour methods.
+ */
+func sameHourSeries(days int, value func(d int) float64) ([]Sample) {
+  var history []Sample
+  for d := -days; d < 0; d++ {
+    t := at.AddDate(0, 0, d)
+    history = append(history, Sample{ Time: t.Add(10 * time.Minute), Value: value(d) })
+    history = append(history, Sample{ Time: t.Add(-3 * time.Hour), Value: 100 })
+  }
+  return history
+}
+
+func near(a, b float64) (bool) {
+  return math.Abs(a - b) < 1e-9
+}
+
+func TestNew(t *testing.T) {
+  for _, method := range Methods {
+    if _, err := New(method, 7); err != nil {
+      t.Errorf("New(%q, 7): %v", method, err)
+    }
+  }
+  if _, err := New("bogus", 7); err == nil {
+    t.Errorf("New(bogus) did not fail")
+  }
+  if _, err := New(MethodSameHourMean, 0); err == nil {
+    t.Errorf("New with 0 days did not fail")
+  }
+}
+
+func TestSameHourMean(t *testing.T) {
+  history := sameHourSeries(5, func(d int) float64 { return float64(5 + d) })
+  // days -5..-1 give 0, 1, 2, 3, 4
+  if v, ok := (SameHourMean{ Days: 7 }).Predict(history, at); ! ok || ! near(v, 2) {
+    t.Errorf("Predict = %g, %t, want 2, true", v, ok)
+  }
+  // only the last 2 days, 3 and 4
+  if v, ok := (SameHourMean{ Days: 2 }).Predict(history, at); ! ok || ! near(v, 3.5) {
+    t.Errorf("Predict over 2 days = %g, %t, want 3.5, true", v, ok)
+  }
+  if _, ok := (SameHourMean{ Days: 7 }).Predict(nil, at); ok {
+    t.Errorf("Predict without history is ok")
+  }
+}
+
+func TestSameHourTrend(t *testing.T) {
+  // 6 + 0.5 per day, today is 6
+  history := sameHourSeries(5, func(d int) float64 { return 6 + 0.5 * float64(d) })
+  if v, ok := (SameHourTrend{ Days: 7 }).Predict(history, at); ! ok || ! near(v, 6) {
+    t.Errorf("Predict = %g, %t, want 6, true", v, ok)
+  }
+  // less than 3 days falls back to the mean of 5.0 and 5.5
+  short := sameHourSeries(2, func(d int) float64 { return 6 + 0.5 * float64(d) })
+  if v, ok := (SameHourTrend{ Days: 7 }).Predict(short, at); ! ok || ! near(v, 5.25) {
+    t.Errorf("Predict with 2 days = %g, %t, want 5.25, true", v, ok)
+  }
+  // a falling trend is not extrapolated below 0
+  falling := sameHourSeries(5, func(d int) float64 { return -2 * float64(d) - 1 })
+  if v, ok := (SameHourTrend{ Days: 7 }).Predict(falling, at); ! ok || v != 0 {
+    t.Errorf("Predict of falling trend = %g, %t, want 0, true", v, ok)
+  }
+  if _, ok := (SameHourTrend{ Days: 7 }).Predict([]Sample{}, at); ok {
+    t.Errorf("Predict without history is ok")
+  }
+}
+
+func TestLinearTrend(t *testing.T) {
+  // 3 + 0.1 per hour over the last 12 hours, at is 3
+  var history []Sample
+  for h := -12; h < 0; h++ {
+    history = append(history, Sample{ Time: at.Add(time.Duration(h) * time.Hour), Value: 3 + 0.1 * float64(h) })
+  }
+  // a sample at or after at is not history
+  history = append(history, Sample{ Time: at, Value: 100 })
+  if v, ok := (LinearTrend{ Days: 1 }).Predict(history, at); ! ok || ! near(v, 3) {
+    t.Errorf("Predict = %g, %t, want 3, true", v, ok)
+  }
+  // a single sample can not be fitted, its value is used
+  single := []Sample{ { Time: at.Add(-time.Hour), Value: 4.2 } }
+  if v, ok := (LinearTrend{ Days: 1 }).Predict(single, at); ! ok || ! near(v, 4.2) {
+    t.Errorf("Predict with one sample = %g, %t, want 4.2, true", v, ok)
+  }
+  // samples older than Days are ignored
+  old := []Sample{ { Time: at.AddDate(0, 0, -3), Value: 4.2 } }
+  if _, ok := (LinearTrend{ Days: 1 }).Predict(old, at); ok {
+    t.Errorf("Predict with only old history is ok")
+  }
+  if _, ok := (LinearTrend{ Days: 1 }).Predict(nil, at); ok {
+    t.Errorf("Predict without history is ok")
+  }
+}
+
+func TestLinearRegression(t *testing.T) {
+  m, b, ok := LinearRegression([]Point{ { 0, 1 }, { 1, 3 }, { 2, 5 } })
+  if ! ok || ! near(m, 2) || ! near(b, 1) {
+    t.Errorf("LinearRegression = %g, %g, %t, want 2, 1, true", m, b, ok)
+  }
+  if _, _, ok := LinearRegression([]Point{ { 1, 1 }, { 1, 2 } }); ok {
+    t.Errorf("LinearRegression with equal x is ok")
+  }
+}
@@ -0,0 +1,268 @@
+/* Package irsao parses the scaled ionospheric characteristics (foF2, foE,
+ * hmF2, ...) autoscaled by Digisonde ionosondes and published as SAO 4.x
+ * (the fixed width Standard Archiving Output format) or SAO-XML files, e.g
+ * by DIDBase at lgdc.uml.edu. The values are exact, unlike the ones read
+ * from the ionogram image by OCR.
+ */
+package irsao
+
+import (
+  "bytes"
+  "encoding/xml"
+  "fmt"
+  "io"
+  "math"
+  "strconv"
+  "strings"
+  "time"
+)
+
+const (
+  FormatSAO string = `sao`
+  FormatSAOXML string = `saoxml`
+)
+
+// Formats lists the names accepted by Parse()
+var Formats = []string{ FormatSAO, FormatSAOXML }
+
+// Names of the characteristics in Record.Values
+const (
+  FoF2 string = "foF2"
+  FoF1 string = "foF1"
+  FoE string = "foE"
+  FxI string = "fxI"
+  FoEs string = "foEs"
+  Fmin string = "fmin"
+  HmF2 string = "hmF2"
+  HmE string = "hmE"
+  HF string = "hF"      // h'F
+)
+
+// Record is the scaled characteristics of one ionogram
+type Record struct {
+  Time time.Time
+  Station string              // URSI code, empty if not in the record
+  Values map[string]float64   // by name (see above), missing values are left out
+}
+
+/* saoIndexes maps the (1-based) position in group 4 of a SAO 4.x record to
+ * the name of the characteristic, zmF2 and zmE are the peak heights and h'F
+ * the lowest virtual height of the F trace.
+ */
+var saoIndexes = map[int]string{
+  1: FoF2,
+  2: FoF1,
+  5: Fmin,
+  6: FoEs,
+  9: FoE,
+  10: FxI,
+  11: HF,
+  15: HmE,
+  32: HmF2,
+}
+
+/* xmlNames maps names and URSI codes of characteristics in SAO-XML to the
+ * names in Record.Values (lower case).
+ */
+var xmlNames = map[string]string{
+  "fof2": FoF2, "00": FoF2,
+  "fof1": FoF1, "10": FoF1,
+  "foe": FoE, "20": FoE,
+  "foes": FoEs, "30": FoEs,
+  "fmin": Fmin, "42": Fmin,
+  "fxi": FxI, "51": FxI,
+  "hmf2": HmF2, "zmf2": HmF2,
+  "hme": HmE, "zme": HmE,
+  "hf": HF, "h'f": HF, "16": HF,
+}
+
+// missing is the lowest value meaning no value in SAO files
+const missing float64 = 9999.0
+
+/* Parse parses data in format (see Formats) into records */
+func Parse(format string, data []byte) ([]Record, error) {
+  switch strings.ToLower(strings.TrimSpace(format)) {
+    case FormatSAO:
+      return ParseSAO(data)
+    case FormatSAOXML:
+      return ParseSAOXML(data)
+  }
+  return nil, fmt.Errorf("Unknown format %s, valid formats are %s", format, strings.Join(Formats, ", "))
+}
+
+/* ParseSAO parses a SAO 4.x file. A record starts with the data file index
+ * (80 counts in two lines of 40I3) followed by the groups it counts. Only
+ * group 3 (the time stamp) and group 4 (the scaled characteristics, 15F8.3)
+ * are used and only the first record is read, DIDBase serves one record per
+ * ionogram.
+ */
+func ParseSAO(data []byte) ([]Record, error) {
+  lines := strings.Split(strings.ReplaceAll(string(data), "\r", ""), "\n")
+  if len(lines) < 2 {
+    return nil, fmt.Errorf("Not a SAO file, data file index is missing")
+  }
+  var counts []int
+  for _, line := range lines[:2] {
+    for n := 0; n < 40; n++ {
+      field := strings.TrimSpace(column(line, n * 3, 3))
+      if field == "" {
+        counts = append(counts, 0)
+        continue
+      }
+      c, err := strconv.Atoi(field)
+      if err != nil || c < 0 {
+        return nil, fmt.Errorf("Not a SAO file, invalid data file index %q", field)
+      }
+      counts = append(counts, c)
+    }
+  }
+  if counts[2] == 0 || counts[3] == 0 {
+    return nil, fmt.Errorf("SAO record has no time stamp or no scaled characteristics")
+  }
+
+  // groups 1 to 4 and the number of entries per line
+  perLine := []int{ 16, 120, 120, 15 }
+  groups := make([][]string, 4)
+  l := 2
+  for g := range groups {
+    n := (counts[g] + perLine[g] - 1) / perLine[g]
+    if l + n > len(lines) {
+      return nil, fmt.Errorf("SAO record is truncated in group %d", g + 1)
+    }
+    groups[g] = lines[l:l + n]
+    l += n
+  }
+
+  r := Record{ Values: map[string]float64{} }
+  var err error
+  r.Time, err = saoTime(strings.Join(groups[2], ""))
+  if err != nil {
+    return nil, err
+  }
+  for n := 0; n < counts[3]; n++ {
+    name, ok := saoIndexes[n + 1]
+    if ! ok {
+      continue
+    }
+    field := strings.TrimSpace(column(groups[3][n / 15], (n % 15) * 8, 8))
+    if field == "" {
+      continue
+    }
+    f, err := strconv.ParseFloat(field, 64)
+    if err != nil {
+      return nil, fmt.Errorf("SAO characteristic %s is not a number: %q", name, field)
+    }
+    if f < missing {
+      r.Values[name] = f
+    }
+  }
+  return []Record{ r }, nil
+}
+
+/* column returns width characters of line from start, fewer if the line is
+ * shorter (trailing blanks are often stripped).
+ */
+func column(line string, start, width int) (string) {
+  if start >= len(line) {
+    return ""
+  }
+  if start + width > len(line) {
+    return line[start:]
+  }
+  return line[start:start + width]
+}
+
+/* saoTime finds the time stamp in group 3 of a SAO record, written as
+ * YYYYDDDMMDDHHMMSS (year, day of year, month, day, hour, minute, second)
+ * after the version and station fields. The day of year must agree with
+ * month and day.
+ */
+func saoTime(group string) (time.Time, error) {
+  for start := 0; start + 17 <= len(group); start++ {
+    s := group[start:start + 17]
+    if strings.Trim(s, "0123456789") != "" {
+      continue
+    }
+    atoi := func(from, to int) int {
+      n, _ := strconv.Atoi(s[from:to])
+      return n
+    }
+    year, doy, month, day := atoi(0, 4), atoi(4, 7), atoi(7, 9), atoi(9, 11)
+    hour, minute, second := atoi(11, 13), atoi(13, 15), atoi(15, 17)
+    if month < 1 || month > 12 || day < 1 || day > 31 || hour > 23 || minute > 59 || second > 59 {
+      continue
+    }
+    t := time.Date(year, time.Month(month), day, hour, minute, second, 0, time.UTC)
+    if t.Day() == day && t.YearDay() == doy {
+      return t, nil
+    }
+  }
+  return time.Time{}, fmt.Errorf("No time stamp found in SAO record")
+}
+
+/* ParseSAOXML parses a SAO-XML file, i.e SAORecord elements with the time in
+ * the StartTimeUTC attribute and the characteristics as URSI elements (Name,
+ * ID and Val attributes). Other elements are ignored.
+ */
+func ParseSAOXML(data []byte) ([]Record, error) {
+  var records []Record
+  var r *Record
+  d := xml.NewDecoder(bytes.NewReader(data))
+  for {
+    tok, err := d.Token()
+    if err == io.EOF {
+      break
+    }
+    if err != nil {
+      return nil, fmt.Errorf("Invalid SAO-XML: %v", err)
+    }
+    switch t := tok.(type) {
+      case xml.StartElement:
+        switch t.Name.Local {
+          case "SAORecord":
+            attrs := xmlAttrs(t)
+            dt, err := time.Parse(time.RFC3339, attrs["starttimeutc"])
+            if err != nil {
+              return nil, fmt.Errorf("SAORecord has no valid StartTimeUTC: %v", err)
+            }
+            records = append(records, Record{ Time: dt.UTC(), Station: attrs["ursicode"], Values: map[string]float64{} })
+            r = &records[len(records) - 1]
+          case "URSI":
+            if r == nil {
+              continue
+            }
+            attrs := xmlAttrs(t)
+            name, ok := xmlNames[strings.ToLower(attrs["name"])]
+            if ! ok {
+              name, ok = xmlNames[attrs["id"]]
+            }
+            val := strings.TrimSpace(attrs["val"])
+            if ! ok || val == "" {
+              continue
+            }
+            f, err := strconv.ParseFloat(val, 64)
+            if err != nil || math.IsNaN(f) || f >= missing {
+              continue
+            }
+            r.Values[name] = f
+        }
+      case xml.EndElement:
+        if t.Name.Local == "SAORecord" {
+          r = nil
+        }
+    }
+  }
+  if len(records) == 0 {
+    return nil, fmt.Errorf("No SAORecord found in SAO-XML")
+  }
+  return records, nil
+}
+
+// xmlAttrs returns the attributes of e by lower case name
+func xmlAttrs(e xml.StartElement) (map[string]string) {
+  attrs := map[string]string{}
+  for _, a := range e.Attr {
+    attrs[strings.ToLower(a.Name.Local)] = a.Value
+  }
+  return attrs
+}
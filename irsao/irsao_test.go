@@ -0,0 +1,156 @@
+package irsao
+
+import (
+  "io/ioutil"
+  "path/filepath"
+  "strings"
+  "testing"
+  "time"
+)
+
+func checkRecord(t *testing.T, name string, r Record, when time.Time, station string, values map[string]float64) {
+  if ! r.Time.Equal(when) || r.Time.Location() != time.UTC {
+    t.Errorf("%s: time %s, want %s", name, r.Time, when)
+  }
+  if r.Station != station {
+    t.Errorf("%s: station %q, want %q", name, r.Station, station)
+  }
+  if len(r.Values) != len(values) {
+    t.Errorf("%s: %d values %v, want %v", name, len(r.Values), r.Values, values)
+  }
+  for n, v := range values {
+    if got, ok := r.Values[n]; ! ok || got != v {
+      t.Errorf("%s: %s = %g (%t), want %g", name, n, got, ok, v)
+    }
+  }
+}
+
+func TestParseFixtures(t *testing.T) {
+  cases := []struct {
+    file string
+    format string
+    records []Record
+  }{
+    // every characteristic of group 4 that is used, foF1 is 9999 (missing)
+    { "JR055.SAO", FormatSAO, []Record{
+      { time.Date(2021, time.March, 20, 11, 1, 15, 0, time.UTC), "", map[string]float64{
+        FoF2: 6.125, Fmin: 1.45, FoEs: 3.2, FoE: 2.65, FxI: 6.9, HF: 215, HmE: 110, HmF2: 262.4,
+      } },
+    } },
+    // foF2 9999, foEs blank and only 30 characteristics, i.e no zmF2
+    { "JR055-missing.SAO", FormatSAO, []Record{
+      { time.Date(2021, time.March, 20, 11, 16, 15, 0, time.UTC), "", map[string]float64{
+        Fmin: 1.45, FoE: 2.65, FxI: 6.9, HF: 215, HmE: 110,
+      } },
+    } },
+    // h`F by ID, MD and a Custom element ignored, the second record has an
+    // empty foF2, NaN fmin, 9999 fxI and a time with an offset
+    { "JR055.XML", FormatSAOXML, []Record{
+      { time.Date(2021, time.March, 20, 11, 1, 15, 0, time.UTC), "JR055", map[string]float64{
+        FoF2: 6.125, FoE: 2.65, FoEs: 3.2, Fmin: 1.45, FxI: 6.9, HF: 215, HmF2: 262.4, HmE: 110,
+      } },
+      { time.Date(2021, time.March, 20, 11, 16, 15, 0, time.UTC), "JR055", map[string]float64{
+        FoE: 2.7,
+      } },
+    } },
+  }
+  for _, c := range cases {
+    data, err := ioutil.ReadFile(filepath.Join("testdata", c.file))
+    if err != nil {
+      t.Fatal(err)
+    }
+    records, err := Parse(c.format, data)
+    if err != nil {
+      t.Errorf("%s: %v", c.file, err)
+      continue
+    }
+    if len(records) != len(c.records) {
+      t.Errorf("%s: %d records, want %d", c.file, len(records), len(c.records))
+      continue
+    }
+    for n, want := range c.records {
+      checkRecord(t, c.file, records[n], want.Time, want.Station, want.Values)
+    }
+  }
+}
+
+func TestSaoIndexes(t *testing.T) {
+  // group 4 positions of SAO 4.x
+  for position, name := range map[int]string{
+    1: FoF2, 2: FoF1, 5: Fmin, 6: FoEs, 9: FoE, 10: FxI, 11: HF, 15: HmE, 32: HmF2,
+  } {
+    if saoIndexes[position] != name {
+      t.Errorf("position %d is %q, want %s", position, saoIndexes[position], name)
+    }
+  }
+  if len(saoIndexes) != 9 {
+    t.Errorf("%d positions are used, want 9", len(saoIndexes))
+  }
+}
+
+func TestSaoTime(t *testing.T) {
+  cases := []struct {
+    group string
+    want time.Time
+  }{
+    { "FF05520210790320110115000400600", time.Date(2021, time.March, 20, 11, 1, 15, 0, time.UTC) },
+    // 20201011... is 2020 day 101 Oct 11 but day 101 is Apr 10, the
+    // time stamp starts after it
+    { "FF20201011020210790320110115", time.Date(2021, time.March, 20, 11, 1, 15, 0, time.UTC) },
+    { "FE 2020366123123595900", time.Date(2020, time.December, 31, 23, 59, 59, 0, time.UTC) },
+    { "FE 2021001010100000000", time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC) },
+  }
+  for _, c := range cases {
+    got, err := saoTime(c.group)
+    if err != nil {
+      t.Errorf("saoTime(%q): %v", c.group, err)
+      continue
+    }
+    if ! got.Equal(c.want) {
+      t.Errorf("saoTime(%q) = %s, want %s", c.group, got, c.want)
+    }
+  }
+  for _, group := range []string{
+    "",
+    "FF055",
+    "2021080032011011500",    // day 80 is Mar 21
+    "2021059022911011500",    // Feb 29 2021
+    "2021079032024011500",    // hour 24
+    "20210790320 1101150",
+  } {
+    if got, err := saoTime(group); err == nil {
+      t.Errorf("saoTime(%q) = %s, want an error", group, got)
+    }
+  }
+}
+
+func TestParseErrors(t *testing.T) {
+  sao, err := ioutil.ReadFile(filepath.Join("testdata", "JR055.SAO"))
+  if err != nil {
+    t.Fatal(err)
+  }
+  lines := strings.SplitAfter(string(sao), "\n")
+  cases := []struct {
+    format string
+    data string
+  }{
+    { "csv", string(sao) },
+    { FormatSAO, "" },
+    { FormatSAO, "<SAORecordList/>\n\n" },
+    // the last two lines of group 4 are missing
+    { FormatSAO, strings.Join(lines[:len(lines) - 3], "") },
+    // no time stamp in group 3
+    { FormatSAO, strings.Join(lines[:4], "") + strings.Repeat(" ", 120) + "\n" + strings.Join(lines[5:], "") },
+    // foF2 is not a number
+    { FormatSAO, strings.Join(lines[:5], "") + "   6.1x5" + lines[5][8:] + strings.Join(lines[6:], "") },
+    { FormatSAOXML, "" },
+    { FormatSAOXML, "<SAORecordList></SAORecordList>" },
+    { FormatSAOXML, `<SAORecord StartTimeUTC="2021-03-20 11:01"></SAORecord>` },
+    { FormatSAOXML, `<SAORecord StartTimeUTC="2021-03-20T11:01:15Z">` },
+  }
+  for _, c := range cases {
+    if records, err := Parse(c.format, []byte(c.data)); err == nil {
+      t.Errorf("Parse(%s, %.40q) = %v, want an error", c.format, c.data, records)
+    }
+  }
+}
@@ -0,0 +1,283 @@
+/* Package irtrace digitizes the echo traces plotted in an ionogram to
+ * estimate foF2, foE, fmin and h'F when the values are not printed (or can
+ * not be read). The plot area of the ionogram is calibrated with two known
+ * points on each axis, e.g "100=1,580=10,log" for a logarithmic frequency
+ * axis where pixel x 100 is 1 MHz and pixel x 580 is 10 MHz, and echoes are
+ * found by the color of the ordinary (O) and extraordinary (X) traces.
+ *
+ * For every pixel column of the plot area the lowest virtual height of the
+ * O trace is taken, columns without neighbouring echoes are discarded as
+ * noise. Echoes below 160 km are E layer and above F layer:
+ *
+ * fmin  lowest frequency with an O or X echo
+ * foE   highest frequency of the E trace (below where the F trace starts)
+ * h'F   lowest virtual height of the F trace
+ * foF2  highest frequency of the F trace
+ */
+package irtrace
+
+import (
+  "fmt"
+  "image"
+  "image/color"
+  "math"
+  "sort"
+  "strconv"
+  "strings"
+)
+
+// Names of the values in Result.Values
+const (
+  FoF2 string = "foF2"
+  FoE string = "foE"
+  Fmin string = "fmin"
+  HF string = "hF"
+)
+
+const (
+  // heights (km) of the E layer, above is F layer
+  eLayerMin float64 = 80.0
+  eLayerMax float64 = 160.0
+  // foE is at most this far (MHz) above where the F trace starts
+  foEMargin float64 = 0.3
+  // neighbours is how many columns on each side are looked at for noise
+  neighbours int = 2
+  // minNeighbours is how many of them must have echoes too
+  minNeighbours int = 2
+)
+
+// DefaultColors are the trace colors of Digisonde ionograms
+var DefaultColors = Colors{
+  O: color.RGBA{ 255, 0, 0, 255 },
+  X: color.RGBA{ 0, 255, 0, 255 },
+  Tolerance: 80,
+}
+
+// Axis maps pixel coordinates to values (MHz or km)
+type Axis struct {
+  P1, V1 float64
+  P2, V2 float64
+  Log bool
+}
+
+// Colors are the colors of the traces, Tolerance is the RGB distance accepted
+type Colors struct {
+  O, X color.RGBA
+  Tolerance float64
+}
+
+// Calibration is the plot area of an ionogram and its axes
+type Calibration struct {
+  Area image.Rectangle
+  Freq Axis
+  Height Axis
+  Colors Colors
+}
+
+// Point is a digitized echo
+type Point struct {
+  Pixel image.Point
+  Freq float64
+  Height float64
+}
+
+// Result is the values found, missing ones are left out, and the O trace
+type Result struct {
+  Values map[string]float64
+  Trace []Point
+}
+
+/* ParseAxis parses "p1=v1,p2=v2" with an optional ",log" for a logarithmic
+ * axis, p are pixel coordinates (x for frequency, y for height).
+ */
+func ParseAxis(s string) (Axis, error) {
+  a := Axis{}
+  var points [][2]float64
+  for _, part := range strings.Split(s, ",") {
+    part = strings.TrimSpace(part)
+    if strings.EqualFold(part, "log") {
+      a.Log = true
+      continue
+    }
+    kv := strings.SplitN(part, "=", 2)
+    if len(kv) != 2 {
+      return a, fmt.Errorf("Axis point %q is not pixel=value", part)
+    }
+    p, err := strconv.ParseFloat(strings.TrimSpace(kv[0]), 64)
+    if err != nil {
+      return a, fmt.Errorf("Axis pixel %q is not a number", kv[0])
+    }
+    v, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+    if err != nil {
+      return a, fmt.Errorf("Axis value %q is not a number", kv[1])
+    }
+    points = append(points, [2]float64{ p, v })
+  }
+  if len(points) != 2 {
+    return a, fmt.Errorf("Axis %q must have exactly two points, e.g 100=1,580=10", s)
+  }
+  a.P1, a.V1, a.P2, a.V2 = points[0][0], points[0][1], points[1][0], points[1][1]
+  if a.P1 == a.P2 || a.V1 == a.V2 {
+    return a, fmt.Errorf("Axis %q points must differ in pixel and value", s)
+  }
+  if a.Log && (a.V1 <= 0 || a.V2 <= 0) {
+    return a, fmt.Errorf("Logarithmic axis %q must have positive values", s)
+  }
+  return a, nil
+}
+
+/* Value returns the value at pixel coordinate p */
+func (a Axis) Value(p float64) (float64) {
+  t := (p - a.P1) / (a.P2 - a.P1)
+  if a.Log {
+    return math.Exp(math.Log(a.V1) + t * (math.Log(a.V2) - math.Log(a.V1)))
+  }
+  return a.V1 + t * (a.V2 - a.V1)
+}
+
+/* ParseColors parses "o=#ff0000,x=#00ff00,tolerance=80", every part is
+ * optional and defaults to DefaultColors.
+ */
+func ParseColors(s string) (Colors, error) {
+  c := DefaultColors
+  for _, part := range strings.Split(s, ",") {
+    part = strings.TrimSpace(part)
+    if part == "" {
+      continue
+    }
+    kv := strings.SplitN(part, "=", 2)
+    if len(kv) != 2 {
+      return c, fmt.Errorf("Trace color %q is not name=value", part)
+    }
+    value := strings.TrimSpace(kv[1])
+    var err error
+    switch strings.ToLower(strings.TrimSpace(kv[0])) {
+      case "o":
+        c.O, err = parseHexColor(value)
+      case "x":
+        c.X, err = parseHexColor(value)
+      case "tolerance":
+        c.Tolerance, err = strconv.ParseFloat(value, 64)
+        if err == nil && c.Tolerance < 0 {
+          err = fmt.Errorf("Tolerance %g can not be negative", c.Tolerance)
+        }
+      default:
+        err = fmt.Errorf("Unknown trace color %s, expected o, x or tolerance", kv[0])
+    }
+    if err != nil {
+      return c, err
+    }
+  }
+  return c, nil
+}
+
+func parseHexColor(s string) (color.RGBA, error) {
+  h := strings.TrimPrefix(s, "#")
+  if len(h) != 6 {
+    return color.RGBA{}, fmt.Errorf("Color %s is not #rrggbb", s)
+  }
+  n, err := strconv.ParseUint(h, 16, 32)
+  if err != nil {
+    return color.RGBA{}, fmt.Errorf("Color %s is not #rrggbb", s)
+  }
+  return color.RGBA{ uint8(n >> 16), uint8(n >> 8), uint8(n), 255 }, nil
+}
+
+// near returns true if c is within tolerance of want
+func near(c color.Color, want color.RGBA, tolerance float64) (bool) {
+  r, g, b, _ := c.RGBA()
+  dr := float64(r >> 8) - float64(want.R)
+  dg := float64(g >> 8) - float64(want.G)
+  db := float64(b >> 8) - float64(want.B)
+  return math.Sqrt(dr * dr + dg * dg + db * db) <= tolerance
+}
+
+/* denoise returns the columns of echo that have at least minNeighbours
+ * neighbouring columns with echoes too.
+ */
+func denoise(echo map[int]bool) (map[int]bool) {
+  kept := map[int]bool{}
+  for x := range echo {
+    n := 0
+    for dx := -neighbours; dx <= neighbours; dx++ {
+      if dx != 0 && echo[x + dx] {
+        n++
+      }
+    }
+    if n >= minNeighbours {
+      kept[x] = true
+    }
+  }
+  return kept
+}
+
+/* Digitize finds the traces in the plot area of img and estimates foF2,
+ * foE, fmin and h'F from them.
+ */
+func Digitize(img image.Image, c Calibration) (Result) {
+  res := Result{ Values: map[string]float64{} }
+  area := c.Area.Intersect(img.Bounds())
+  lowest := map[int]Point{}  // lowest O echo by column
+  oEcho, anyEcho := map[int]bool{}, map[int]bool{}
+  for x := area.Min.X; x < area.Max.X; x++ {
+    for y := area.Min.Y; y < area.Max.Y; y++ {
+      px := img.At(x, y)
+      o := near(px, c.Colors.O, c.Colors.Tolerance)
+      if ! o && ! near(px, c.Colors.X, c.Colors.Tolerance) {
+        continue
+      }
+      h := c.Height.Value(float64(y))
+      if h < eLayerMin {
+        continue
+      }
+      anyEcho[x] = true
+      if ! o {
+        continue
+      }
+      oEcho[x] = true
+      if p, ok := lowest[x]; ! ok || h < p.Height {
+        lowest[x] = Point{ image.Point{ x, y }, c.Freq.Value(float64(x)), h }
+      }
+    }
+  }
+
+  for x := range denoise(anyEcho) {
+    f := c.Freq.Value(float64(x))
+    if v, ok := res.Values[Fmin]; ! ok || f < v {
+      res.Values[Fmin] = f
+    }
+  }
+
+  var e, f []Point
+  for x := range denoise(oEcho) {
+    p := lowest[x]
+    res.Trace = append(res.Trace, p)
+    if p.Height < eLayerMax {
+      e = append(e, p)
+    } else {
+      f = append(f, p)
+    }
+  }
+  sort.Slice(res.Trace, func(a, b int) bool {
+    return res.Trace[a].Pixel.X < res.Trace[b].Pixel.X
+  })
+  fStart := math.Inf(1)
+  for _, p := range f {
+    fStart = math.Min(fStart, p.Freq)
+    if v, ok := res.Values[FoF2]; ! ok || p.Freq > v {
+      res.Values[FoF2] = p.Freq
+    }
+    if v, ok := res.Values[HF]; ! ok || p.Height < v {
+      res.Values[HF] = p.Height
+    }
+  }
+  for _, p := range e {
+    if p.Freq > fStart + foEMargin {
+      continue  // sporadic E above the start of the F trace
+    }
+    if v, ok := res.Values[FoE]; ! ok || p.Freq > v {
+      res.Values[FoE] = p.Freq
+    }
+  }
+  return res
+}
@@ -0,0 +1,186 @@
+package irtrace
+
+import (
+  "image"
+  "image/color"
+  "math"
+  "testing"
+)
+
+const (
+  // the plot area is x 50 to 590 (1 to 10 MHz), y 380 to 20 (0 to 720 km)
+  freqAxis string = "50=1,590=10"
+  heightAxis string = "380=0,20=720"
+  freqStep float64 = 9.0 / 540
+  heightStep float64 = 720.0 / 360
+)
+
+var (
+  oColor = color.RGBA{ 240, 20, 20, 255 }   // within the tolerance of red
+  xColor = color.RGBA{ 0, 255, 0, 255 }
+)
+
+func testCalibration(t *testing.T) (Calibration) {
+  freq, err := ParseAxis(freqAxis)
+  if err != nil {
+    t.Fatal(err)
+  }
+  height, err := ParseAxis(heightAxis)
+  if err != nil {
+    t.Fatal(err)
+  }
+  colors, err := ParseColors("")
+  if err != nil {
+    t.Fatal(err)
+  }
+  return Calibration{ Area: image.Rect(50, 20, 590, 380), Freq: freq, Height: height, Colors: colors }
+}
+
+/* ionogram draws a white ionogram with black axes and ticks, gray grid
+ * lines and the traces: E from 1.5 to 2.8 MHz at 110 km, F from 3 to 6.5
+ * MHz rising from 220 to 400 km, X of F 0.7 MHz above it and a short X of E
+ * from 1.3 MHz. A single O pixel at 9 MHz is noise.
+ */
+func ionogram() (*image.RGBA) {
+  img := image.NewRGBA(image.Rect(0, 0, 600, 400))
+  x := func(f float64) int { return int(math.Round(50 + (f - 1) / freqStep)) }
+  y := func(h float64) int { return int(math.Round(380 - h / heightStep)) }
+  for py := 0; py < 400; py++ {
+    for px := 0; px < 600; px++ {
+      img.Set(px, py, color.White)
+    }
+  }
+  for f := 1; f <= 10; f++ {
+    for py := 20; py < 380; py++ {
+      img.Set(x(float64(f)), py, color.Gray{ 200 })
+    }
+    for py := 380; py < 386; py++ {
+      img.Set(x(float64(f)), py, color.Black)
+    }
+  }
+  for h := 0; h <= 700; h += 100 {
+    for px := 44; px < 50; px++ {
+      img.Set(px, y(float64(h)), color.Black)
+    }
+  }
+  trace := func(from, to float64, height func(f float64) float64, c color.Color) {
+    for px := x(from); px <= x(to); px++ {
+      py := y(height(1 + float64(px - 50) * freqStep))
+      img.Set(px, py, c)
+      img.Set(px, py - 1, c)
+    }
+  }
+  trace(1.5, 2.8, func(f float64) float64 { return 110 }, oColor)
+  trace(1.3, 1.6, func(f float64) float64 { return 116 }, xColor)
+  trace(3.0, 6.5, func(f float64) float64 { return 220 + (f - 3) * (f - 3) * 180 / 12.25 }, oColor)
+  trace(3.7, 7.2, func(f float64) float64 { return 230 + (f - 3.7) * (f - 3.7) * 180 / 12.25 }, xColor)
+  img.Set(x(9), y(300), oColor)
+  return img
+}
+
+func TestDigitize(t *testing.T) {
+  res := Digitize(ionogram(), testCalibration(t))
+  want := []struct {
+    name string
+    value, step float64
+  }{
+    { Fmin, 1.3, freqStep },
+    { FoE, 2.8, freqStep },
+    { FoF2, 6.5, freqStep },
+    { HF, 220, heightStep },
+  }
+  for _, w := range want {
+    v, ok := res.Values[w.name]
+    if ! ok || math.Abs(v - w.value) > w.step {
+      t.Errorf("%s = %g (%t), want %g within %g", w.name, v, ok, w.value, w.step)
+    }
+  }
+  if len(res.Values) != len(want) {
+    t.Errorf("Values %v, want %d", res.Values, len(want))
+  }
+  // the O trace without the noise, ordered by frequency
+  for n, p := range res.Trace {
+    if p.Freq > 6.5 + freqStep {
+      t.Errorf("trace point %v is above foF2", p)
+    }
+    if n > 0 && p.Pixel.X <= res.Trace[n - 1].Pixel.X {
+      t.Errorf("trace is not ordered at %v", p)
+    }
+  }
+
+  // without traces nothing is found
+  blank := image.NewRGBA(image.Rect(0, 0, 600, 400))
+  if res := Digitize(blank, testCalibration(t)); len(res.Values) != 0 || len(res.Trace) != 0 {
+    t.Errorf("Digitize of a blank image = %v", res.Values)
+  }
+  // a plot area outside the image is clipped
+  c := testCalibration(t)
+  c.Area = image.Rect(50, 20, 900, 380)
+  if res := Digitize(ionogram(), c); math.Abs(res.Values[FoF2] - 6.5) > freqStep {
+    t.Errorf("foF2 with a clipped plot area = %g", res.Values[FoF2])
+  }
+}
+
+func TestParseAxis(t *testing.T) {
+  cases := []struct {
+    spec string
+    pixel, want float64
+  }{
+    { "50=1,590=10", 320, 5.5 },
+    { " 380 = 0 , 20 = 720 ", 200, 360 },
+    { "100=1,580=10,log", 340, math.Sqrt(10) },
+    { "LOG,100=1,580=10", 580, 10 },
+  }
+  for _, c := range cases {
+    a, err := ParseAxis(c.spec)
+    if err != nil {
+      t.Errorf("ParseAxis(%q): %v", c.spec, err)
+      continue
+    }
+    if v := a.Value(c.pixel); math.Abs(v - c.want) > 1e-9 {
+      t.Errorf("ParseAxis(%q).Value(%g) = %g, want %g", c.spec, c.pixel, v, c.want)
+    }
+  }
+  for _, spec := range []string{
+    "",
+    "100=1",
+    "100=1,580=10,700=12",
+    "100:1,580=10",
+    "a=1,580=10",
+    "100=x,580=10",
+    "100=1,100=10",
+    "100=1,580=1",
+    "100=0,580=10,log",
+  } {
+    if a, err := ParseAxis(spec); err == nil {
+      t.Errorf("ParseAxis(%q) = %+v, want an error", spec, a)
+    }
+  }
+}
+
+func TestParseColors(t *testing.T) {
+  c, err := ParseColors("")
+  if err != nil || c != DefaultColors {
+    t.Errorf("ParseColors(\"\") = %+v, %v, want the defaults", c, err)
+  }
+  c, err = ParseColors(" O=#C00000, tolerance=40 ")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if c.O != (color.RGBA{ 0xc0, 0, 0, 255 }) || c.X != DefaultColors.X || c.Tolerance != 40 {
+    t.Errorf("ParseColors = %+v", c)
+  }
+  for _, spec := range []string{
+    "o",
+    "o=red",
+    "x=#12345",
+    "x=#zzzzzz",
+    "tolerance=x",
+    "tolerance=-1",
+    "y=#ffffff",
+  } {
+    if c, err := ParseColors(spec); err == nil {
+      t.Errorf("ParseColors(%q) = %+v, want an error", spec, c)
+    }
+  }
+}